@@ -0,0 +1,471 @@
+// Package analysis inspects parsed Vibe programs without running them
+package analysis
+
+import (
+	"fmt"
+
+	"github.com/example/vibe/parser"
+	"github.com/example/vibe/types"
+)
+
+// Diagnostic describes a problem found in a program
+type Diagnostic struct {
+	Message string
+	Node    parser.Node // The statement or expression the problem was found in
+}
+
+func (d Diagnostic) String() string {
+	return d.Message
+}
+
+// scope tracks the types of the variables visible at a point in the program
+type scope struct {
+	vars     map[string]types.Type
+	declared map[string]bool // Variables whose type came from an annotation
+	outer    *scope
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{
+		vars:     make(map[string]types.Type),
+		declared: make(map[string]bool),
+		outer:    outer,
+	}
+}
+
+func (s *scope) lookup(name string) (types.Type, bool, bool) {
+	for cur := s; cur != nil; cur = cur.outer {
+		if t, ok := cur.vars[name]; ok {
+			return t, cur.declared[name], true
+		}
+	}
+	return nil, false, false
+}
+
+// checker walks a program collecting diagnostics
+type checker struct {
+	functions   map[string]*parser.FunctionDef
+	diagnostics []Diagnostic
+}
+
+// TypeCheck reports every type error it can find in program without
+// evaluating it: assignments to annotated variables, call arity and
+// argument types, return types, array element types, and the operand types
+// of arithmetic.
+//
+// Expressions whose type can't be known statically (function parameters
+// without annotations, builtins, and so on) are treated as any and never
+// reported, so every diagnostic is a definite error.
+func TypeCheck(program *parser.Program) []Diagnostic {
+	c := &checker{functions: make(map[string]*parser.FunctionDef)}
+
+	// Collect function signatures first so calls can be checked in any order
+	for _, stmt := range program.Statements {
+		if fn, ok := stmt.(*parser.FunctionDef); ok {
+			c.functions[fn.Name] = fn
+		}
+	}
+
+	global := newScope(nil)
+	for _, stmt := range program.Statements {
+		c.checkStatement(stmt, global, nil)
+	}
+
+	return c.diagnostics
+}
+
+func (c *checker) report(node parser.Node, format string, args ...interface{}) {
+	c.diagnostics = append(c.diagnostics, Diagnostic{
+		Message: "Type error: " + fmt.Sprintf(format, args...),
+		Node:    node,
+	})
+}
+
+// checkStatement checks a statement. fn is the enclosing function, if any,
+// whose return type return statements are checked against.
+func (c *checker) checkStatement(node parser.Node, s *scope, fn *parser.FunctionDef) {
+	switch node := node.(type) {
+	case *parser.VariableDecl:
+		var declared types.Type = types.AnyType
+		if node.TypeAnnotation != nil {
+			declared = types.FromAnnotation(node.TypeAnnotation)
+		}
+		if node.Value != nil {
+			c.checkAssignable(node.Value, declared, s, "variable '"+node.Name+"'")
+		}
+		s.vars[node.Name] = declared
+		s.declared[node.Name] = node.TypeAnnotation != nil
+	case *parser.Assignment:
+		if declared, annotated, ok := s.lookup(node.Name); ok && annotated {
+			c.checkAssignable(node.Value, declared, s, "variable '"+node.Name+"'")
+			return
+		}
+		s.vars[node.Name] = c.inferStoredType(node.Value, s)
+	case *parser.FunctionDef:
+		body := newScope(s)
+		for _, param := range node.Parameters {
+			body.vars[param.Name] = types.AnyType
+			if param.Type != nil {
+				body.vars[param.Name] = types.FromAnnotation(param.Type)
+			}
+			body.declared[param.Name] = param.Type != nil
+		}
+		c.checkBlock(node.Body, body, node)
+	case *parser.ReturnStmt:
+		if node.Value == nil {
+			// A bare return gives nil, which the declared type must accept
+			if fn != nil && fn.ReturnType != nil {
+				if returnType := types.FromAnnotation(fn.ReturnType); !types.IsAssignable(types.NilType, returnType) {
+					c.report(node, "return in function '%s' needs a value of type %s", fn.Name, returnType.String())
+				}
+			}
+			return
+		}
+		if fn == nil || fn.ReturnType == nil {
+			c.inferType(node.Value, s)
+			return
+		}
+		if types.FromAnnotation(fn.ReturnType) == types.VoidType {
+			c.inferType(node.Value, s)
+			if _, ok := node.Value.(*parser.NilLiteral); !ok {
+				c.report(node.Value, "void function '%s' can't return a value", fn.Name)
+			}
+			return
+		}
+		c.checkAssignable(node.Value, types.FromAnnotation(fn.ReturnType), s,
+			"return value of function '"+fn.Name+"'")
+	case *parser.IfStmt:
+		c.inferType(node.Condition, s)
+		c.checkBlock(node.Consequence, s, fn)
+		for _, elseIf := range node.ElseIfBlocks {
+			c.inferType(elseIf.Condition, s)
+			c.checkBlock(elseIf.Consequence, s, fn)
+		}
+		c.checkBlock(node.Alternative, s, fn)
+	case *parser.TryStmt:
+		c.checkBlock(node.Body, s, fn)
+		for _, rescue := range node.Rescues {
+			if rescue.Variable != "" {
+				if _, annotated, ok := s.lookup(rescue.Variable); !ok || !annotated {
+					s.vars[rescue.Variable] = types.MapType
+				}
+			}
+			c.checkBlock(rescue.Body, s, fn)
+		}
+	case *parser.WhileStmt:
+		c.inferType(node.Condition, s)
+		c.checkBlock(node.Body, s, fn)
+	case *parser.DoWhileStmt:
+		c.checkBlock(node.Body, s, fn)
+		c.inferType(node.Condition, s)
+	case *parser.ForStmt:
+		var elemType types.Type = types.AnyType
+		if arrayType, ok := c.inferType(node.Iterable, s).(types.ArrayType); ok {
+			elemType = arrayType.ElementType
+		}
+		if _, annotated, ok := s.lookup(node.Iterator); !ok || !annotated {
+			s.vars[node.Iterator] = elemType
+		}
+		if node.Value != "" {
+			if _, annotated, ok := s.lookup(node.Value); !ok || !annotated {
+				s.vars[node.Value] = types.AnyType
+			}
+		}
+		c.checkBlock(node.Body, s, fn)
+	case *parser.IndexAssignment:
+		c.inferType(node.Target.Array, s)
+		c.inferType(node.Target.Index, s)
+		// An element of a variable declared as Array<T> must be a T
+		if name, ok := node.Target.Array.(*parser.Identifier); ok {
+			declared, annotated, _ := s.lookup(name.Name)
+			if arrayType, ok := declared.(types.ArrayType); ok && annotated {
+				c.checkAssignable(node.Value, arrayType.ElementType, s, "an element of '"+name.Name+"'")
+				return
+			}
+		}
+		c.inferStoredType(node.Value, s)
+	case *parser.PrintStmt:
+		c.inferType(node.Value, s)
+	case *parser.UndefStmt:
+		delete(s.vars, node.Name)
+		delete(s.declared, node.Name)
+	case *parser.BlockStmt:
+		c.checkBlock(node, s, fn)
+	default:
+		c.inferType(node, s)
+	}
+}
+
+func (c *checker) checkBlock(block *parser.BlockStmt, s *scope, fn *parser.FunctionDef) {
+	if block == nil {
+		return
+	}
+	for _, stmt := range block.Statements {
+		c.checkStatement(stmt, s, fn)
+	}
+}
+
+// checkAssignable reports value if its type can't be assigned to dst.
+// Array literals are checked element by element so that each bad element
+// gets its own diagnostic.
+func (c *checker) checkAssignable(value parser.Node, dst types.Type, s *scope, target string) {
+	if arrayType, ok := dst.(types.ArrayType); ok {
+		if literal, ok := value.(*parser.ArrayLiteral); ok {
+			for idx, element := range literal.Elements {
+				elemType := c.inferStoredType(element, s)
+				if isKnown(elemType) && !types.IsAssignable(elemType, arrayType.ElementType) {
+					c.report(element, "element %d of %s must be %s, got %s",
+						idx, target, arrayType.ElementType.String(), elemType.String())
+				}
+			}
+			return
+		}
+	}
+
+	valueType := c.inferStoredType(value, s)
+	if isKnown(valueType) && !types.IsAssignable(valueType, dst) {
+		c.report(value, "cannot assign %s to %s of type %s",
+			valueType.String(), target, dst.String())
+	}
+}
+
+// isKnown reports whether a type was fully determined statically
+func isKnown(t types.Type) bool {
+	if arrayType, ok := t.(types.ArrayType); ok {
+		return isKnown(arrayType.ElementType)
+	}
+	return t.String() != types.AnyType.String()
+}
+
+// inferStoredType determines the type of a value that's kept, such as an
+// element of a literal or the value of an assignment. The bare name of a
+// function there refers to the function instead of calling it, as it does
+// when the program runs.
+func (c *checker) inferStoredType(node parser.Node, s *scope) types.Type {
+	if call, ok := node.(*parser.CallExpr); ok && call.Bare {
+		if ident, ok := call.Function.(*parser.Identifier); ok {
+			if _, _, ok := s.lookup(ident.Name); !ok {
+				if _, ok := c.functions[ident.Name]; ok {
+					return types.AnyType
+				}
+			}
+		}
+	}
+	return c.inferType(node, s)
+}
+
+// inferType determines the static type of an expression, checking any calls
+// it contains along the way
+func (c *checker) inferType(node parser.Node, s *scope) types.Type {
+	switch node := node.(type) {
+	case *parser.NumberLiteral:
+		if node.IsInt {
+			return types.IntType
+		}
+		return types.FloatType
+	case *parser.StringLiteral:
+		return types.StringType
+	case *parser.BooleanLiteral:
+		return types.BoolType
+	case *parser.NilLiteral:
+		return types.NilType
+	case *parser.Identifier:
+		if t, _, ok := s.lookup(node.Name); ok {
+			return t
+		}
+		return types.AnyType
+	case *parser.ArrayLiteral:
+		if len(node.Elements) == 0 {
+			return types.ArrayType{ElementType: types.AnyType}
+		}
+		elemType := c.inferStoredType(node.Elements[0], s)
+		for _, element := range node.Elements[1:] {
+			if c.inferStoredType(element, s).String() != elemType.String() {
+				elemType = types.AnyType
+			}
+		}
+		return types.ArrayType{ElementType: elemType}
+	case *parser.MapLiteral:
+		for idx, key := range node.Keys {
+			c.inferType(key, s)
+			c.inferStoredType(node.Values[idx], s)
+		}
+		return types.MapType
+	case *parser.UnaryExpr:
+		operand := c.inferType(node.Right, s)
+		if node.Operator == "!" {
+			return types.BoolType
+		}
+		if operandKind(operand) != "" && !isNumeric(operand) {
+			c.report(node, "unsupported operator %s for type %s", node.Operator, operand.String())
+		}
+		return operand
+	case *parser.CastExpr:
+		c.inferType(node.Value, s)
+		return types.FromAnnotation(node.Target)
+	case *parser.BinaryExpr:
+		return c.inferBinaryType(node, s)
+	case *parser.CallExpr:
+		return c.inferCallType(node, s)
+	case *parser.MethodCall:
+		receiver := c.inferType(node.Object, s)
+		for _, arg := range node.Args {
+			c.inferType(arg, s)
+		}
+		if methods, ok := valueMethodTypes[receiver.String()]; ok {
+			if result, ok := methods[node.Method]; ok {
+				return result
+			}
+		}
+	}
+	return types.AnyType
+}
+
+// valueMethodTypes gives the result types of the methods built-in values
+// have, by receiver type and then method name, so method chains type-check
+var valueMethodTypes = map[string]map[string]types.Type{
+	"string": {
+		"size":     types.IntType,
+		"count":    types.IntType,
+		"length":   types.IntType,
+		"upcase":   types.StringType,
+		"downcase": types.StringType,
+		"trim":     types.StringType,
+		"split":    types.ArrayType{ElementType: types.StringType},
+		"replace":  types.StringType,
+	},
+}
+
+func (c *checker) inferBinaryType(node *parser.BinaryExpr, s *scope) types.Type {
+	left := c.inferType(node.Left, s)
+	right := c.inferType(node.Right, s)
+	if !operandsSupported(node.Operator, left, right) {
+		c.report(node, "unsupported operator %s for types %s and %s", node.Operator, left.String(), right.String())
+	}
+
+	switch node.Operator {
+	case "==", "!=", "<", ">", "<=", ">=", "&&", "||", "in":
+		return types.BoolType
+	case "<=>":
+		return types.IntType
+	case "+":
+		if left.String() == "string" || right.String() == "string" {
+			return types.StringType
+		}
+	case "*":
+		// Repeating a string or array keeps its type
+		if _, isArray := left.(types.ArrayType); (isArray || left.String() == "string") && right.String() == "int" {
+			return left
+		}
+	}
+
+	switch node.Operator {
+	case "**":
+		// An int raised to a negative int is a float, which isn't known statically
+		if isNumeric(left) && isNumeric(right) && (left.String() == "float" || right.String() == "float") {
+			return types.FloatType
+		}
+	case "+", "-", "*", "/", "%":
+		if left.String() == "int" && right.String() == "int" {
+			return types.IntType
+		}
+		if isNumeric(left) && isNumeric(right) {
+			return types.FloatType
+		}
+	}
+	return types.AnyType
+}
+
+func isNumeric(t types.Type) bool {
+	return t.String() == "int" || t.String() == "float"
+}
+
+// operandKind names the kind of value a static type guarantees, or "" when
+// the type doesn't pin one down well enough to check an operator against
+func operandKind(t types.Type) string {
+	if _, ok := t.(types.ArrayType); ok {
+		return "array"
+	}
+	switch t.String() {
+	case "int", "float", "string", "bool", "nil", "map":
+		return t.String()
+	}
+	return ""
+}
+
+// operandsSupported reports whether an arithmetic operator can apply to
+// operands of the given types. Operands of unknown kind are assumed to fit.
+func operandsSupported(operator string, left, right types.Type) bool {
+	leftKind, rightKind := operandKind(left), operandKind(right)
+	if leftKind == "" || rightKind == "" {
+		return true
+	}
+
+	numeric := isNumeric(left) && isNumeric(right)
+	switch operator {
+	case "+":
+		// Adding to a string concatenates
+		return numeric || leftKind == "string" || rightKind == "string"
+	case "*":
+		return numeric || ((leftKind == "string" || leftKind == "array") && rightKind == "int")
+	case "-", "/", "%", "**":
+		return numeric
+	}
+	return true
+}
+
+func (c *checker) inferCallType(node *parser.CallExpr, s *scope) types.Type {
+	ident, ok := node.Function.(*parser.Identifier)
+	if !ok {
+		c.inferType(node.Function, s)
+		for _, arg := range node.Args {
+			c.inferType(arg, s)
+		}
+		return types.AnyType
+	}
+
+	// A bare identifier parses as a call with no arguments; variables win,
+	// just as they do when the program runs
+	if len(node.Args) == 0 {
+		if t, _, ok := s.lookup(ident.Name); ok {
+			return t
+		}
+	}
+
+	fn, ok := c.functions[ident.Name]
+	if !ok {
+		for _, arg := range node.Args {
+			c.inferType(arg, s)
+		}
+		return types.AnyType
+	}
+
+	// The bare name of a function that takes arguments refers to it
+	if node.Bare && len(fn.Parameters) > 0 {
+		return types.AnyType
+	}
+
+	if len(node.Args) > len(fn.Parameters) {
+		c.report(node, "function '%s' expects %d arguments, got %d",
+			fn.Name, len(fn.Parameters), len(node.Args))
+	}
+
+	for idx, arg := range node.Args {
+		if idx >= len(fn.Parameters) || fn.Parameters[idx].Type == nil {
+			c.inferType(arg, s)
+			continue
+		}
+		param := fn.Parameters[idx]
+		c.checkAssignable(arg, types.FromAnnotation(param.Type), s,
+			fmt.Sprintf("parameter '%s' of function '%s'", param.Name, fn.Name))
+	}
+
+	if fn.ReturnType == nil {
+		return types.AnyType
+	}
+	if returnType := types.FromAnnotation(fn.ReturnType); returnType != types.VoidType {
+		return returnType
+	}
+	// Calling a void function gives nil
+	return types.NilType
+}
@@ -0,0 +1,167 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/example/vibe/lexer"
+	"github.com/example/vibe/parser"
+)
+
+func typeCheck(t *testing.T, input string) []Diagnostic {
+	program, errors := parser.Parse(lexer.New(input))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+	return TypeCheck(program)
+}
+
+func TestTypeCheckReportsEveryError(t *testing.T) {
+	input := `
+x: int = "hello"
+
+def add(a: int, b: int): int do
+  return a + b
+end
+
+def name(): int do
+  return "bob"
+end
+
+def log(): void do
+  return 1
+end
+
+def total(): int do
+  return
+end
+
+y = add("one", 2)
+z = add(1, 2, 3)
+nums: Array<int> = [1, "two", 3]
+count: int = 0
+count = "many"
+nums[0] = "four"
+`
+
+	expected := []string{
+		"variable 'x'",
+		"return value of function 'name'",
+		"void function 'log' can't return a value",
+		"return in function 'total' needs a value of type int",
+		"parameter 'a' of function 'add'",
+		"function 'add' expects 2 arguments, got 3",
+		"element 1 of variable 'nums'",
+		"variable 'count'",
+		"an element of 'nums'",
+	}
+
+	diagnostics := typeCheck(t, input)
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %d: %v", len(expected), len(diagnostics), diagnostics)
+	}
+
+	for idx, want := range expected {
+		if !strings.Contains(diagnostics[idx].Message, want) {
+			t.Errorf("Diagnostic %d: expected mention of %q, got %q", idx, want, diagnostics[idx].Message)
+		}
+	}
+}
+
+func TestTypeCheckCleanProgram(t *testing.T) {
+	input := `
+def add(a: int, b: int): int do
+  return a + b
+end
+
+def report(n: int): void do
+  if n < 0 do
+    return
+  end
+  puts n
+end
+
+total: int = add(1, 2)
+report(total)
+ratio: float = total
+names: Array<string> = ["a", "b"]
+names[0] = "c"
+ratios: Array<float> = [1, 2.5]
+for n in names do
+  puts n
+end
+`
+
+	diagnostics := typeCheck(t, input)
+	if len(diagnostics) != 0 {
+		t.Errorf("Expected no diagnostics, got %v", diagnostics)
+	}
+}
+
+func TestTypeCheckStringMethodChains(t *testing.T) {
+	input := `
+name: string = "  Ada ".trim().upcase()
+size: int = name.downcase().length()
+words: Array<string> = "a b".split(" ")
+count: int = "hello".replace("l", "L")
+`
+
+	diagnostics := typeCheck(t, input)
+	if len(diagnostics) != 1 || !strings.Contains(diagnostics[0].Message, "cannot assign string to variable 'count'") {
+		t.Errorf("Expected one diagnostic for 'count', got %v", diagnostics)
+	}
+}
+
+func TestTypeCheckCasts(t *testing.T) {
+	input := `
+count: int = "5" as int
+ratio: float = count as float
+label: int = count as string
+found: bool = count in [1, 2]
+`
+
+	diagnostics := typeCheck(t, input)
+	if len(diagnostics) != 1 || !strings.Contains(diagnostics[0].Message, "cannot assign string to variable 'label'") {
+		t.Errorf("Expected one diagnostic for 'label', got %v", diagnostics)
+	}
+}
+
+func TestTypeCheckOperators(t *testing.T) {
+	input := `
+count: int = 3
+ratio: float = count / 2.0
+label = "n=" + count
+line = "-" * count
+row = [0] * count
+nums: Array<int> = [1, 2]
+
+bad_sum = count + true
+bad_diff = label - 1
+bad_repeat = count * "ab"
+bad_negate = -label
+bad_power = nums ** 2
+
+def half(n): int do
+  return n / 2
+end
+`
+
+	expected := []string{
+		"unsupported operator + for types int and bool",
+		"unsupported operator - for types string and int",
+		"unsupported operator * for types int and string",
+		"unsupported operator - for type string",
+		"unsupported operator ** for types Array<int> and int",
+	}
+
+	diagnostics := typeCheck(t, input)
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %d: %v", len(expected), len(diagnostics), diagnostics)
+	}
+
+	for idx, want := range expected {
+		if !strings.Contains(diagnostics[idx].Message, want) {
+			t.Errorf("Diagnostic %d: expected mention of %q, got %q", idx, want, diagnostics[idx].Message)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package interpreter_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/example/vibe/interpreter"
+	"github.com/example/vibe/lexer"
+	"github.com/example/vibe/parser"
+)
+
+// These benchmarks time evaluation only: each program is parsed once before
+// the timer starts, with the parser's debug output discarded so it can't
+// interleave with the results.
+// Compare runs before and after a change with
+//
+//	go test -run '^$' -bench . -benchmem -count 10 ./interpreter > old.txt
+//	(make the change)
+//	go test -run '^$' -bench . -benchmem -count 10 ./interpreter > new.txt
+//	benchstat old.txt new.txt
+//
+// Every iteration uses a fresh interpreter, so no state carries over.
+
+const loopProgram = `total = 0
+i = 0
+while i < 1000 do
+  total = total + i * 2 - 1
+  i = i + 1
+end
+total`
+
+const fibonacciProgram = `def fib(n: int): int do
+  if n < 2 do
+    return n
+  end
+  return fib(n - 1) + fib(n - 2)
+end
+fib(15)`
+
+func benchmarkProgram(b *testing.B, source string, expected int) {
+	stdout := os.Stdout
+	os.Stdout, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	program, errors := parser.Parse(lexer.New(source))
+	os.Stdout.Close()
+	os.Stdout = stdout
+	if len(errors) > 0 {
+		b.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		result := interpreter.New().Eval(program)
+		if integer, ok := result.(*interpreter.IntegerValue); !ok || integer.Value != expected {
+			b.Fatalf("Expected %d, got %v", expected, result)
+		}
+	}
+}
+
+func BenchmarkArithmeticLoop(b *testing.B) {
+	benchmarkProgram(b, loopProgram, 998000)
+}
+
+func BenchmarkRecursiveFibonacci(b *testing.B) {
+	benchmarkProgram(b, fibonacciProgram, 610)
+}
+
+const countdownProgram = `def countdown(n) do
+  if n == 0 do
+    return 0
+  end
+  return 1 + countdown(n - 1)
+end
+countdown(500)`
+
+func BenchmarkUntypedRecursion(b *testing.B) {
+	benchmarkProgram(b, countdownProgram, 500)
+}
+
+const comparisonProgram = `count = 0
+i = 0
+while i < 1000 do
+  if i % 3 == 0 || i > 500 && !(i == 700) do
+    count = count + 1
+  end
+  i = i + 1
+end
+count`
+
+func BenchmarkComparisonLoop(b *testing.B) {
+	benchmarkProgram(b, comparisonProgram, 665)
+}
@@ -2,9 +2,11 @@ package interpreter
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -13,6 +15,27 @@ import (
 	"github.com/example/vibe/types"
 )
 
+// Value type names, as returned by Value.Type()
+const (
+	INTEGER_OBJ  = "INTEGER"
+	FLOAT_OBJ    = "FLOAT"
+	STRING_OBJ   = "STRING"
+	BOOLEAN_OBJ  = "BOOLEAN"
+	NIL_OBJ      = "NIL"
+	RETURN_OBJ   = "RETURN"
+	ERROR_OBJ    = "ERROR"
+	BREAK_OBJ    = "BREAK"
+	CONTINUE_OBJ = "CONTINUE"
+	EXIT_OBJ     = "EXIT"
+	FUNCTION_OBJ = "FUNCTION"
+	ARRAY_OBJ    = "ARRAY"
+	RANGE_OBJ    = "RANGE"
+	MAP_OBJ      = "MAP"
+	BUILTIN_OBJ  = "BUILTIN"
+	CLASS_OBJ    = "CLASS"
+	OBJECT_OBJ   = "OBJECT"
+)
+
 // Value interface represents values in our language
 type Value interface {
 	Type() string
@@ -25,7 +48,7 @@ type IntegerValue struct {
 	Value int
 }
 
-func (i *IntegerValue) Type() string { return "INTEGER" }
+func (i *IntegerValue) Type() string { return INTEGER_OBJ }
 func (i *IntegerValue) Inspect() string { return strconv.Itoa(i.Value) }
 func (i *IntegerValue) VibeType() types.Type { return types.IntType }
 
@@ -34,16 +57,25 @@ type FloatValue struct {
 	Value float64
 }
 
-func (f *FloatValue) Type() string { return "FLOAT" }
-func (f *FloatValue) Inspect() string { return strconv.FormatFloat(f.Value, 'f', -1, 64) }
+func (f *FloatValue) Type() string { return FLOAT_OBJ }
 func (f *FloatValue) VibeType() types.Type { return types.FloatType }
 
+// Inspect always includes a decimal point, so a whole float like 5.0 can't
+// be mistaken for the integer 5. Printed output keeps the shorter form; see Display.
+func (f *FloatValue) Inspect() string {
+	text := strconv.FormatFloat(f.Value, 'f', -1, 64)
+	if math.IsInf(f.Value, 0) || math.IsNaN(f.Value) || strings.Contains(text, ".") {
+		return text
+	}
+	return text + ".0"
+}
+
 // StringValue represents a string value
 type StringValue struct {
 	Value string
 }
 
-func (s *StringValue) Type() string { return "STRING" }
+func (s *StringValue) Type() string { return STRING_OBJ }
 func (s *StringValue) Inspect() string { return s.Value }
 func (s *StringValue) VibeType() types.Type { return types.StringType }
 
@@ -52,26 +84,115 @@ type BooleanValue struct {
 	Value bool
 }
 
-func (b *BooleanValue) Type() string { return "BOOLEAN" }
+func (b *BooleanValue) Type() string { return BOOLEAN_OBJ }
 func (b *BooleanValue) Inspect() string { return strconv.FormatBool(b.Value) }
 func (b *BooleanValue) VibeType() types.Type { return types.BoolType }
 
+// True and False are the two boolean values. The interpreter only ever hands
+// out these, so booleans can be compared by pointer.
+var (
+	True  = &BooleanValue{Value: true}
+	False = &BooleanValue{Value: false}
+)
+
+// nativeBoolToBooleanObject returns the shared boolean value for b
+func nativeBoolToBooleanObject(b bool) *BooleanValue {
+	if b {
+		return True
+	}
+	return False
+}
+
 // NilValue represents a nil value
 type NilValue struct{}
 
-func (n *NilValue) Type() string { return "NIL" }
+func (n *NilValue) Type() string { return NIL_OBJ }
 func (n *NilValue) Inspect() string { return "nil" }
 func (n *NilValue) VibeType() types.Type { return types.NilType }
 
+// Nil is the nil value. The interpreter only ever hands out this one, so
+// every nil it produces is the same pointer.
+var Nil = &NilValue{}
+
 // ReturnValue wraps a return value
 type ReturnValue struct {
 	Value Value
 }
 
-func (r *ReturnValue) Type() string { return "RETURN" }
+func (r *ReturnValue) Type() string { return RETURN_OBJ }
 func (r *ReturnValue) Inspect() string { return r.Value.Inspect() }
 func (r *ReturnValue) VibeType() types.Type { return r.Value.VibeType() }
 
+// ErrorValue represents a runtime error raised during evaluation
+type ErrorValue struct {
+	Kind    ErrorKind
+	Message string
+	Fatal   bool // Set by panic; no rescue clause handles it
+}
+
+func (e *ErrorValue) Type() string { return ERROR_OBJ }
+func (e *ErrorValue) Inspect() string { return e.Message }
+func (e *ErrorValue) VibeType() types.Type { return types.ErrorType }
+
+// Error lets a runtime error be returned as a Go error, keeping its kind
+func (e *ErrorValue) Error() string { return e.Message }
+
+// ErrorKind says what category of problem a runtime error reports, so it
+// can be told apart without matching on the message
+type ErrorKind string
+
+const (
+	TypeError      ErrorKind = "TypeError"      // A value of the wrong type
+	NameError      ErrorKind = "NameError"      // An unknown variable, method or property
+	IndexError     ErrorKind = "IndexError"     // An index outside an array or string
+	ArgumentError  ErrorKind = "ArgumentError"  // The wrong number of arguments, or an invalid one
+	DivisionByZero ErrorKind = "DivisionByZero" // Division or modulo by zero
+	OverflowError  ErrorKind = "OverflowError"  // An integer result too large to represent
+	FrozenError    ErrorKind = "FrozenError"    // Modifying a frozen collection
+	SyntaxError    ErrorKind = "SyntaxError"    // Source given to eval or a macro that doesn't parse
+	RuntimeError   ErrorKind = "RuntimeError"   // Anything else
+)
+
+// isErrorKind reports whether name is one of the error kinds above
+func isErrorKind(name string) bool {
+	switch ErrorKind(name) {
+	case TypeError, NameError, IndexError, ArgumentError, DivisionByZero,
+		OverflowError, FrozenError, SyntaxError, RuntimeError:
+		return true
+	}
+	return false
+}
+
+// BreakValue signals a break out of the innermost loop, or the loop named by Label
+type BreakValue struct {
+	Label string
+}
+
+func (b *BreakValue) Type() string { return BREAK_OBJ }
+func (b *BreakValue) Inspect() string { return "break" }
+func (b *BreakValue) VibeType() types.Type { return types.NilType }
+
+// ContinueValue signals a skip to the next iteration of the innermost loop,
+// or of the loop named by Label
+type ContinueValue struct {
+	Label string
+}
+
+func (c *ContinueValue) Type() string { return CONTINUE_OBJ }
+func (c *ContinueValue) Inspect() string { return "continue" }
+func (c *ContinueValue) VibeType() types.Type { return types.NilType }
+
+// ExitValue signals that the program asked to terminate with Code. It
+// unwinds evaluation like an error; whoever is running the program decides
+// what exiting means.
+type ExitValue struct {
+	Code int
+}
+
+func (e *ExitValue) Type() string { return EXIT_OBJ }
+func (e *ExitValue) Inspect() string { return fmt.Sprintf("exit(%d)", e.Code) }
+func (e *ExitValue) VibeType() types.Type { return types.NilType }
+
 // FunctionValue represents a function
 type FunctionValue struct {
 	Name           string
@@ -80,11 +201,46 @@ type FunctionValue struct {
 	ReturnType     types.Type
 	Env            *Environment
 	BuiltinFunc    func(args []Value) Value
+
+	// paramTypes caches the parameter types; see parameterTypes
+	paramTypes []types.Type
+
+	// block is set for a do |x| ... end block, which can assign to the
+	// variables around it
+	block bool
+}
+
+// parameterTypes returns the declared type of each parameter, or any for
+// one without an annotation. They're resolved on the first call and reused.
+func (f *FunctionValue) parameterTypes() []types.Type {
+	if f.paramTypes == nil {
+		f.paramTypes = make([]types.Type, len(f.Parameters))
+		for idx, param := range f.Parameters {
+			f.paramTypes[idx] = types.AnyType
+			if param.Type != nil {
+				f.paramTypes[idx] = types.FromAnnotation(param.Type)
+			}
+		}
+	}
+	return f.paramTypes
 }
 
-func (f *FunctionValue) Type() string { return "FUNCTION" }
+func (f *FunctionValue) Type() string { return FUNCTION_OBJ }
+// Inspect shows the function's signature the way it was written, leaving
+// out annotations that are just any.
 func (f *FunctionValue) Inspect() string {
-	return fmt.Sprintf("function %s", f.Name)
+	params := make([]string, len(f.Parameters))
+	for idx, param := range f.Parameters {
+		params[idx] = param.Name
+		if paramType := f.parameterTypes()[idx].String(); paramType != types.AnyType.String() {
+			params[idx] += ": " + paramType
+		}
+	}
+	signature := fmt.Sprintf("def %s(%s)", f.Name, strings.Join(params, ", "))
+	if f.ReturnType != nil && f.ReturnType.String() != types.AnyType.String() {
+		signature += ": " + f.ReturnType.String()
+	}
+	return signature
 }
 func (f *FunctionValue) VibeType() types.Type {
 	// Directly use the return type
@@ -97,32 +253,46 @@ func (f *FunctionValue) VibeType() types.Type {
 // ArrayValue represents an array of values
 type ArrayValue struct {
 	Elements []Value
+	Frozen   bool // Set by freeze; elements can't be assigned
 }
 
-func (a *ArrayValue) Type() string { return "ARRAY" }
+func (a *ArrayValue) Type() string { return ARRAY_OBJ }
 func (a *ArrayValue) Inspect() string {
-	result := "["
-	for i, element := range a.Elements {
-		if i > 0 {
-			result += ", "
-		}
-		result += element.Inspect()
-	}
-	result += "]"
-	return result
+	return formatValue(a, Value.Inspect, nil)
 }
 func (a *ArrayValue) VibeType() types.Type {
+	return a.vibeType(nil)
+}
+
+// vibeType works out the array's type. inside holds the arrays it's nested
+// in, so an array that contains itself is typed Array<any> there rather
+// than recursing forever.
+func (a *ArrayValue) vibeType(inside []*ArrayValue) types.Type {
 	if len(a.Elements) == 0 {
 		// Empty array - default to array of any
 		return types.ArrayType{ElementType: types.AnyType}
 	}
 
+	inside = append(inside, a)
+	typeOf := func(element Value) types.Type {
+		nested, ok := element.(*ArrayValue)
+		if !ok {
+			return element.VibeType()
+		}
+		for _, outer := range inside {
+			if outer == nested {
+				return types.ArrayType{ElementType: types.AnyType}
+			}
+		}
+		return nested.vibeType(inside)
+	}
+
 	// Get the type of the first element
-	elementType := a.Elements[0].VibeType()
+	elementType := typeOf(a.Elements[0])
 
 	// Check if all elements have the same type
 	for _, element := range a.Elements {
-		if element.VibeType() != elementType {
+		if !types.Equal(typeOf(element), elementType) {
 			// If not, return array of any
 			return types.ArrayType{ElementType: types.AnyType}
 		}
@@ -131,31 +301,176 @@ func (a *ArrayValue) VibeType() types.Type {
 	return types.ArrayType{ElementType: elementType}
 }
 
+// formatValue writes a value the way Inspect does, using scalar for
+// anything that isn't an array or map. An array or map found inside itself
+// is written as [...] or {...} rather than recursing forever; inside holds
+// the ones currently being written, outermost first.
+func formatValue(value Value, scalar func(Value) string, inside []Value) string {
+	switch value.(type) {
+	case *ArrayValue, *MapValue:
+		for _, outer := range inside {
+			if outer == value {
+				if _, ok := value.(*MapValue); ok {
+					return "{...}"
+				}
+				return "[...]"
+			}
+		}
+		inside = append(inside, value)
+	}
+
+	switch value := value.(type) {
+	case *ArrayValue:
+		elements := make([]string, len(value.Elements))
+		for idx, element := range value.Elements {
+			elements[idx] = formatValue(element, scalar, inside)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *MapValue:
+		entries := make([]string, len(value.Keys))
+		for idx, key := range value.Keys {
+			entry, _, _ := value.Get(key)
+			entries[idx] = formatValue(key, scalar, inside) + ": " + formatValue(entry, scalar, inside)
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	}
+	return scalar(value)
+}
+
+// RangeValue represents an inclusive range of integers, such as 1..5
+type RangeValue struct {
+	Start int
+	End   int
+}
+
+func (r *RangeValue) Type() string { return RANGE_OBJ }
+func (r *RangeValue) Inspect() string { return fmt.Sprintf("%d..%d", r.Start, r.End) }
+func (r *RangeValue) VibeType() types.Type { return types.RangeType }
+
+// toArray materializes ranges (as integers) and strings (as characters) into
+// arrays, so they can be used anywhere an array is expected
+func toArray(value Value) (*ArrayValue, bool) {
+	switch value := value.(type) {
+	case *ArrayValue:
+		return value, true
+	case *RangeValue:
+		// Stopping at End rather than stepping past it means a range
+		// ending at the largest int doesn't wrap around and go on forever
+		elements := []Value{}
+		for n := value.Start; n <= value.End; n++ {
+			elements = append(elements, &IntegerValue{Value: n})
+			if n == value.End {
+				break
+			}
+		}
+		return &ArrayValue{Elements: elements}, true
+	case *StringValue:
+		elements := []Value{}
+		for _, char := range value.Value {
+			elements = append(elements, &StringValue{Value: string(char)})
+		}
+		return &ArrayValue{Elements: elements}, true
+	}
+	return nil, false
+}
+
+// containsValue reports whether an array holds item, a string holds item as
+// a substring, or a map holds item as a key. Errors name the operation doing
+// the search, which is contains or in.
+func containsValue(operation string, collection, item Value) Value {
+	switch collection := collection.(type) {
+	case *ArrayValue:
+		for _, element := range collection.Elements {
+			if valuesEqual(element, item) {
+				return True
+			}
+		}
+		return False
+	case *StringValue:
+		substr, ok := item.(*StringValue)
+		if !ok {
+			return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: %s on a string requires a string to search for", operation)}
+		}
+		return nativeBoolToBooleanObject(strings.Contains(collection.Value, substr.Value))
+	case *MapValue:
+		_, found, errVal := collection.Get(item)
+		if errVal != nil {
+			return errVal
+		}
+		return nativeBoolToBooleanObject(found)
+	}
+	return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: %s requires an array, string or map to search, got %s",
+		operation, collection.VibeType().String())}
+}
+
+// isAssignable reports whether value can be stored where type t is expected.
+// An array fits an array type when each of its elements fits the element
+// type, so [1, 2.5] is an Array<float> and an empty array fits any of them.
+func isAssignable(value Value, t types.Type) bool {
+	switch t := t.(type) {
+	case types.ArrayType:
+		if array, ok := value.(*ArrayValue); ok {
+			for _, element := range array.Elements {
+				if !isAssignable(element, t.ElementType) {
+					return false
+				}
+			}
+			return true
+		}
+	case types.UnionType:
+		for _, member := range t.Types {
+			if isAssignable(value, member) {
+				return true
+			}
+		}
+		return false
+	}
+	return types.IsAssignable(value.VibeType(), t)
+}
+
+// arrayArgument converts a range or string passed for a parameter of array
+// type into an array, leaving any other argument as it is
+func arrayArgument(arg Value, paramType types.Type) Value {
+	if _, ok := paramType.(types.ArrayType); !ok {
+		return arg
+	}
+	if array, ok := toArray(arg); ok {
+		return array
+	}
+	return arg
+}
+
 // Environment wraps the symbol table for variables and functions
 type Environment struct {
-	store    map[string]Value
-	types    map[string]types.Type
-	outer    *Environment
+	store map[string]Value
+	types map[string]types.Type // Created on the first typed variable
+	outer *Environment
+
+	// block is set on the scope of a block's call, whose assignments update
+	// the variables of the scope the block was defined in; see owner
+	block bool
+
+	// builtins is shared by an environment and every scope enclosed in it,
+	// so creating a scope doesn't copy it and a lookup only checks it once
 	builtins map[string]*BuiltinFunction
 }
 
 // NewEnvironment creates a new environment
 func NewEnvironment() *Environment {
 	s := make(map[string]Value)
-	t := make(map[string]types.Type)
 	b := make(map[string]*BuiltinFunction)
-	return &Environment{store: s, types: t, builtins: b, outer: nil}
+	return &Environment{store: s, builtins: b, outer: nil}
 }
 
 // NewEnclosedEnvironment creates a new environment with an outer environment
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
-	// Copy builtins from outer
-	for name, builtin := range outer.builtins {
-		env.builtins[name] = builtin
-	}
-	return env
+	return newScope(outer, 0)
+}
+
+// newScope creates an environment enclosed in outer with room for size
+// variables, such as a function's parameters
+func newScope(outer *Environment, size int) *Environment {
+	return &Environment{store: make(map[string]Value, size), builtins: outer.builtins, outer: outer}
 }
 
 // Get retrieves a value from the environment
@@ -165,21 +480,26 @@ func (e *Environment) Get(name string) (Value, bool) {
 		return builtin, true
 	}
 
-	// Then check variables
-	obj, ok := e.store[name]
-	if !ok && e.outer != nil {
-		obj, ok = e.outer.Get(name)
+	// Then check variables, from the innermost scope outwards
+	for env := e; env != nil; env = env.outer {
+		if obj, ok := env.store[name]; ok {
+			return obj, true
+		}
 	}
-	return obj, ok
+	return nil, false
 }
 
 // Set sets a value in the environment
 func (e *Environment) Set(name string, val Value) error {
+	if owner := e.owner(name); owner != e {
+		return owner.Set(name, val)
+	}
+
 	// Check if a value with this name already exists and has a type
 	existingType, hasType := e.types[name]
 	if hasType {
 		// Validate that the new value is compatible with the type
-		if !types.IsAssignable(val.VibeType(), existingType) {
+		if !isAssignable(val, existingType) {
 			return fmt.Errorf("Type error: Cannot assign value of type %s to variable %s of type %s",
 				val.VibeType().String(), name, existingType.String())
 		}
@@ -189,14 +509,68 @@ func (e *Environment) Set(name string, val Value) error {
 	return nil
 }
 
+// owner finds the scope that an assignment to name in e stores it in. That's
+// e itself, unless e belongs to a block and name is already a variable of the
+// scope the block was defined in, as with sum in
+//
+//	[1, 2, 3].each do |x| sum += x end
+func (e *Environment) owner(name string) *Environment {
+	for env := e; ; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			return env
+		}
+		if !env.block {
+			return e
+		}
+	}
+}
+
+// declaredType returns the type a variable was declared with, looking in
+// enclosing scopes too. It reports false for a variable declared without one.
+func (e *Environment) declaredType(name string) (types.Type, bool) {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			typ, ok := env.types[name]
+			return typ, ok
+		}
+	}
+	return nil, false
+}
+
+// Names lists the variables defined in this scope, sorted. Variables of
+// enclosing scopes and builtins aren't included.
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Delete removes a variable, along with any type it was declared with, from
+// this scope. Variables of enclosing scopes and builtins are left alone. It
+// reports whether there was a variable to remove.
+func (e *Environment) Delete(name string) bool {
+	if _, ok := e.store[name]; !ok {
+		return false
+	}
+	delete(e.store, name)
+	delete(e.types, name)
+	return true
+}
+
 // SetWithType sets a value with a type annotation
 func (e *Environment) SetWithType(name string, val Value, typ types.Type) error {
 	// Validate that the value is compatible with the type
-	if !types.IsAssignable(val.VibeType(), typ) {
+	if !isAssignable(val, typ) {
 		return fmt.Errorf("Type error: Cannot assign value of type %s to variable %s of type %s",
 			val.VibeType().String(), name, typ.String())
 	}
 
+	if e.types == nil {
+		e.types = make(map[string]types.Type)
+	}
 	e.store[name] = val
 	e.types[name] = typ
 	return nil
@@ -204,10 +578,29 @@ func (e *Environment) SetWithType(name string, val Value, typ types.Type) error
 
 // RegisterBuiltin registers a built-in function
 func (e *Environment) RegisterBuiltin(name string, fn func(args []Value) Value, paramTypes []types.Type, returnType types.Type) {
+	e.RegisterBuiltinWithOptional(name, fn, paramTypes, len(paramTypes), returnType)
+}
+
+// RegisterBuiltinWithOptional registers a built-in function whose parameters
+// after the first required ones may be omitted
+func (e *Environment) RegisterBuiltinWithOptional(name string, fn func(args []Value) Value, paramTypes []types.Type, required int, returnType types.Type) {
 	e.builtins[name] = &BuiltinFunction{
 		Name:       name,
 		Fn:         fn,
 		ParamTypes: paramTypes,
+		MinArgs:    required,
+		ReturnType: returnType,
+	}
+}
+
+// RegisterVariadicBuiltin registers a built-in function that takes any
+// number of arguments, each of which must be of paramType
+func (e *Environment) RegisterVariadicBuiltin(name string, fn func(args []Value) Value, paramType types.Type, returnType types.Type) {
+	e.builtins[name] = &BuiltinFunction{
+		Name:       name,
+		Fn:         fn,
+		ParamTypes: []types.Type{paramType},
+		Variadic:   true,
 		ReturnType: returnType,
 	}
 }
@@ -217,10 +610,12 @@ type BuiltinFunction struct {
 	Name       string
 	Fn         func(args []Value) Value
 	ParamTypes []types.Type
+	MinArgs    int  // Arguments after MinArgs are optional
+	Variadic   bool // Any number of arguments, all of ParamTypes[0]
 	ReturnType types.Type
 }
 
-func (b *BuiltinFunction) Type() string { return "BUILTIN" }
+func (b *BuiltinFunction) Type() string { return BUILTIN_OBJ }
 func (b *BuiltinFunction) Inspect() string { return "builtin function: " + b.Name }
 func (b *BuiltinFunction) VibeType() types.Type {
 	return types.FunctionType{
@@ -234,11 +629,22 @@ func (b *BuiltinFunction) VibeType() types.Type {
 // ClassValue represents a class definition
 type ClassValue struct {
 	Name       string
+	Parent     *ClassValue // nil for a class without a parent
 	Methods    map[string]*FunctionValue
 	Properties map[string]Value
+	Fields     []ClassField
+	Env        *Environment // The scope the class was defined in, where field defaults are evaluated
+}
+
+// ClassField is an instance variable declared in a class body. Every new
+// instance evaluates Default afresh, so instances never share a default array or map.
+type ClassField struct {
+	Name    string
+	Type    types.Type
+	Default parser.Node // nil leaves the field nil
 }
 
-func (c *ClassValue) Type() string { return "CLASS" }
+func (c *ClassValue) Type() string { return CLASS_OBJ }
 func (c *ClassValue) Inspect() string { return fmt.Sprintf("class %s", c.Name) }
 func (c *ClassValue) VibeType() types.Type { return types.AnyType } // TODO: Create proper class type
 
@@ -248,94 +654,418 @@ type ObjectValue struct {
 	Properties map[string]Value
 }
 
-func (o *ObjectValue) Type() string { return "OBJECT" }
+func (o *ObjectValue) Type() string { return OBJECT_OBJ }
 func (o *ObjectValue) Inspect() string { return fmt.Sprintf("%s instance", o.Class.Name) }
 func (o *ObjectValue) VibeType() types.Type { return types.AnyType } // TODO: Create proper object type
 
+// IsA reports whether the object is an instance of the named class or of
+// a class that inherits from it
+func (o *ObjectValue) IsA(className string) bool {
+	for class := o.Class; class != nil; class = class.Parent {
+		if class.Name == className {
+			return true
+		}
+	}
+	return false
+}
+
 // Interpreter executes the AST
 type Interpreter struct {
-	env *Environment
+	env    *Environment
+	out    io.Writer
+	errOut io.Writer
+
+	// evalDepth counts the eval calls currently in progress
+	evalDepth int
+
+	// floatPrecision is the number of decimal places floats are displayed
+	// with, or -1 for the shortest form that round-trips
+	floatPrecision int
+
+	// callDepth counts the function calls currently in progress, and
+	// maxCallDepth is the limit past which a call fails with a stack overflow
+	callDepth    int
+	maxCallDepth int
+
+	// strictConditions makes if and while conditions that aren't booleans
+	// an error instead of being judged by truthiness
+	strictConditions bool
+
+	// strictArguments makes calling a function with fewer arguments than it
+	// has parameters an error instead of passing nil for the rest
+	strictArguments bool
+
+	// callerEnv is the scope of the call being applied, so builtins such as
+	// eval can work in the scope they were called from
+	callerEnv *Environment
+
+	// pos is where the statement most recently started begins, so a
+	// failure can be traced back to a line of the program
+	pos parser.Position
 }
 
+// DefaultMaxCallDepth is the recursion limit a new interpreter starts with
+const DefaultMaxCallDepth = 10000
+
+// maxEvalDepth bounds how deeply eval calls may nest, so that a string
+// which evals itself fails cleanly instead of recursing forever
+const maxEvalDepth = 64
+
 // New creates a new interpreter
 func New() *Interpreter {
 	env := NewEnvironment()
+	interp := &Interpreter{env: env, out: os.Stdout, errOut: os.Stderr, maxCallDepth: DefaultMaxCallDepth, floatPrecision: -1}
 
 	// Register built-in functions
 	registerBuiltins(env)
 	registerBuiltinClasses(env)
+	interp.registerFormatBuiltins(env)
+	interp.registerIteratorBuiltins(env)
+	interp.registerEvalBuiltins(env)
+
+	return interp
+}
+
+// RegisterFunction exposes a native Go function to Vibe code under the given name.
+// Calls are checked against paramTypes for arity and argument types, like any builtin.
+func (i *Interpreter) RegisterFunction(name string, fn func(args []Value) Value, paramTypes []types.Type, returnType types.Type) {
+	i.env.RegisterBuiltin(name, fn, paramTypes, returnType)
+}
+
+// SetStrictConditions sets whether if, elsif and while conditions must be
+// booleans. By default any value is allowed, and only false and nil are false.
+func (i *Interpreter) SetStrictConditions(strict bool) {
+	i.strictConditions = strict
+}
+
+// SetStrictArguments sets whether a function must be called with an argument
+// for every parameter. By default missing arguments are passed as nil.
+func (i *Interpreter) SetStrictArguments(strict bool) {
+	i.strictArguments = strict
+}
+
+// SetMaxCallDepth sets how deeply function calls may nest before evaluation
+// fails with a stack overflow error
+func (i *Interpreter) SetMaxCallDepth(depth int) {
+	i.maxCallDepth = depth
+}
+
+// SetFloatPrecision sets how many decimal places floats are printed and
+// converted to strings with. A negative value restores the default, the
+// shortest form that round-trips.
+func (i *Interpreter) SetFloatPrecision(digits int) {
+	i.floatPrecision = digits
+}
+
+// Display renders a value for output, honoring the float precision. Unlike
+// Inspect, whole floats print without a fraction by default (5.0 prints as 5).
+func (i *Interpreter) Display(value Value) string {
+	return formatValue(value, func(value Value) string {
+		if float, ok := value.(*FloatValue); ok {
+			return strconv.FormatFloat(float.Value, 'f', i.floatPrecision, 64)
+		}
+		return value.Inspect()
+	}, nil)
+}
+
+// nilArgumentError reports a builtin handed nil where it needs a value. Nil
+// usually means a missing map key or an unset result further up, so it gets
+// its own message rather than a generic type mismatch.
+func nilArgumentError(builtin string) *ErrorValue {
+	return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: %s: argument is nil", builtin)}
+}
+
+// registerFormatBuiltins registers builtins whose output depends on display settings
+func (i *Interpreter) registerFormatBuiltins(env *Environment) {
+	// to_string - converts a value to a string
+	env.RegisterBuiltin("to_string", func(args []Value) Value {
+		return &StringValue{Value: i.Display(args[0])}
+	}, []types.Type{types.AnyType}, types.StringType)
+
+	// write - prints its arguments one after another, formatted like print
+	// but without a trailing newline, so output can be built up piece by piece
+	env.RegisterVariadicBuiltin("write", func(args []Value) Value {
+		for _, arg := range args {
+			fmt.Fprint(i.out, i.Display(arg))
+		}
+		return Nil
+	}, types.AnyType, types.NilType)
+
+	// eprint - prints a value like puts, but to stderr, so diagnostics stay
+	// apart from a program's normal output. warn is another name for it.
+	eprint := func(args []Value) Value {
+		fmt.Fprintln(i.errOut, i.Display(args[0]))
+		return Nil
+	}
+	env.RegisterBuiltin("eprint", eprint, []types.Type{types.AnyType}, types.NilType)
+	env.RegisterBuiltin("warn", eprint, []types.Type{types.AnyType}, types.NilType)
+}
+
+// SetOutput redirects everything Vibe programs print to w
+func (i *Interpreter) SetOutput(w io.Writer) {
+	i.out = w
+}
+
+// SetErrorOutput redirects what Vibe programs print with eprint and warn to w
+func (i *Interpreter) SetErrorOutput(w io.Writer) {
+	i.errOut = w
+}
+
+// registerEvalBuiltins registers builtins that work with Vibe source at runtime
+func (i *Interpreter) registerEvalBuiltins(env *Environment) {
+	// eval - parses and evaluates a string of source in the scope it's called
+	// from, so the source can read and assign that scope's variables
+	env.RegisterBuiltin("eval", func(args []Value) Value {
+		source := args[0].(*StringValue)
+
+		if i.evalDepth >= maxEvalDepth {
+			return &ErrorValue{Kind: RuntimeError, Message: "Error: eval nested too deeply"}
+		}
+
+		program, errors := parser.Parse(lexer.New(source.Value))
+		if len(errors) > 0 {
+			return &ErrorValue{Kind: SyntaxError, Message: "Error: eval failed to parse: " + strings.Join(errors, "; ")}
+		}
+
+		i.evalDepth++
+		defer func() { i.evalDepth-- }()
+
+		scope := env
+		if i.callerEnv != nil {
+			scope = i.callerEnv
+		}
+		return i.evalProgram(program, scope)
+	}, []types.Type{types.StringType}, types.AnyType)
+
+	// quote - parses a string of source and returns its AST as Node objects.
+	// A single statement is returned directly; anything else as its Program.
+	env.RegisterBuiltin("quote", func(args []Value) Value {
+		source := args[0].(*StringValue)
+
+		program, errors := parser.Parse(lexer.New(source.Value))
+		if len(errors) > 0 {
+			return &ErrorValue{Kind: SyntaxError, Message: "Error: quote failed to parse: " + strings.Join(errors, "; ")}
+		}
+
+		if len(program.Statements) == 1 {
+			return quoteNode(program.Statements[0])
+		}
+		return quoteNode(program)
+	}, []types.Type{types.StringType}, types.AnyType)
+
+	// defined - reports whether a variable or function with the given name
+	// exists in the scope it's called from, even if it holds nil. Naming it
+	// in a string means an undefined name is never looked up as a variable.
+	env.RegisterBuiltin("defined", func(args []Value) Value {
+		name := args[0].(*StringValue)
+
+		scope := env
+		if i.callerEnv != nil {
+			scope = i.callerEnv
+		}
+		_, ok := scope.Get(name.Value)
+		return nativeBoolToBooleanObject(ok)
+	}, []types.Type{types.StringType}, types.BoolType)
+}
+
+// registerIteratorBuiltins registers builtins that call back into Vibe functions
+func (i *Interpreter) registerIteratorBuiltins(env *Environment) {
+	// sort - returns a new array ordered with <=>, so Comparable objects sort too
+	env.RegisterBuiltin("sort", func(args []Value) Value {
+		if _, ok := args[0].(*NilValue); ok {
+			return nilArgumentError("sort")
+		}
+
+		arr, ok := toArray(args[0])
+		if !ok {
+			return &ErrorValue{Kind: TypeError, Message: "Type error: sort requires an array argument"}
+		}
+
+		sorted := make([]Value, len(arr.Elements))
+		copy(sorted, arr.Elements)
+
+		var errVal Value
+		sort.SliceStable(sorted, func(a, b int) bool {
+			if errVal != nil {
+				return false
+			}
+			order, err := i.compareValues(sorted[a], sorted[b])
+			if err != nil {
+				errVal = err
+				return false
+			}
+			return order < 0
+		})
+		if errVal != nil {
+			return errVal
+		}
+
+		return &ArrayValue{Elements: sorted}
+	}, []types.Type{types.AnyType}, types.ArrayType{ElementType: types.AnyType})
+
+	// each - calls fn with every element of an array, character of a string
+	// or key of a map, returning the collection so calls can be chained
+	env.RegisterBuiltin("each", func(args []Value) Value {
+		if _, ok := args[0].(*NilValue); ok {
+			return nilArgumentError("each")
+		}
+
+		var elements []Value
+		if m, ok := args[0].(*MapValue); ok {
+			// Copied, so the callback can change the map as it goes
+			elements = append(elements, m.Keys...)
+		} else if arr, ok := toArray(args[0]); ok {
+			elements = arr.Elements
+		} else {
+			return &ErrorValue{Kind: TypeError, Message: "Type error: each requires an array, string or map as its first argument"}
+		}
+
+		for _, element := range elements {
+			result := i.applyFunction(args[1], []Value{element})
+			if isError(result) {
+				return result
+			}
+		}
+
+		return args[0]
+	}, []types.Type{types.AnyType, types.AnyType}, types.AnyType)
+
+	// map - calls fn with every element of an array, giving a new array of
+	// what it returns, so map([1, 2], double) is [2, 4]
+	env.RegisterBuiltin("map", func(args []Value) Value {
+		if _, ok := args[0].(*NilValue); ok {
+			return nilArgumentError("map")
+		}
+
+		arr, ok := toArray(args[0])
+		if !ok {
+			return &ErrorValue{Kind: TypeError, Message: "Type error: map requires an array as its first argument"}
+		}
+
+		mapped := make([]Value, len(arr.Elements))
+		for idx, element := range arr.Elements {
+			result := i.applyFunction(args[1], []Value{element})
+			if isError(result) {
+				return result
+			}
+			mapped[idx] = result
+		}
+
+		return &ArrayValue{Elements: mapped}
+	}, []types.Type{types.AnyType, types.AnyType}, types.ArrayType{ElementType: types.AnyType})
+
+	// each_with_index - calls fn with every element of an array and its index
+	env.RegisterBuiltin("each_with_index", func(args []Value) Value {
+		if _, ok := args[0].(*NilValue); ok {
+			return nilArgumentError("each_with_index")
+		}
+
+		arr, ok := toArray(args[0])
+		if !ok {
+			return &ErrorValue{Kind: TypeError, Message: "Type error: each_with_index requires an array as its first argument"}
+		}
+
+		for idx, element := range arr.Elements {
+			result := i.applyFunction(args[1], []Value{element, &IntegerValue{Value: idx}})
+			if isError(result) {
+				return result
+			}
+		}
+
+		return Nil
+	}, []types.Type{types.AnyType, types.AnyType}, types.NilType)
+
+	// times - calls fn with each index from 0 up to count, returning count.
+	// A count of zero or less doesn't call fn at all.
+	env.RegisterBuiltin("times", func(args []Value) Value {
+		count := args[0].(*IntegerValue)
+		for idx := 0; idx < count.Value; idx++ {
+			result := i.applyFunction(args[1], []Value{&IntegerValue{Value: idx}})
+			if isError(result) {
+				return result
+			}
+		}
 
-	return &Interpreter{env: env}
+		return count
+	}, []types.Type{types.IntType, types.AnyType}, types.IntType)
 }
 
 func registerBuiltins(env *Environment) {
 	// length - works on strings and arrays
 	env.RegisterBuiltin("len", func(args []Value) Value {
 		if len(args) != 1 {
-			return &StringValue{Value: "Type error: len takes exactly 1 argument"}
+			return &ErrorValue{Kind: ArgumentError, Message: "Type error: len takes exactly 1 argument"}
 		}
 
-		switch arg := args[0].(type) {
-		case *StringValue:
-			return &IntegerValue{Value: len(arg.Value)}
-		case *ArrayValue:
-			return &IntegerValue{Value: len(arg.Elements)}
-		default:
-			return &StringValue{Value: "Type error: len requires a string or array argument"}
+		if _, ok := args[0].(*NilValue); ok {
+			return nilArgumentError("len")
+		}
+
+		length, ok := lengthOf(args[0])
+		if !ok {
+			return &ErrorValue{Kind: TypeError, Message: "Type error: len requires a string, array or map argument"}
 		}
+		return &IntegerValue{Value: length}
 	}, []types.Type{types.AnyType}, types.IntType)
 
 	// type - returns the type of a value as a string
 	env.RegisterBuiltin("type", func(args []Value) Value {
 		if len(args) != 1 {
-			return &StringValue{Value: "Type error: type takes exactly 1 argument"}
+			return &ErrorValue{Kind: ArgumentError, Message: "Type error: type takes exactly 1 argument"}
 		}
 
 		return &StringValue{Value: args[0].VibeType().String()}
 	}, []types.Type{types.AnyType}, types.StringType)
 
-	// to_string - converts a value to a string
-	env.RegisterBuiltin("to_string", func(args []Value) Value {
-		if len(args) != 1 {
-			return &StringValue{Value: "Type error: to_string takes exactly 1 argument"}
+	// to_int - converts a value to an integer if possible. Strings may be
+	// given a base from 2 to 36 as a second argument, e.g. to_int("ff", 16).
+	env.RegisterBuiltinWithOptional("to_int", func(args []Value) Value {
+		if _, ok := args[0].(*NilValue); ok {
+			return nilArgumentError("to_int")
 		}
 
-		return &StringValue{Value: args[0].Inspect()}
-	}, []types.Type{types.AnyType}, types.StringType)
-
-	// to_int - converts a value to an integer if possible
-	env.RegisterBuiltin("to_int", func(args []Value) Value {
-		if len(args) != 1 {
-			return &StringValue{Value: "Type error: to_int takes exactly 1 argument"}
+		base := 10
+		if len(args) == 2 {
+			if _, ok := args[0].(*StringValue); !ok {
+				return &ErrorValue{Kind: ArgumentError, Message: "Type error: to_int only accepts a base when converting a string"}
+			}
+			base = args[1].(*IntegerValue).Value
+			if base < 2 || base > 36 {
+				return &ErrorValue{Kind: ArgumentError, Message: fmt.Sprintf("Error: invalid base %d, must be between 2 and 36", base)}
+			}
 		}
 
 		switch arg := args[0].(type) {
 		case *StringValue:
-			i, err := strconv.Atoi(arg.Value)
+			i, err := strconv.ParseInt(arg.Value, base, 64)
 			if err != nil {
-				return &StringValue{Value: "Type error: cannot convert string to int"}
+				return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: cannot convert string %q to int in base %d", arg.Value, base)}
 			}
-			return &IntegerValue{Value: i}
+			return &IntegerValue{Value: int(i)}
 		case *FloatValue:
 			return &IntegerValue{Value: int(arg.Value)}
 		case *IntegerValue:
 			return arg
 		default:
-			return &StringValue{Value: "Type error: cannot convert to int"}
+			return &ErrorValue{Kind: TypeError, Message: "Type error: cannot convert to int"}
 		}
-	}, []types.Type{types.AnyType}, types.IntType)
+	}, []types.Type{types.AnyType, types.IntType}, 1, types.IntType)
 
 	// to_float - converts a value to a float if possible
 	env.RegisterBuiltin("to_float", func(args []Value) Value {
 		if len(args) != 1 {
-			return &StringValue{Value: "Type error: to_float takes exactly 1 argument"}
+			return &ErrorValue{Kind: ArgumentError, Message: "Type error: to_float takes exactly 1 argument"}
+		}
+
+		if _, ok := args[0].(*NilValue); ok {
+			return nilArgumentError("to_float")
 		}
 
 		switch arg := args[0].(type) {
 		case *StringValue:
 			f, err := strconv.ParseFloat(arg.Value, 64)
 			if err != nil {
-				return &StringValue{Value: "Type error: cannot convert string to float"}
+				return &ErrorValue{Kind: TypeError, Message: "Type error: cannot convert string to float"}
 			}
 			return &FloatValue{Value: f}
 		case *IntegerValue:
@@ -343,37 +1073,264 @@ func registerBuiltins(env *Environment) {
 		case *FloatValue:
 			return arg
 		default:
-			return &StringValue{Value: "Type error: cannot convert to float"}
+			return &ErrorValue{Kind: TypeError, Message: "Type error: cannot convert to float"}
 		}
 	}, []types.Type{types.AnyType}, types.FloatType)
-}
-
-// Add this function to register built-in classes
-func registerBuiltinClasses(env *Environment) {
-	// Add Point class as a placeholder until proper class definition parsing is implemented
-	pointClass := &ClassValue{
-		Name:       "Point",
-		Methods:    make(map[string]*FunctionValue),
-		Properties: make(map[string]Value),
-	}
 
-	// Add get_x method
-	pointClass.Methods["get_x"] = &FunctionValue{
-		Name: "get_x",
+	// abs - the distance of a number from zero, keeping its int or float type
+	env.RegisterBuiltin("abs", func(args []Value) Value {
+		switch arg := args[0].(type) {
+		case *IntegerValue:
+			if arg.Value == math.MinInt {
+				return &ErrorValue{Kind: OverflowError, Message: fmt.Sprintf("Error: integer overflow in abs(%d)", arg.Value)}
+			}
+			if arg.Value < 0 {
+				return &IntegerValue{Value: -arg.Value}
+			}
+			return arg
+		case *FloatValue:
+			return &FloatValue{Value: math.Abs(arg.Value)}
+		case *NilValue:
+			return nilArgumentError("abs")
+		}
+		return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: abs expects a number, got %s", args[0].VibeType().String())}
+	}, []types.Type{types.AnyType}, types.AnyType)
+
+	// contains - reports whether an array holds a value, a string holds a
+	// substring, or a map holds a key
+	env.RegisterBuiltin("contains", func(args []Value) Value {
+		if _, ok := args[0].(*NilValue); ok {
+			return nilArgumentError("contains")
+		}
+		return containsValue("contains", args[0], args[1])
+	}, []types.Type{types.AnyType, types.AnyType}, types.BoolType)
+
+	// exit - stops the program with a status code, 0 unless one is given
+	env.RegisterBuiltinWithOptional("exit", func(args []Value) Value {
+		code := 0
+		if len(args) == 1 {
+			code = args[0].(*IntegerValue).Value
+		}
+		return &ExitValue{Code: code}
+	}, []types.Type{types.IntType}, 0, types.NilType)
+
+	// raise - fails with a RuntimeError carrying the message, which a
+	// rescue clause can handle like any other error
+	env.RegisterBuiltin("raise", func(args []Value) Value {
+		return &ErrorValue{Kind: RuntimeError, Message: "Error: " + args[0].(*StringValue).Value}
+	}, []types.Type{types.StringType}, types.NilType)
+
+	// panic - fails with an error that no rescue clause handles, for
+	// conditions the program can't carry on from
+	env.RegisterBuiltin("panic", func(args []Value) Value {
+		return &ErrorValue{Kind: RuntimeError, Message: "Panic: " + args[0].(*StringValue).Value, Fatal: true}
+	}, []types.Type{types.StringType}, types.NilType)
+
+	// to_array - converts a range, string or array to an array
+	env.RegisterBuiltin("to_array", func(args []Value) Value {
+		if len(args) != 1 {
+			return &ErrorValue{Kind: ArgumentError, Message: "Type error: to_array takes exactly 1 argument"}
+		}
+
+		if _, ok := args[0].(*NilValue); ok {
+			return nilArgumentError("to_array")
+		}
+
+		array, ok := toArray(args[0])
+		if !ok {
+			return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: cannot convert %s to array", args[0].VibeType().String())}
+		}
+		return array
+	}, []types.Type{types.AnyType}, types.ArrayType{ElementType: types.AnyType})
+
+	// slice - returns a new array holding the elements from start up to end,
+	// or to the end of the array when end is omitted
+	env.RegisterBuiltinWithOptional("slice", func(args []Value) Value {
+		if _, ok := args[0].(*NilValue); ok {
+			return nilArgumentError("slice")
+		}
+
+		array, ok := args[0].(*ArrayValue)
+		if !ok {
+			return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: slice requires an array, got %s", args[0].VibeType().String())}
+		}
+
+		start := args[1].(*IntegerValue)
+		var end *IntegerValue
+		if len(args) == 3 {
+			end = args[2].(*IntegerValue)
+		}
+
+		elements, errVal := sliceElements(array.Elements, start, end, nil)
+		if errVal != nil {
+			return errVal
+		}
+		return &ArrayValue{Elements: elements}
+	}, []types.Type{types.AnyType, types.IntType, types.IntType}, 2, types.ArrayType{ElementType: types.AnyType})
+
+	// head - returns the first element of an array, or nil when it's empty
+	env.RegisterBuiltin("head", func(args []Value) Value {
+		if _, ok := args[0].(*NilValue); ok {
+			return nilArgumentError("head")
+		}
+
+		array, ok := args[0].(*ArrayValue)
+		if !ok {
+			return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: head requires an array, got %s", args[0].VibeType().String())}
+		}
+		if len(array.Elements) == 0 {
+			return Nil
+		}
+		return array.Elements[0]
+	}, []types.Type{types.AnyType}, types.AnyType)
+
+	// tail - returns a new array of everything after the first element,
+	// which is empty for an empty array
+	env.RegisterBuiltin("tail", func(args []Value) Value {
+		if _, ok := args[0].(*NilValue); ok {
+			return nilArgumentError("tail")
+		}
+
+		array, ok := args[0].(*ArrayValue)
+		if !ok {
+			return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: tail requires an array, got %s", args[0].VibeType().String())}
+		}
+		if len(array.Elements) == 0 {
+			return &ArrayValue{Elements: []Value{}}
+		}
+		return &ArrayValue{Elements: append([]Value{}, array.Elements[1:]...)}
+	}, []types.Type{types.AnyType}, types.ArrayType{ElementType: types.AnyType})
+
+	// zip - pairs up the elements of arrays at the same index, so
+	// zip([1, 2], ["a", "b"]) is [[1, "a"], [2, "b"]]. Longer arrays are cut
+	// short to the length of the shortest.
+	env.RegisterVariadicBuiltin("zip", func(args []Value) Value {
+		result := []Value{}
+		if len(args) == 0 {
+			return &ArrayValue{Elements: result}
+		}
+
+		length := len(args[0].(*ArrayValue).Elements)
+		for _, arg := range args[1:] {
+			if n := len(arg.(*ArrayValue).Elements); n < length {
+				length = n
+			}
+		}
+
+		for idx := 0; idx < length; idx++ {
+			tuple := make([]Value, len(args))
+			for argIdx, arg := range args {
+				tuple[argIdx] = arg.(*ArrayValue).Elements[idx]
+			}
+			result = append(result, &ArrayValue{Elements: tuple})
+		}
+		return &ArrayValue{Elements: result}
+	}, types.ArrayType{ElementType: types.AnyType}, types.ArrayType{ElementType: types.AnyType})
+
+	// range - counts from start up to (but not including) end, moving step
+	// at a time, so range(0, 6, 2) is [0, 2, 4]. A negative step counts
+	// down instead: range(5, 0, -1) is [5, 4, 3, 2, 1].
+	env.RegisterBuiltinWithOptional("range", func(args []Value) Value {
+		start, end := args[0].(*IntegerValue).Value, args[1].(*IntegerValue).Value
+		step := 1
+		if len(args) == 3 {
+			step = args[2].(*IntegerValue).Value
+		}
+		if step == 0 {
+			return &ErrorValue{Kind: ArgumentError, Message: "Error: range step cannot be zero"}
+		}
+
+		// Near the limits of int, n += step could wrap around past end, so
+		// the loop stops once the distance left to end is no more than a
+		// step. Distances are unsigned, which holds any gap between ints.
+		elements := []Value{}
+		for n := start; (step > 0 && n < end) || (step < 0 && n > end); n += step {
+			elements = append(elements, &IntegerValue{Value: n})
+			if step > 0 && uint(end)-uint(n) <= uint(step) {
+				break
+			}
+			if step < 0 && uint(n)-uint(end) <= -uint(step) {
+				break
+			}
+		}
+		return &ArrayValue{Elements: elements}
+	}, []types.Type{types.IntType, types.IntType, types.IntType}, 2, types.ArrayType{ElementType: types.IntType})
+
+	// freeze - returns a frozen copy of an array or map, whose elements or
+	// keys can't be assigned. Only the collection itself is frozen, not any
+	// collections nested inside it.
+	env.RegisterBuiltin("freeze", func(args []Value) Value {
+		if _, ok := args[0].(*NilValue); ok {
+			return nilArgumentError("freeze")
+		}
+
+		switch collection := args[0].(type) {
+		case *ArrayValue:
+			return &ArrayValue{Elements: append([]Value{}, collection.Elements...), Frozen: true}
+		case *MapValue:
+			frozen := NewMapValue()
+			for _, key := range collection.Keys {
+				value, _, _ := collection.Get(key)
+				frozen.Set(key, value)
+			}
+			frozen.Frozen = true
+			return frozen
+		}
+		return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: freeze requires an array or map, got %s", args[0].VibeType().String())}
+	}, []types.Type{types.AnyType}, types.AnyType)
+
+	// is_a - reports whether a value is an instance of the named class or
+	// one of its subclasses. Values that aren't objects are never instances.
+	env.RegisterBuiltin("is_a", func(args []Value) Value {
+		className := args[1].(*StringValue).Value
+		obj, ok := args[0].(*ObjectValue)
+		return nativeBoolToBooleanObject(ok && obj.IsA(className))
+	}, []types.Type{types.AnyType, types.StringType}, types.BoolType)
+
+	// keys - returns the keys of a map in insertion order
+	env.RegisterBuiltin("keys", func(args []Value) Value {
+		m := args[0].(*MapValue)
+		return &ArrayValue{Elements: append([]Value{}, m.Keys...)}
+	}, []types.Type{types.MapType}, types.ArrayType{ElementType: types.AnyType})
+
+	// entries - returns the [key, value] pairs of a map in insertion order
+	env.RegisterBuiltin("entries", func(args []Value) Value {
+		m := args[0].(*MapValue)
+		pairs := make([]Value, 0, len(m.Keys))
+		for _, key := range m.Keys {
+			value, _, _ := m.Get(key)
+			pairs = append(pairs, &ArrayValue{Elements: []Value{key, value}})
+		}
+		return &ArrayValue{Elements: pairs}
+	}, []types.Type{types.MapType}, types.ArrayType{ElementType: types.ArrayType{ElementType: types.AnyType}})
+}
+
+// Add this function to register built-in classes
+func registerBuiltinClasses(env *Environment) {
+	// Add Point class as a placeholder until proper class definition parsing is implemented
+	pointClass := &ClassValue{
+		Name:       "Point",
+		Methods:    make(map[string]*FunctionValue),
+		Properties: make(map[string]Value),
+	}
+
+	// Add get_x method
+	pointClass.Methods["get_x"] = &FunctionValue{
+		Name: "get_x",
 		Body: nil, // Not using the body, will manually implement below
 		Env:  env,
 		BuiltinFunc: func(args []Value) Value {
 			if len(args) != 1 {
-				return &StringValue{Value: "Error: get_x requires object instance"}
+				return &ErrorValue{Kind: TypeError, Message: "Error: get_x requires object instance"}
 			}
 			obj, ok := args[0].(*ObjectValue)
 			if !ok {
-				return &StringValue{Value: "Error: get_x can only be called on Point objects"}
+				return &ErrorValue{Kind: TypeError, Message: "Error: get_x can only be called on Point objects"}
 			}
 			if x, ok := obj.Properties["x"]; ok {
 				return x
 			}
-			return &NilValue{}
+			return Nil
 		},
 	}
 
@@ -384,16 +1341,16 @@ func registerBuiltinClasses(env *Environment) {
 		Env:  env,
 		BuiltinFunc: func(args []Value) Value {
 			if len(args) != 1 {
-				return &StringValue{Value: "Error: get_y requires object instance"}
+				return &ErrorValue{Kind: TypeError, Message: "Error: get_y requires object instance"}
 			}
 			obj, ok := args[0].(*ObjectValue)
 			if !ok {
-				return &StringValue{Value: "Error: get_y can only be called on Point objects"}
+				return &ErrorValue{Kind: TypeError, Message: "Error: get_y can only be called on Point objects"}
 			}
 			if y, ok := obj.Properties["y"]; ok {
 				return y
 			}
-			return &NilValue{}
+			return Nil
 		},
 	}
 
@@ -405,6 +1362,44 @@ func (i *Interpreter) Eval(node parser.Node) Value {
 	return i.eval(node, i.env)
 }
 
+// Globals returns the top-level environment programs are run in
+func (i *Interpreter) Globals() *Environment {
+	return i.env
+}
+
+// Position returns where the statement most recently started by the
+// interpreter begins. After a failure it points at the statement that was
+// running.
+func (i *Interpreter) Position() parser.Position {
+	return i.pos
+}
+
+// ParseError reports the parser errors that prevented a program from running
+type ParseError struct {
+	Errors []string
+}
+
+func (e *ParseError) Error() string {
+	return "Parse error: " + strings.Join(e.Errors, "; ")
+}
+
+// Run lexes, parses and evaluates source in the interpreter's environment.
+// Parser errors are returned as a *ParseError, and a runtime error as its
+// *ErrorValue. A call to exit is returned as an *ExitValue.
+func (i *Interpreter) Run(source string) (Value, error) {
+	program, errors := parser.Parse(lexer.New(source))
+	if len(errors) > 0 {
+		return nil, &ParseError{Errors: errors}
+	}
+
+	result := i.Eval(program)
+	if errVal, ok := result.(*ErrorValue); ok {
+		return nil, errVal
+	}
+
+	return result, nil
+}
+
 func (i *Interpreter) eval(node parser.Node, env *Environment) Value {
 	switch node := node.(type) {
 	case *parser.Program:
@@ -413,31 +1408,55 @@ func (i *Interpreter) eval(node parser.Node, env *Environment) Value {
 		return i.evalBlockStatement(node, env)
 	case *parser.NumberLiteral:
 		if node.IsInt {
-			return &IntegerValue{Value: int(node.Value)}
+			return &IntegerValue{Value: int(node.Integer())}
 		}
 		return &FloatValue{Value: node.Value}
 	case *parser.StringLiteral:
 		return &StringValue{Value: node.Value}
 	case *parser.BooleanLiteral:
-		return &BooleanValue{Value: node.Value}
+		return nativeBoolToBooleanObject(node.Value)
 	case *parser.NilLiteral:
-		return &NilValue{}
+		return Nil
+	case *parser.SelfExpr:
+		if self, ok := env.Get("self"); ok {
+			return self
+		}
+		return &ErrorValue{Kind: NameError, Message: "Error: self used outside of a method"}
 	case *parser.Identifier:
 		return i.evalIdentifier(node, env)
 	case *parser.PrintStmt:
 		return i.evalPrintStatement(node, env)
 	case *parser.RequireStmt:
 		return i.evalRequireStatement(node, env)
+	case *parser.UnaryExpr:
+		return i.evalUnaryExpression(node, env)
+	case *parser.CastExpr:
+		return i.evalCastExpression(node, env)
+	case *parser.MacroDef:
+		return &ErrorValue{Kind: RuntimeError, Message: fmt.Sprintf("Error: macro '%s' must be defined at the top level", node.Name)}
+	case *parser.BreakStmt:
+		return &BreakValue{Label: node.Label}
+	case *parser.ContinueStmt:
+		return &ContinueValue{Label: node.Label}
+	case *parser.UndefStmt:
+		if !env.Delete(node.Name) {
+			return &ErrorValue{Kind: NameError, Message: fmt.Sprintf("Error: cannot undef '%s', which is not defined in this scope", node.Name)}
+		}
+		return Nil
 	case *parser.Assignment:
 		return i.evalAssignment(node, env)
 	case *parser.VariableDecl:
 		return i.evalVariableDeclaration(node, env)
 	case *parser.FunctionDef:
 		return i.evalFunctionDefinition(node, env)
+	case *parser.ClassDef:
+		return i.evalClassDefinition(node, env)
 	case *parser.CallExpr:
 		return i.evalCallExpression(node, env)
 	case *parser.MethodCall:
 		return i.evalMethodCall(node, env)
+	case *parser.DotExpr:
+		return i.evalDotExpression(node, env)
 	case *parser.ClassInst:
 		return i.evalClassInstantiation(node, env)
 	case *parser.ReturnStmt:
@@ -446,31 +1465,48 @@ func (i *Interpreter) eval(node parser.Node, env *Environment) Value {
 		return i.evalIfStatement(node, env)
 	case *parser.WhileStmt:
 		return i.evalWhileStatement(node, env)
+	case *parser.DoWhileStmt:
+		return i.evalDoWhileStatement(node, env)
+	case *parser.TryStmt:
+		return i.evalTryStatement(node, env)
 	case *parser.ForStmt:
 		return i.evalForStatement(node, env)
 	case *parser.BinaryExpr:
 		return i.evalBinaryExpression(node, env)
 	case *parser.ArrayLiteral:
 		return i.evalArrayLiteral(node, env)
+	case *parser.MapLiteral:
+		return i.evalMapLiteral(node, env)
+	case *parser.IndexExpr:
+		return i.evalIndexExpression(node, env)
+	case *parser.IndexAssignment:
+		return i.evalIndexAssignment(node, env)
+	case *parser.SliceExpr:
+		return i.evalSliceExpression(node, env)
+	case *parser.BlockLiteral:
+		return i.evalBlockLiteral(node, env)
 	case *parser.TypeAnnotation:
 		// Type annotations don't evaluate to a value on their own
-		return &NilValue{}
+		return Nil
 	case *parser.TypeDeclaration:
 		// Type declarations don't evaluate to a value
-		return &NilValue{}
+		return Nil
 	default:
 		// Handle unexpected nodes
-		return &StringValue{Value: fmt.Sprintf("Unknown node type: %T : %s", node, node.Type())}
+		return &ErrorValue{Kind: RuntimeError, Message: fmt.Sprintf("Unknown node type: %T : %s", node, node.Type())}
 	}
 }
 
 func (i *Interpreter) evalVariableDeclaration(node *parser.VariableDecl, env *Environment) Value {
 	var value Value
 	if node.Value != nil {
-		value = i.eval(node.Value, env)
+		value = i.evalStoredValue(node.Value, env)
+		if isError(value) {
+			return value
+		}
 	} else {
 		// If no value is provided, initialize with nil
-		value = &NilValue{}
+		value = Nil
 	}
 
 	if node.TypeAnnotation != nil {
@@ -478,87 +1514,95 @@ func (i *Interpreter) evalVariableDeclaration(node *parser.VariableDecl, env *En
 		varType := i.parseTypeAnnotation(node.TypeAnnotation)
 
 		// Check that the value is compatible with the declared type
-		if !types.IsAssignable(value.VibeType(), varType) {
-			return &StringValue{Value: fmt.Sprintf("Type error: Cannot assign value of type %s to variable of type %s",
+		if !isAssignable(value, varType) {
+			return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: Cannot assign value of type %s to variable of type %s",
 				value.VibeType().String(), varType.String())}
 		}
 
 		// Set with type check
 		err := env.SetWithType(node.Name, value, varType)
 		if err != nil {
-			return &StringValue{Value: err.Error()}
+			return &ErrorValue{Kind: TypeError, Message: err.Error()}
 		}
 	} else {
 		// No type annotation, infer from the value
 		err := env.Set(node.Name, value)
 		if err != nil {
-			return &StringValue{Value: err.Error()}
+			return &ErrorValue{Kind: TypeError, Message: err.Error()}
 		}
 	}
 
-	return &NilValue{}
+	return Nil
 }
 
 func (i *Interpreter) parseTypeAnnotation(node *parser.TypeAnnotation) types.Type {
-	switch node.TypeName {
-	case "int":
-		return types.IntType
-	case "float":
-		return types.FloatType
-	case "string":
-		return types.StringType
-	case "bool":
-		return types.BoolType
-	case "any":
-		return types.AnyType
-	case "Array":
-		if len(node.TypeParams) > 0 {
-			elemType := i.parseTypeAnnotation(node.TypeParams[0].(*parser.TypeAnnotation))
-			return types.ArrayType{ElementType: elemType}
-		}
-		// Default to Array of any
-		return types.ArrayType{ElementType: types.AnyType}
-	case "union":
-		if len(node.TypeParams) > 0 {
-			var unionTypes []types.Type
-			for _, param := range node.TypeParams {
-				unionTypes = append(unionTypes, i.parseTypeAnnotation(param.(*parser.TypeAnnotation)))
-			}
-			return types.UnionType{Types: unionTypes}
-		}
-		// Invalid union type
-		return types.AnyType
-	default:
-		// Unknown type, default to any
-		return types.AnyType
-	}
+	return types.FromAnnotation(node)
 }
 
 func (i *Interpreter) evalProgram(program *parser.Program, env *Environment) Value {
+	program, errVal := i.expandMacros(program)
+	if errVal != nil {
+		return errVal
+	}
+	i.hoistDefinitions(program, env)
+
 	var result Value
-	result = &NilValue{}
+	result = Nil
 
 	for _, statement := range program.Statements {
+		i.pos = statement.Pos()
 		result = i.eval(statement, env)
 
 		// If we hit a return statement, unwrap it and return the value
 		if returnValue, ok := result.(*ReturnValue); ok {
 			return returnValue.Value
 		}
+
+		// A runtime error stops the program
+		if isError(result) {
+			return result
+		}
+
+		// Loop control that escaped every loop has nothing to target
+		if errVal := strayLoopControl(result); errVal != nil {
+			return errVal
+		}
 	}
 
 	return result
 }
 
+// hoistDefinitions binds the program's top-level functions and classes
+// before any statement runs, so they can be used above their definitions.
+// Only the first definition of a name that isn't bound yet is hoisted; the
+// definitions still run in order, so a later one replaces it when reached.
+// A class whose parent comes after it isn't hoisted.
+func (i *Interpreter) hoistDefinitions(program *parser.Program, env *Environment) {
+	for _, statement := range program.Statements {
+		switch def := statement.(type) {
+		case *parser.FunctionDef:
+			if _, bound := env.Get(def.Name); !bound {
+				i.evalFunctionDefinition(def, env)
+			}
+		case *parser.ClassDef:
+			if _, bound := env.Get(def.Name); !bound {
+				i.evalClassDefinition(def, env)
+			}
+		}
+	}
+}
+
 func (i *Interpreter) evalBlockStatement(block *parser.BlockStmt, env *Environment) Value {
 	var result Value
-	result = &NilValue{}
+	result = Nil
 
 	for _, statement := range block.Statements {
+		i.pos = statement.Pos()
 		result = i.eval(statement, env)
 
-		// If we hit a return statement, break execution and return it up
-		if result.Type() == "RETURN" {
+		// If we hit a return statement, an error, or loop control, break execution and return it up
+		switch result.Type() {
+		case RETURN_OBJ, ERROR_OBJ, BREAK_OBJ, CONTINUE_OBJ, EXIT_OBJ:
 			return result
 		}
 	}
@@ -570,8 +1614,8 @@ func (i *Interpreter) evalBlockStatement(block *parser.BlockStmt, env *Environme
 		switch lastStmt.(type) {
 		case *parser.Assignment, *parser.VariableDecl, *parser.PrintStmt, *parser.TypeDeclaration:
 			// These statements don't produce a value to return
-			return &NilValue{}
-		case *parser.IfStmt, *parser.WhileStmt, *parser.FunctionDef:
+			return Nil
+		case *parser.IfStmt, *parser.WhileStmt, *parser.DoWhileStmt, *parser.FunctionDef:
 			// Control flow statements are handled separately
 			return result
 		default:
@@ -584,16 +1628,22 @@ func (i *Interpreter) evalBlockStatement(block *parser.BlockStmt, env *Environme
 }
 
 func (i *Interpreter) evalIdentifier(node *parser.Identifier, env *Environment) Value {
+	if strings.HasPrefix(node.Name, "@") {
+		return i.evalInstanceVariable(strings.TrimPrefix(node.Name, "@"), env)
+	}
 	if val, ok := env.Get(node.Name); ok {
 		return val
 	}
 
-	return &StringValue{Value: fmt.Sprintf("Error: variable '%s' not found", node.Name)}
+	return &ErrorValue{Kind: NameError, Message: fmt.Sprintf("Error: variable '%s' not found", node.Name)}
 }
 
 func (i *Interpreter) evalPrintStatement(node *parser.PrintStmt, env *Environment) Value {
 	value := i.eval(node.Value, env)
-	fmt.Println(value.Inspect())
+	if isError(value) {
+		return value
+	}
+	fmt.Fprintln(i.out, i.Display(value))
 	return value
 }
 
@@ -626,7 +1676,7 @@ func (i *Interpreter) evalRequireStatement(node *parser.RequireStmt, env *Enviro
 		fmt.Println(errMsg)
 		// Return a special error value that will cause the interpreter to stop execution
 		os.Exit(1) // This will terminate the program immediately
-		return &StringValue{Value: errMsg}
+		return &ErrorValue{Kind: RuntimeError, Message: errMsg}
 	}
 
 	// Create a lexer from the source code
@@ -656,21 +1706,38 @@ func (i *Interpreter) evalRequireStatement(node *parser.RequireStmt, env *Enviro
 		fmt.Printf("DEBUG: %s = %s\n", name, value.Inspect())
 	}
 
-	return &NilValue{}
+	return Nil
 }
 
 func (i *Interpreter) evalAssignment(node *parser.Assignment, env *Environment) Value {
-	val := i.eval(node.Value, env)
+	val := i.evalStoredValue(node.Value, env)
+	if isError(val) {
+		return val
+	}
+
+	if strings.HasPrefix(node.Name, "@") {
+		return i.assignInstanceVariable(strings.TrimPrefix(node.Name, "@"), val, env)
+	}
 
 	err := env.Set(node.Name, val)
 	if err != nil {
-		return &StringValue{Value: err.Error()}
+		return &ErrorValue{Kind: TypeError, Message: err.Error()}
 	}
 
-	return &NilValue{}
+	return Nil
 }
 
 func (i *Interpreter) evalFunctionDefinition(node *parser.FunctionDef, env *Environment) Value {
+	function := i.newFunctionValue(node, env)
+
+	// Add the function to the environment
+	env.SetWithType(node.Name, function, function.VibeType())
+
+	return Nil
+}
+
+// newFunctionValue makes the function a definition describes, closing over env
+func (i *Interpreter) newFunctionValue(node *parser.FunctionDef, env *Environment) *FunctionValue {
 	// Parse return type
 	var returnType types.Type
 	if node.ReturnType != nil {
@@ -680,120 +1747,284 @@ func (i *Interpreter) evalFunctionDefinition(node *parser.FunctionDef, env *Envi
 	}
 
 	// Create the function value with parameter types properly processed
-	function := &FunctionValue{
+	return &FunctionValue{
 		Name:           node.Name,
 		Parameters:     node.Parameters, // Use the original parameters
 		Body:           node.Body,
 		ReturnType:     returnType,
 		Env:            env,
 	}
+}
 
-	// Add the function to the environment
-	env.SetWithType(node.Name, function, function.VibeType())
+// evalClassDefinition binds a class to its name. A parent must already be
+// defined; its fields come before the class's own in each new instance.
+func (i *Interpreter) evalClassDefinition(node *parser.ClassDef, env *Environment) Value {
+	class := &ClassValue{
+		Name:       node.Name,
+		Methods:    make(map[string]*FunctionValue),
+		Properties: make(map[string]Value),
+		Env:        env,
+	}
+
+	if node.Parent != "" {
+		parentVal, ok := env.Get(node.Parent)
+		parent, isClass := parentVal.(*ClassValue)
+		if !ok || !isClass {
+			return &ErrorValue{Kind: NameError, Message: fmt.Sprintf("Error: parent class %s of %s is not defined", node.Parent, node.Name)}
+		}
+		class.Parent = parent
+	}
+
+	for _, field := range node.Fields {
+		var fieldType types.Type = types.AnyType
+		if field.Type != nil {
+			fieldType = i.parseTypeAnnotation(field.Type)
+		}
+		class.Fields = append(class.Fields, ClassField{Name: field.Name, Type: fieldType, Default: field.Default})
+	}
+
+	for _, method := range node.Methods {
+		if def, ok := method.(*parser.FunctionDef); ok {
+			class.Methods[def.Name] = i.newFunctionValue(def, env)
+		}
+	}
+
+	env.Set(node.Name, class)
+	return Nil
+}
+
+// initializeFields gives a new instance the default value of every field its
+// class and ancestors declare, checking each against the field's type
+func (i *Interpreter) initializeFields(obj *ObjectValue, class *ClassValue) Value {
+	if class.Parent != nil {
+		if errVal := i.initializeFields(obj, class.Parent); errVal != nil {
+			return errVal
+		}
+	}
+
+	for _, field := range class.Fields {
+		var value Value = Nil
+		if field.Default != nil {
+			value = i.eval(field.Default, class.Env)
+			if isError(value) {
+				return value
+			}
+			if !isAssignable(value, field.Type) {
+				return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf(
+					"Type error: field @%s of class %s expects %s, got %s",
+					field.Name, class.Name, field.Type.String(), value.VibeType().String())}
+			}
+		}
+		obj.Properties[field.Name] = value
+	}
+
+	return nil
+}
 
-	return &NilValue{}
+// evalStoredValue evaluates node where its value is kept rather than used
+// straight away: an element of an array or map literal, or the value of an
+// assignment. There the bare name of a function refers to the function even
+// when it takes no arguments, so {"click": on_click} stores on_click
+// instead of calling it.
+func (i *Interpreter) evalStoredValue(node parser.Node, env *Environment) Value {
+	if call, ok := node.(*parser.CallExpr); ok && call.Bare {
+		return i.eval(call.Function, env)
+	}
+	return i.eval(node, env)
 }
 
 func (i *Interpreter) evalCallExpression(node *parser.CallExpr, env *Environment) Value {
 	function := i.eval(node.Function, env)
+	if isError(function) {
+		return function
+	}
+
+	// The parser can't tell a bare identifier from a parentheses-free call,
+	// so a non-callable value with no arguments is just that value. A bare
+	// function name is a call only when the function takes no arguments;
+	// otherwise it refers to the function, so it can be stored and passed.
+	if len(node.Args) == 0 {
+		switch function := function.(type) {
+		case *FunctionValue:
+			if node.Bare && len(function.Parameters) > 0 {
+				return function
+			}
+		case *BuiltinFunction:
+			if node.Bare && function.MinArgs > 0 {
+				return function
+			}
+		default:
+			return function
+		}
+	}
+
 	args := i.evalExpressions(node.Args, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
 
+	outer := i.callerEnv
+	i.callerEnv = env
+	defer func() { i.callerEnv = outer }()
+
+	return i.applyFunction(function, args)
+}
+
+// applyFunction calls a user-defined or builtin function with evaluated arguments
+func (i *Interpreter) applyFunction(function Value, args []Value) Value {
 	if fn, ok := function.(*FunctionValue); ok {
-		// Check arity
-		if len(args) > len(fn.Parameters) {
-			return &StringValue{Value: fmt.Sprintf(
+		// Check arity. Missing arguments are nil unless they're required.
+		if len(args) > len(fn.Parameters) || (i.strictArguments && len(args) < len(fn.Parameters)) {
+			return &ErrorValue{Kind: ArgumentError, Message: fmt.Sprintf(
 				"Wrong number of arguments: function '%s' expects %d, got %d",
 				fn.Name, len(fn.Parameters), len(args))}
 		}
 
+		// Fail cleanly on runaway recursion rather than overflowing the Go stack
+		if i.callDepth >= i.maxCallDepth {
+			return &ErrorValue{Kind: RuntimeError, Message: "Error: stack overflow: maximum recursion depth exceeded"}
+		}
+		i.callDepth++
+		defer func() { i.callDepth-- }()
+
 		// Create a new environment for the function
-		newEnv := NewEnclosedEnvironment(fn.Env)
+		newEnv := newScope(fn.Env, len(fn.Parameters))
+		newEnv.block = fn.block
 
 		// Bind arguments to parameters
-		for paramIdx, param := range fn.Parameters {
+		for paramIdx, paramType := range fn.parameterTypes() {
+			param := fn.Parameters[paramIdx]
+
+			// Missing argument, use nil
+			var arg Value = Nil
 			if paramIdx < len(args) {
-				// Get the parameter type from the TypeAnnotation
-				var paramType types.Type
-				if param.Type != nil {
-					paramType = i.parseTypeAnnotation(param.Type)
-				} else {
-					paramType = types.AnyType
-				}
+				arg = arrayArgument(args[paramIdx], paramType)
 
 				// Type check the argument
-				if !types.IsAssignable(args[paramIdx].VibeType(), paramType) {
-					return &StringValue{Value: fmt.Sprintf(
+				if !isAssignable(arg, paramType) {
+					return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf(
 						"Type error: Parameter '%s' of function '%s' expects %s, got %s",
-						param.Name, fn.Name, paramType.String(), args[paramIdx].VibeType().String())}
+						param.Name, fn.Name, paramType.String(), arg.VibeType().String())}
 				}
+			}
 
-				// Bind the parameter
-				newEnv.SetWithType(param.Name, args[paramIdx], paramType)
+			// Bind the parameter. Any value can be assigned to an untyped
+			// one later, so it needs no recorded type.
+			if paramType == types.AnyType {
+				newEnv.store[param.Name] = arg
 			} else {
-				// Missing argument, use nil
-				var paramType types.Type
-				if param.Type != nil {
-					paramType = i.parseTypeAnnotation(param.Type)
-				} else {
-					paramType = types.AnyType
-				}
-				newEnv.SetWithType(param.Name, &NilValue{}, paramType)
+				newEnv.SetWithType(param.Name, arg, paramType)
 			}
 		}
 
 		// Evaluate the function body
 		result := i.evalBlockStatement(fn.Body, newEnv)
+		if isError(result) {
+			return result
+		}
+		if errVal := strayLoopControl(result); errVal != nil {
+			return errVal
+		}
 
 		// Unwrap return value, if necessary
 		if returnValue, ok := result.(*ReturnValue); ok {
+			if fn.ReturnType == types.VoidType && returnValue.Value.Type() != NIL_OBJ {
+				return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf(
+					"Type error: Function '%s' is void but returns %s",
+					fn.Name, returnValue.Value.VibeType().String())}
+			}
+
 			// Type check the return value
-			if !types.IsAssignable(returnValue.Value.VibeType(), fn.ReturnType) {
-				return &StringValue{Value: fmt.Sprintf(
+			if !isAssignable(returnValue.Value, fn.ReturnType) {
+				return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf(
 					"Type error: Function '%s' returns %s, got %s",
 					fn.Name, fn.ReturnType.String(), returnValue.Value.VibeType().String())}
 			}
 			return returnValue.Value
 		}
 
-		// Type check the return value
-		if !types.IsAssignable(result.VibeType(), fn.ReturnType) {
-			return &StringValue{Value: fmt.Sprintf(
+		// A void function's last statement is run for its effect, not its value
+		if fn.ReturnType == types.VoidType {
+			return Nil
+		}
+
+		// A body that ends without producing a value of the declared type,
+		// such as one ending in an assignment, fails here
+		if !isAssignable(result, fn.ReturnType) {
+			return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf(
 				"Type error: Function '%s' returns %s, got %s",
 				fn.Name, fn.ReturnType.String(), result.VibeType().String())}
 		}
 
 		return result
 	} else if builtin, ok := function.(*BuiltinFunction); ok {
+		paramTypes := builtin.ParamTypes
+		if builtin.Variadic {
+			paramTypes = make([]types.Type, len(args))
+			for idx := range paramTypes {
+				paramTypes[idx] = builtin.ParamTypes[0]
+			}
+		}
+
 		// Check arity
-		if len(args) != len(builtin.ParamTypes) {
-			return &StringValue{Value: fmt.Sprintf(
-				"Wrong number of arguments: function '%s' expects %d, got %d",
-				builtin.Name, len(builtin.ParamTypes), len(args))}
+		if !builtin.Variadic && (len(args) < builtin.MinArgs || len(args) > len(builtin.ParamTypes)) {
+			expected := strconv.Itoa(len(builtin.ParamTypes))
+			if builtin.MinArgs < len(builtin.ParamTypes) {
+				expected = fmt.Sprintf("%d to %d", builtin.MinArgs, len(builtin.ParamTypes))
+			}
+			return &ErrorValue{Kind: ArgumentError, Message: fmt.Sprintf(
+				"Wrong number of arguments: function '%s' expects %s, got %d",
+				builtin.Name, expected, len(args))}
 		}
 
 		// Type check arguments
 		for i, arg := range args {
-			if !types.IsAssignable(arg.VibeType(), builtin.ParamTypes[i]) {
-				return &StringValue{Value: fmt.Sprintf(
+			if _, ok := arg.(*NilValue); ok && paramTypes[i] != types.AnyType {
+				if len(paramTypes) == 1 {
+					return nilArgumentError(builtin.Name)
+				}
+				return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf(
+					"Type error: %s: argument %d is nil", builtin.Name, i+1)}
+			}
+
+			arg = arrayArgument(arg, paramTypes[i])
+			args[i] = arg
+			if !isAssignable(arg, paramTypes[i]) {
+				return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf(
 					"Type error: Parameter %d of builtin function '%s' expects %s, got %s",
-					i, builtin.Name, builtin.ParamTypes[i].String(), arg.VibeType().String())}
+					i, builtin.Name, paramTypes[i].String(), arg.VibeType().String())}
 			}
 		}
 
 		return builtin.Fn(args)
 	}
 
-	return &StringValue{Value: fmt.Sprintf("Not a function: %s", function.Type())}
+	return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Not a function: %s", function.Type())}
+}
+
+// evalBlockLiteral turns a do/end block into a function closing over the current scope
+func (i *Interpreter) evalBlockLiteral(node *parser.BlockLiteral, env *Environment) Value {
+	return &FunctionValue{
+		Name:       "block",
+		Parameters: node.Parameters,
+		Body:       node.Body,
+		ReturnType: types.AnyType,
+		Env:        env,
+		block:      true,
+	}
 }
 
 func (i *Interpreter) evalExpressions(
 	exps []parser.Node,
 	env *Environment,
 ) []Value {
-	var result []Value
+	result := make([]Value, 0, len(exps))
 
 	for _, exp := range exps {
 		evaluated := i.eval(exp, env)
+		if isError(evaluated) {
+			return []Value{evaluated}
+		}
 		result = append(result, evaluated)
 	}
 
@@ -805,8 +2036,11 @@ func (i *Interpreter) evalReturnStatement(node *parser.ReturnStmt, env *Environm
 
 	if node.Value != nil {
 		value = i.eval(node.Value, env)
+		if isError(value) {
+			return value
+		}
 	} else {
-		value = &NilValue{}
+		value = Nil
 	}
 
 	return &ReturnValue{Value: value}
@@ -816,14 +2050,22 @@ func (i *Interpreter) evalIfStatement(node *parser.IfStmt, env *Environment) Val
 	condition := i.eval(node.Condition, env)
 
 	// Check if the condition is true
-	if isTruthy(condition) {
+	holds, errVal := i.conditionHolds(condition, "if")
+	if errVal != nil {
+		return errVal
+	}
+	if holds {
 		return i.eval(node.Consequence, env)
 	}
 
 	// Check elsif branches
 	for _, elseIf := range node.ElseIfBlocks {
 		elseIfCondition := i.eval(elseIf.Condition, env)
-		if isTruthy(elseIfCondition) {
+		holds, errVal := i.conditionHolds(elseIfCondition, "elsif")
+		if errVal != nil {
+			return errVal
+		}
+		if holds {
 			return i.eval(elseIf.Consequence, env)
 		}
 	}
@@ -833,31 +2075,148 @@ func (i *Interpreter) evalIfStatement(node *parser.IfStmt, env *Environment) Val
 		return i.eval(node.Alternative, env)
 	}
 
-	return &NilValue{}
+	return Nil
+}
+
+// evalTryStatement evaluates the try body and hands an error it raises to
+// the first rescue clause whose kind matches. An error no clause matches
+// carries on unwinding, as do panics, exit and the loop and return signals.
+func (i *Interpreter) evalTryStatement(node *parser.TryStmt, env *Environment) Value {
+	result := i.eval(node.Body, env)
+	errVal, ok := result.(*ErrorValue)
+	if !ok || errVal.Fatal {
+		return result
+	}
+
+	for _, rescue := range node.Rescues {
+		if rescue.Kind != "" {
+			if !isErrorKind(rescue.Kind) {
+				return &ErrorValue{Kind: NameError, Message: fmt.Sprintf("Error: unknown error kind '%s' in rescue", rescue.Kind)}
+			}
+			if ErrorKind(rescue.Kind) != errVal.Kind {
+				continue
+			}
+		}
+
+		if rescue.Variable != "" {
+			details := NewMapValue()
+			details.Set(&StringValue{Value: "kind"}, &StringValue{Value: string(errVal.Kind)})
+			details.Set(&StringValue{Value: "message"}, &StringValue{Value: errVal.Message})
+			env.Set(rescue.Variable, details)
+		}
+		return i.eval(rescue.Body, env)
+	}
+
+	return errVal
 }
 
 func (i *Interpreter) evalWhileStatement(node *parser.WhileStmt, env *Environment) Value {
+	var last Value = Nil
 	for {
 		condition := i.eval(node.Condition, env)
-		if !isTruthy(condition) {
+		holds, errVal := i.conditionHolds(condition, "while")
+		if errVal != nil {
+			return errVal
+		}
+		if !holds {
 			break
 		}
 
 		result := i.eval(node.Body, env)
-		if returnValue, ok := result.(*ReturnValue); ok {
-			return returnValue
+		stop, value := loopSignal(result, node.Label, last)
+		if stop {
+			return value
 		}
+		last = value
 	}
 
-	return &NilValue{}
+	return last
 }
 
-func (i *Interpreter) evalForStatement(node *parser.ForStmt, env *Environment) Value {
-	// Evaluate the iterable expression
-	iterable := i.eval(node.Iterable, env)
+// evalDoWhileStatement runs the body once before checking the condition,
+// then again for as long as it holds. A continue skips to the check.
+func (i *Interpreter) evalDoWhileStatement(node *parser.DoWhileStmt, env *Environment) Value {
+	var last Value = Nil
+	for {
+		result := i.eval(node.Body, env)
+		stop, value := loopSignal(result, "", last)
+		if stop {
+			return value
+		}
+		last = value
+
+		condition := i.eval(node.Condition, env)
+		holds, errVal := i.conditionHolds(condition, "while")
+		if errVal != nil {
+			return errVal
+		}
+		if !holds {
+			return last
+		}
+	}
+}
+
+// conditionHolds decides whether the condition of an if, elsif or while
+// (named by keyword) is true, returning an error value instead if evaluating
+// it failed or, in strict mode, if it isn't a boolean
+func (i *Interpreter) conditionHolds(condition Value, keyword string) (bool, Value) {
+	if isError(condition) {
+		return false, condition
+	}
+	if i.strictConditions && condition.Type() != BOOLEAN_OBJ {
+		return false, &ErrorValue{Kind: TypeError, Message: fmt.Sprintf(
+			"Type error: %s condition must be a bool, got %s", keyword, condition.VibeType().String())}
+	}
+	return isTruthy(condition), nil
+}
+
+// loopSignal interprets a loop body's result for the loop with the given label,
+// given last, the loop's value so far. It reports whether the loop must stop
+// and what the loop evaluates to: a loop's value is that of its last iteration
+// to run to completion, or nil if it was ended with break. Returns and errors
+// propagate unchanged, as does a break or continue aimed at a different
+// (enclosing) loop.
+func loopSignal(result Value, label string, last Value) (bool, Value) {
+	switch result := result.(type) {
+	case *ReturnValue, *ErrorValue, *ExitValue:
+		return true, result
+	case *BreakValue:
+		if result.Label == "" || result.Label == label {
+			return true, Nil
+		}
+		return true, result
+	case *ContinueValue:
+		if result.Label == "" || result.Label == label {
+			return false, last
+		}
+		return true, result
+	}
+	return false, result
+}
+
+// strayLoopControl turns a break or continue that escaped every loop into an error
+func strayLoopControl(result Value) Value {
+	var keyword, label string
+	switch result := result.(type) {
+	case *BreakValue:
+		keyword, label = "break", result.Label
+	case *ContinueValue:
+		keyword, label = "continue", result.Label
+	default:
+		return nil
+	}
+
+	if label != "" {
+		return &ErrorValue{Kind: RuntimeError, Message: fmt.Sprintf("Error: %s %s: no enclosing loop labeled '%s'", keyword, label, label)}
+	}
+	return &ErrorValue{Kind: RuntimeError, Message: fmt.Sprintf("Error: %s outside of a loop", keyword)}
+}
 
-	// Create a new environment for the loop
-	loopEnv := NewEnclosedEnvironment(env)
+func (i *Interpreter) evalForStatement(node *parser.ForStmt, env *Environment) Value {
+	// Like while, a for loop shares the surrounding scope (as in Ruby), so
+	// assignments in the body and the iterator stay visible after the loop
+	loopEnv := env
+	var last Value = Nil
 
 	// Special case for range expressions (e.g., for i in 0..5)
 	if binExpr, ok := node.Iterable.(*parser.BinaryExpr); ok && binExpr.Operator == ".." {
@@ -873,21 +2232,60 @@ func (i *Interpreter) evalForStatement(node *parser.ForStmt, env *Environment) V
 			// Iterate through the range (inclusive)
 			for idx := startInt.Value; idx <= endInt.Value; idx++ {
 				// Set the iterator variable
-				loopEnv.Set(node.Iterator, &IntegerValue{Value: idx})
+				if errVal := setLoopVariable(loopEnv, node.Iterator, &IntegerValue{Value: idx}); errVal != nil {
+					return errVal
+				}
 
 				// Execute the loop body
 				result := i.eval(node.Body, loopEnv)
 
-				// Handle return statements inside the loop
-				if returnValue, ok := result.(*ReturnValue); ok {
-					return returnValue
+				// Stop on return, error, or break, and skip ahead on continue
+				stop, value := loopSignal(result, node.Label, last)
+				if stop {
+					return value
+				}
+				last = value
+
+				// As in toArray, stepping past the largest int would wrap
+				if idx == endInt.Value {
+					break
 				}
 			}
-			return &NilValue{}
+			return last
 		}
 
 		// If the range bounds aren't integers, report an error
-		return &StringValue{Value: "Type error: range bounds must be integers"}
+		return &ErrorValue{Kind: TypeError, Message: "Type error: range bounds must be integers"}
+	}
+
+	// Evaluate the iterable expression
+	iterable := i.eval(node.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	// Objects are Iterable when their class defines iter, which returns what
+	// to iterate over in their place, or next (see evalObjectIteration)
+	if obj, ok := iterable.(*ObjectValue); ok {
+		if method, ok := obj.Class.Methods["iter"]; ok {
+			iterable = i.callMethod(obj, method, []Value{})
+			if isError(iterable) {
+				return iterable
+			}
+		}
+	}
+	if obj, ok := iterable.(*ObjectValue); ok {
+		return i.evalObjectIteration(node, obj, loopEnv)
+	}
+
+	// A range held in a variable iterates like a range literal
+	if rangeValue, ok := iterable.(*RangeValue); ok {
+		iterable, _ = toArray(rangeValue)
+	}
+
+	// Only maps have a value to bind alongside each key
+	if _, ok := iterable.(*MapValue); node.Value != "" && !ok {
+		return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: cannot iterate over %s with two variables", iterable.Type())}
 	}
 
 	// Handle standard iterables
@@ -896,15 +2294,19 @@ func (i *Interpreter) evalForStatement(node *parser.ForStmt, env *Environment) V
 		// Iterate over array elements
 		for _, element := range iterable.Elements {
 			// Bind the current element to the iterator variable
-			loopEnv.Set(node.Iterator, element)
+			if errVal := setLoopVariable(loopEnv, node.Iterator, element); errVal != nil {
+				return errVal
+			}
 
 			// Execute the loop body
 			result := i.eval(node.Body, loopEnv)
 
-			// Handle return statements inside the loop
-			if returnValue, ok := result.(*ReturnValue); ok {
-				return returnValue
+			// Stop on return, error, or break, and skip ahead on continue
+			stop, value := loopSignal(result, node.Label, last)
+			if stop {
+				return value
 			}
+			last = value
 		}
 	case *StringValue:
 		// Iterate over characters in the string
@@ -913,29 +2315,334 @@ func (i *Interpreter) evalForStatement(node *parser.ForStmt, env *Environment) V
 			charValue := &StringValue{Value: string(char)}
 
 			// Bind the current character to the iterator variable
-			loopEnv.Set(node.Iterator, charValue)
+			if errVal := setLoopVariable(loopEnv, node.Iterator, charValue); errVal != nil {
+				return errVal
+			}
+
+			// Execute the loop body
+			result := i.eval(node.Body, loopEnv)
+
+			// Stop on return, error, or break, and skip ahead on continue
+			stop, value := loopSignal(result, node.Label, last)
+			if stop {
+				return value
+			}
+			last = value
+		}
+	case *MapValue:
+		// Iterate over keys in insertion order, binding the value too if asked
+		for _, key := range iterable.Keys {
+			if errVal := setLoopVariable(loopEnv, node.Iterator, key); errVal != nil {
+				return errVal
+			}
+			if node.Value != "" {
+				value, _, _ := iterable.Get(key)
+				if errVal := setLoopVariable(loopEnv, node.Value, value); errVal != nil {
+					return errVal
+				}
+			}
 
 			// Execute the loop body
 			result := i.eval(node.Body, loopEnv)
 
-			// Handle return statements inside the loop
-			if returnValue, ok := result.(*ReturnValue); ok {
-				return returnValue
+			// Stop on return, error, or break, and skip ahead on continue
+			stop, value := loopSignal(result, node.Label, last)
+			if stop {
+				return value
 			}
+			last = value
 		}
 	default:
 		// Unsupported iterable type
-		return &StringValue{Value: fmt.Sprintf("Type error: cannot iterate over %s", iterable.Type())}
+		return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: cannot iterate over %s", iterable.Type())}
 	}
 
-	return &NilValue{}
+	return last
 }
 
-func (i *Interpreter) evalArrayLiteral(node *parser.ArrayLiteral, env *Environment) Value {
-	elements := make([]Value, 0, len(node.Elements))
-
+// setLoopVariable binds a for loop variable in the surrounding scope. A
+// variable declared there with a type keeps it, so an element of another
+// type is a type error rather than being bound anyway.
+func setLoopVariable(env *Environment, name string, value Value) Value {
+	if err := env.Set(name, value); err != nil {
+		return &ErrorValue{Kind: TypeError, Message: err.Error()}
+	}
+	return nil
+}
+
+// evalObjectIteration runs a for loop over an object whose class defines a
+// next method. next is called before each pass and hands out the next
+// element, or nil once there are no more.
+func (i *Interpreter) evalObjectIteration(node *parser.ForStmt, obj *ObjectValue, env *Environment) Value {
+	method, ok := obj.Class.Methods["next"]
+	if !ok {
+		return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: %s is not Iterable (no iter or next method)", obj.Class.Name)}
+	}
+	if node.Value != "" {
+		return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: cannot iterate over %s with two variables", obj.Class.Name)}
+	}
+
+	var last Value = Nil
+	for {
+		element := i.callMethod(obj, method, []Value{})
+		if isError(element) {
+			return element
+		}
+		if _, done := element.(*NilValue); done {
+			return last
+		}
+
+		if errVal := setLoopVariable(env, node.Iterator, element); errVal != nil {
+			return errVal
+		}
+		result := i.eval(node.Body, env)
+
+		// Stop on return, error, or break, and skip ahead on continue
+		stop, value := loopSignal(result, node.Label, last)
+		if stop {
+			return value
+		}
+		last = value
+	}
+}
+
+// sequenceElements returns the elements of an array, or the characters of a
+// string, so both can be indexed and sliced the same way
+func sequenceElements(value Value) ([]Value, bool) {
+	switch value := value.(type) {
+	case *ArrayValue:
+		return value.Elements, true
+	case *StringValue:
+		array, _ := toArray(value)
+		return array.Elements, true
+	}
+	return nil, false
+}
+
+// sequenceResult builds a value of the same kind as original from elements
+func sequenceResult(original Value, elements []Value) Value {
+	if _, ok := original.(*StringValue); ok {
+		var sb strings.Builder
+		for _, element := range elements {
+			sb.WriteString(element.(*StringValue).Value)
+		}
+		return &StringValue{Value: sb.String()}
+	}
+	return &ArrayValue{Elements: elements}
+}
+
+// evalIndexExpression indexes an array or string. Negative indexes count
+// back from the end.
+func (i *Interpreter) evalIndexExpression(node *parser.IndexExpr, env *Environment) Value {
+	collection := i.eval(node.Array, env)
+	if isError(collection) {
+		return collection
+	}
+	index := i.eval(node.Index, env)
+	if isError(index) {
+		return index
+	}
+
+	// Maps are indexed by key, and a missing key gives nil
+	if m, ok := collection.(*MapValue); ok {
+		value, found, errVal := m.Get(index)
+		if errVal != nil {
+			return errVal
+		}
+		if !found {
+			return Nil
+		}
+		return value
+	}
+
+	elements, ok := sequenceElements(collection)
+	if !ok {
+		return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: cannot index %s", collection.VibeType().String())}
+	}
+	position, errVal := elementPosition(index, len(elements))
+	if errVal != nil {
+		return errVal
+	}
+
+	return elements[position]
+}
+
+// elementPosition resolves an index into a sequence of the given length,
+// counting negative indexes back from the end
+func elementPosition(index Value, length int) (int, Value) {
+	idx, ok := index.(*IntegerValue)
+	if !ok {
+		return 0, &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: index must be an int, got %s", index.VibeType().String())}
+	}
+
+	position := idx.Value
+	if position < 0 {
+		position += length
+	}
+	if position < 0 || position >= length {
+		return 0, &ErrorValue{Kind: IndexError, Message: fmt.Sprintf("Error: index %d out of bounds for length %d", idx.Value, length)}
+	}
+	return position, nil
+}
+
+// evalIndexAssignment stores a value in an array element or under a map
+// key, and evaluates to the value. Arrays can't grow this way, and frozen
+// collections and strings can't be changed at all.
+func (i *Interpreter) evalIndexAssignment(node *parser.IndexAssignment, env *Environment) Value {
+	collection := i.eval(node.Target.Array, env)
+	if isError(collection) {
+		return collection
+	}
+	index := i.eval(node.Target.Index, env)
+	if isError(index) {
+		return index
+	}
+	value := i.evalStoredValue(node.Value, env)
+	if isError(value) {
+		return value
+	}
+
+	switch collection := collection.(type) {
+	case *ArrayValue:
+		if collection.Frozen {
+			return &ErrorValue{Kind: FrozenError, Message: "Error: cannot modify frozen collection"}
+		}
+		position, errVal := elementPosition(index, len(collection.Elements))
+		if errVal != nil {
+			return errVal
+		}
+		// A variable declared as Array<T> only takes elements of type T
+		if name, ok := node.Target.Array.(*parser.Identifier); ok {
+			declared, _ := env.declaredType(name.Name)
+			if arrayType, ok := declared.(types.ArrayType); ok && !isAssignable(value, arrayType.ElementType) {
+				return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf(
+					"Type error: Cannot assign value of type %s to an element of %s of type %s",
+					value.VibeType().String(), name.Name, arrayType.String())}
+			}
+		}
+		collection.Elements[position] = value
+	case *MapValue:
+		if collection.Frozen {
+			return &ErrorValue{Kind: FrozenError, Message: "Error: cannot modify frozen collection"}
+		}
+		if errVal := collection.Set(index, value); errVal != nil {
+			return errVal
+		}
+	default:
+		return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: cannot assign to an element of %s", collection.VibeType().String())}
+	}
+
+	return value
+}
+
+// evalSliceExpression slices an array or string as array[start:end:step].
+// Bounds may be negative and are clamped to the sequence, so a slice never
+// fails for being out of range. A negative step walks backwards, with the
+// bounds defaulting to the whole sequence reversed.
+func (i *Interpreter) evalSliceExpression(node *parser.SliceExpr, env *Environment) Value {
+	collection := i.eval(node.Array, env)
+	if isError(collection) {
+		return collection
+	}
+
+	elements, ok := sequenceElements(collection)
+	if !ok {
+		return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: cannot slice %s", collection.VibeType().String())}
+	}
+
+	// Evaluate each part, leaving omitted ones as nil
+	parts := make([]*IntegerValue, 3)
+	for idx, part := range []parser.Node{node.Start, node.End, node.Step} {
+		if part == nil {
+			continue
+		}
+		value := i.eval(part, env)
+		if isError(value) {
+			return value
+		}
+		n, ok := value.(*IntegerValue)
+		if !ok {
+			return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: slice bounds must be ints, got %s", value.VibeType().String())}
+		}
+		parts[idx] = n
+	}
+
+	result, errVal := sliceElements(elements, parts[0], parts[1], parts[2])
+	if errVal != nil {
+		return errVal
+	}
+
+	return sequenceResult(collection, result)
+}
+
+// sliceElements picks elements from start up to (but not including) end,
+// moving step at a time. Omitted parts are nil; negative positions count
+// back from the end and out of range ones are clamped.
+func sliceElements(elements []Value, start, end, stepBy *IntegerValue) ([]Value, Value) {
+	step := 1
+	if stepBy != nil {
+		step = stepBy.Value
+	}
+	if step == 0 {
+		return nil, &ErrorValue{Kind: ArgumentError, Message: "Error: slice step cannot be zero"}
+	}
+
+	// Walking forwards positions run from 0 to length; backwards from
+	// length-1 down to -1, which stands for "before the first element"
+	length := len(elements)
+	lower, upper := 0, length
+	if step < 0 {
+		lower, upper = -1, length-1
+	}
+	bound := func(part *IntegerValue, fallback int) int {
+		if part == nil {
+			return fallback
+		}
+		position := part.Value
+		if position < 0 {
+			position += length
+		}
+		if position < lower {
+			return lower
+		}
+		if position > upper {
+			return upper
+		}
+		return position
+	}
+
+	// A step can be large enough that idx += step overflows, so each loop
+	// stops as soon as the next step would reach the end instead
+	result := []Value{}
+	if step > 0 {
+		stop := bound(end, upper)
+		for idx := bound(start, lower); idx < stop; idx += step {
+			result = append(result, elements[idx])
+			if step >= stop-idx {
+				break
+			}
+		}
+	} else {
+		stop := bound(end, lower)
+		for idx := bound(start, upper); idx > stop; idx += step {
+			result = append(result, elements[idx])
+			if step <= stop-idx {
+				break
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func (i *Interpreter) evalArrayLiteral(node *parser.ArrayLiteral, env *Environment) Value {
+	elements := make([]Value, 0, len(node.Elements))
+
 	for _, element := range node.Elements {
-		evaluated := i.eval(element, env)
+		evaluated := i.evalStoredValue(element, env)
+		if isError(evaluated) {
+			return evaluated
+		}
 		elements = append(elements, evaluated)
 	}
 
@@ -943,6 +2650,11 @@ func (i *Interpreter) evalArrayLiteral(node *parser.ArrayLiteral, env *Environme
 }
 
 func (i *Interpreter) evalBinaryExpression(node *parser.BinaryExpr, env *Environment) Value {
+	// Logical operators only evaluate their right side when they need it
+	if node.Operator == "&&" || node.Operator == "||" {
+		return i.evalLogicalExpression(node, env)
+	}
+
 	left := i.eval(node.Left, env)
 	right := i.eval(node.Right, env)
 
@@ -953,86 +2665,345 @@ func (i *Interpreter) evalBinaryExpression(node *parser.BinaryExpr, env *Environ
 		return right
 	}
 
+	if node.Operator == ".." {
+		start, startOk := left.(*IntegerValue)
+		end, endOk := right.(*IntegerValue)
+		if !startOk || !endOk {
+			return &ErrorValue{Kind: TypeError, Message: "Type error: range bounds must be integers"}
+		}
+		return &RangeValue{Start: start.Value, End: end.Value}
+	}
+
+	if node.Operator == "in" {
+		return containsValue("in", right, left)
+	}
+
+	// Three-way comparison, which objects also use for ordering
+	_, leftIsObject := left.(*ObjectValue)
+	switch node.Operator {
+	case "<=>", "<", ">", "<=", ">=":
+		if node.Operator != "<=>" && !leftIsObject {
+			break
+		}
+		order, errVal := i.compareValues(left, right)
+		if errVal != nil {
+			return errVal
+		}
+		return orderResult(node.Operator, order)
+	}
+
 	switch {
-	case left.Type() == "INTEGER" && right.Type() == "INTEGER":
+	case left.Type() == INTEGER_OBJ && right.Type() == INTEGER_OBJ:
 		return evalIntegerBinaryExpression(node.Operator, left, right)
-	case (left.Type() == "INTEGER" || left.Type() == "FLOAT") && (right.Type() == "INTEGER" || right.Type() == "FLOAT"):
+	case (left.Type() == INTEGER_OBJ || left.Type() == FLOAT_OBJ) && (right.Type() == INTEGER_OBJ || right.Type() == FLOAT_OBJ):
 		return evalNumberBinaryExpression(node.Operator, left, right)
-	case left.Type() == "STRING" && right.Type() == "STRING":
+	case left.Type() == STRING_OBJ && right.Type() == STRING_OBJ:
 		return evalStringBinaryExpression(node.Operator, left, right)
-	case left.Type() == "STRING" && (right.Type() == "INTEGER" || right.Type() == "FLOAT" || right.Type() == "BOOLEAN"):
+	case node.Operator == "*" && (left.Type() == STRING_OBJ || left.Type() == ARRAY_OBJ) && right.Type() == INTEGER_OBJ:
+		return repeatValue(left, right.(*IntegerValue).Value)
+	case left.Type() == STRING_OBJ && (right.Type() == INTEGER_OBJ || right.Type() == FLOAT_OBJ || right.Type() == BOOLEAN_OBJ):
 		// Convert right to string and concatenate
 		if node.Operator == "+" {
-			return &StringValue{Value: left.(*StringValue).Value + right.Inspect()}
+			return &StringValue{Value: left.(*StringValue).Value + i.Display(right)}
 		}
-		return &StringValue{Value: fmt.Sprintf("Type error: unsupported operator %s for types %s and %s", node.Operator, left.Type(), right.Type())}
-	case (left.Type() == "INTEGER" || left.Type() == "FLOAT" || left.Type() == "BOOLEAN") && right.Type() == "STRING":
+		return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: unsupported operator %s for types %s and %s", node.Operator, left.Type(), right.Type())}
+	case (left.Type() == INTEGER_OBJ || left.Type() == FLOAT_OBJ || left.Type() == BOOLEAN_OBJ) && right.Type() == STRING_OBJ:
 		// Convert left to string and concatenate
 		if node.Operator == "+" {
-			return &StringValue{Value: left.Inspect() + right.(*StringValue).Value}
+			return &StringValue{Value: i.Display(left) + right.(*StringValue).Value}
 		}
-		return &StringValue{Value: fmt.Sprintf("Type error: unsupported operator %s for types %s and %s", node.Operator, left.Type(), right.Type())}
+		return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: unsupported operator %s for types %s and %s", node.Operator, left.Type(), right.Type())}
 	case node.Operator == "==":
-		return &BooleanValue{Value: left.Inspect() == right.Inspect()}
+		return nativeBoolToBooleanObject(valuesEqual(left, right))
 	case node.Operator == "!=":
-		return &BooleanValue{Value: left.Inspect() != right.Inspect()}
+		return nativeBoolToBooleanObject(!valuesEqual(left, right))
 	default:
-		return &StringValue{Value: fmt.Sprintf("Type error: unsupported operator %s for types %s and %s", node.Operator, left.Type(), right.Type())}
+		return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: unsupported operator %s for types %s and %s", node.Operator, left.Type(), right.Type())}
 	}
 }
 
+// evalLogicalExpression evaluates && and || with short-circuiting
+func (i *Interpreter) evalLogicalExpression(node *parser.BinaryExpr, env *Environment) Value {
+	left := i.eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	if node.Operator == "&&" && !isTruthy(left) {
+		return False
+	}
+	if node.Operator == "||" && isTruthy(left) {
+		return True
+	}
+
+	right := i.eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
 // Helper functions
 
+// castConverters names the builtin that converts a value for a cast to each
+// type that converts rather than only checks
+var castConverters = map[string]string{
+	"int":    "to_int",
+	"float":  "to_float",
+	"string": "to_string",
+}
+
+// castTypeNames are the built-in types a cast can name. Any other name in
+// the target must be a class.
+var castTypeNames = map[string]bool{
+	"int": true, "float": true, "string": true, "bool": true, "nil": true,
+	"any": true, "void": true, "map": true, "range": true, "Array": true,
+	"union": true,
+}
+
+// unknownCastType finds a name in a cast's target that is neither a built-in
+// type nor a class, such as Foo in 5 as Foo, or returns "" if there's none
+func unknownCastType(target *parser.TypeAnnotation, env *Environment) string {
+	if !castTypeNames[target.TypeName] {
+		value, ok := env.Get(target.TypeName)
+		if _, isClass := value.(*ClassValue); !ok || !isClass {
+			return target.TypeName
+		}
+	}
+	for _, param := range target.TypeParams {
+		if param, ok := param.(*parser.TypeAnnotation); ok {
+			if name := unknownCastType(param, env); name != "" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// evalCastExpression evaluates x as T. Casts to int, float and string convert
+// the value the way to_int, to_float and to_string do; a cast to any other
+// type passes the value through if it already has that type. A cast to a
+// class needs an instance of it or of a subclass.
+func (i *Interpreter) evalCastExpression(node *parser.CastExpr, env *Environment) Value {
+	value := i.eval(node.Value, env)
+	if isError(value) {
+		return value
+	}
+
+	if name := unknownCastType(node.Target, env); name != "" {
+		return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: cannot cast to unknown type %s", name)}
+	}
+	if !castTypeNames[node.Target.TypeName] {
+		if obj, ok := value.(*ObjectValue); !ok || !obj.IsA(node.Target.TypeName) {
+			return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: cannot cast %s to %s",
+				value.VibeType().String(), node.Target.TypeName)}
+		}
+		return value
+	}
+
+	target := i.parseTypeAnnotation(node.Target)
+	if converter, ok := castConverters[target.String()]; ok {
+		return i.applyFunction(env.builtins[converter], []Value{value})
+	}
+
+	if !isAssignable(value, target) {
+		return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: cannot cast %s to %s",
+			value.VibeType().String(), target.String())}
+	}
+	return value
+}
+
+func (i *Interpreter) evalUnaryExpression(node *parser.UnaryExpr, env *Environment) Value {
+	right := i.eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+
+	switch node.Operator {
+	case "!":
+		return nativeBoolToBooleanObject(!isTruthy(right))
+	case "-":
+		switch right := right.(type) {
+		case *IntegerValue:
+			if right.Value == math.MinInt {
+				return &ErrorValue{Kind: OverflowError, Message: fmt.Sprintf("Error: integer overflow in -(%d)", right.Value)}
+			}
+			return &IntegerValue{Value: -right.Value}
+		case *FloatValue:
+			return &FloatValue{Value: -right.Value}
+		}
+		return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: unsupported operator - for type %s", right.Type())}
+	case "+":
+		switch right.(type) {
+		case *IntegerValue, *FloatValue:
+			return right
+		}
+		return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: unsupported operator + for type %s", right.Type())}
+	}
+
+	return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Error: unknown prefix operator: %s", node.Operator)}
+}
+
+// orderResult turns a three-way comparison into the result of operator
+func orderResult(operator string, order int) Value {
+	switch operator {
+	case "<":
+		return nativeBoolToBooleanObject(order < 0)
+	case ">":
+		return nativeBoolToBooleanObject(order > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(order <= 0)
+	case ">=":
+		return nativeBoolToBooleanObject(order >= 0)
+	}
+	return &IntegerValue{Value: order}
+}
+
 func evalIntegerBinaryExpression(operator string, left, right Value) Value {
 	leftVal := left.(*IntegerValue).Value
 	rightVal := right.(*IntegerValue).Value
 
+	// Integers are 64-bit, and a result that doesn't fit is an error rather
+	// than silently wrapping around. The error is only built when needed,
+	// as formatting it on every operation is costly.
+	overflow := func() Value {
+		return &ErrorValue{Kind: OverflowError, Message: fmt.Sprintf("Error: integer overflow in %d %s %d", leftVal, operator, rightVal)}
+	}
+
 	switch operator {
 	case "+":
-		return &IntegerValue{Value: leftVal + rightVal}
+		sum := leftVal + rightVal
+		// Adding two numbers of the same sign can't change the sign
+		if (leftVal < 0) == (rightVal < 0) && (sum < 0) != (leftVal < 0) {
+			return overflow()
+		}
+		return &IntegerValue{Value: sum}
 	case "-":
-		return &IntegerValue{Value: leftVal - rightVal}
+		difference := leftVal - rightVal
+		if (leftVal < 0) != (rightVal < 0) && (difference < 0) != (leftVal < 0) {
+			return overflow()
+		}
+		return &IntegerValue{Value: difference}
 	case "*":
-		return &IntegerValue{Value: leftVal * rightVal}
+		product, ok := multiplyIntegers(leftVal, rightVal)
+		if !ok {
+			return overflow()
+		}
+		return &IntegerValue{Value: product}
 	case "/":
 		if rightVal == 0 {
-			return &StringValue{Value: "Error: division by zero"}
+			return &ErrorValue{Kind: DivisionByZero, Message: "Error: division by zero"}
+		}
+		if leftVal == math.MinInt && rightVal == -1 {
+			return overflow()
 		}
 		return &IntegerValue{Value: leftVal / rightVal}
 	case "%":
 		if rightVal == 0 {
-			return &StringValue{Value: "Error: modulo by zero"}
+			return &ErrorValue{Kind: DivisionByZero, Message: "Error: modulo by zero"}
 		}
 		return &IntegerValue{Value: leftVal % rightVal}
+	case "**":
+		// A negative exponent has a fractional result, so promote to float
+		if rightVal < 0 {
+			return evalNumberBinaryExpression(operator, left, right)
+		}
+		result, ok := 1, true
+		for base, exp := leftVal, rightVal; exp > 0; exp >>= 1 {
+			if exp&1 == 1 {
+				if result, ok = multiplyIntegers(result, base); !ok {
+					return overflow()
+				}
+			}
+			// The square is only needed, and only has to fit, for higher bits
+			if exp > 1 {
+				if base, ok = multiplyIntegers(base, base); !ok {
+					return overflow()
+				}
+			}
+		}
+		return &IntegerValue{Value: result}
 	case "<":
-		return &BooleanValue{Value: leftVal < rightVal}
+		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
-		return &BooleanValue{Value: leftVal > rightVal}
+		return nativeBoolToBooleanObject(leftVal > rightVal)
 	case "<=":
-		return &BooleanValue{Value: leftVal <= rightVal}
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
 	case ">=":
-		return &BooleanValue{Value: leftVal >= rightVal}
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
-		return &BooleanValue{Value: leftVal == rightVal}
+		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
-		return &BooleanValue{Value: leftVal != rightVal}
+		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
-		return &StringValue{Value: fmt.Sprintf("Error: unknown operator for integers: %s", operator)}
+		return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Error: unknown operator for integers: %s", operator)}
+	}
+}
+
+// multiplyIntegers multiplies two integers, reporting false if the product
+// doesn't fit in 64 bits
+func multiplyIntegers(a, b int) (int, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	product := a * b
+	if product/b != a || (a == math.MinInt && b == -1) {
+		return 0, false
 	}
+	return product, true
+}
+
+// maxRepeatLength bounds the length of a repeated string or array, so that
+// a huge count fails cleanly instead of exhausting memory
+const maxRepeatLength = 1 << 24
+
+// repeatValue implements "ab" * 3 and [0] * 3, joining count copies of a
+// string or of an array's elements. A count of zero or less gives an empty
+// result. Repeated elements are shared, not copied.
+func repeatValue(value Value, count int) Value {
+	if count < 0 {
+		count = 0
+	}
+
+	switch value := value.(type) {
+	case *StringValue:
+		if value.Value == "" {
+			return &StringValue{Value: ""}
+		}
+		if total, ok := multiplyIntegers(len(value.Value), count); !ok || total > maxRepeatLength {
+			return &ErrorValue{Kind: OverflowError, Message: fmt.Sprintf("Error: cannot repeat a string %d times", count)}
+		}
+		return &StringValue{Value: strings.Repeat(value.Value, count)}
+	case *ArrayValue:
+		if len(value.Elements) == 0 {
+			return &ArrayValue{Elements: []Value{}}
+		}
+		total, ok := multiplyIntegers(len(value.Elements), count)
+		if !ok || total > maxRepeatLength {
+			return &ErrorValue{Kind: OverflowError, Message: fmt.Sprintf("Error: cannot repeat an array %d times", count)}
+		}
+		elements := make([]Value, 0, total)
+		for n := 0; n < count; n++ {
+			elements = append(elements, value.Elements...)
+		}
+		return &ArrayValue{Elements: elements}
+	}
+	return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: cannot repeat %s", value.Type())}
 }
 
 func evalNumberBinaryExpression(operator string, left, right Value) Value {
 	var leftVal, rightVal float64
 
 	// Convert left to float64
-	if left.Type() == "INTEGER" {
+	if left.Type() == INTEGER_OBJ {
 		leftVal = float64(left.(*IntegerValue).Value)
 	} else {
 		leftVal = left.(*FloatValue).Value
 	}
 
 	// Convert right to float64
-	if right.Type() == "INTEGER" {
+	if right.Type() == INTEGER_OBJ {
 		rightVal = float64(right.(*IntegerValue).Value)
 	} else {
 		rightVal = right.(*FloatValue).Value
@@ -1047,28 +3018,33 @@ func evalNumberBinaryExpression(operator string, left, right Value) Value {
 		return &FloatValue{Value: leftVal * rightVal}
 	case "/":
 		if rightVal == 0 {
-			return &StringValue{Value: "Error: division by zero"}
+			return &ErrorValue{Kind: DivisionByZero, Message: "Error: division by zero"}
 		}
 		return &FloatValue{Value: leftVal / rightVal}
 	case "%":
 		if rightVal == 0 {
-			return &StringValue{Value: "Error: modulo by zero"}
+			return &ErrorValue{Kind: DivisionByZero, Message: "Error: modulo by zero"}
 		}
 		return &FloatValue{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		if leftVal == 0 && rightVal < 0 {
+			return &ErrorValue{Kind: DivisionByZero, Message: "Error: zero cannot be raised to a negative power"}
+		}
+		return &FloatValue{Value: math.Pow(leftVal, rightVal)}
 	case "<":
-		return &BooleanValue{Value: leftVal < rightVal}
+		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
-		return &BooleanValue{Value: leftVal > rightVal}
+		return nativeBoolToBooleanObject(leftVal > rightVal)
 	case "<=":
-		return &BooleanValue{Value: leftVal <= rightVal}
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
 	case ">=":
-		return &BooleanValue{Value: leftVal >= rightVal}
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
-		return &BooleanValue{Value: leftVal == rightVal}
+		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
-		return &BooleanValue{Value: leftVal != rightVal}
+		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
-		return &StringValue{Value: fmt.Sprintf("Error: unknown operator for numbers: %s", operator)}
+		return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Error: unknown operator for numbers: %s", operator)}
 	}
 }
 
@@ -1080,11 +3056,14 @@ func evalStringBinaryExpression(operator string, left, right Value) Value {
 	case "+":
 		return &StringValue{Value: leftVal + rightVal}
 	case "==":
-		return &BooleanValue{Value: leftVal == rightVal}
+		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
-		return &BooleanValue{Value: leftVal != rightVal}
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	case "<", ">", "<=", ">=":
+		// Lexicographic by byte, so uppercase letters sort before lowercase
+		return orderResult(operator, strings.Compare(leftVal, rightVal))
 	default:
-		return &StringValue{Value: fmt.Sprintf("Error: unknown operator for strings: %s", operator)}
+		return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Error: unknown operator for strings: %s", operator)}
 	}
 }
 
@@ -1105,9 +3084,11 @@ func isTruthy(obj Value) bool {
 	}
 }
 
+// isError reports whether evaluation has to stop. An exit unwinds the same
+// way as an error, so everything that stops on an error stops on exit too.
 func isError(obj Value) bool {
 	if obj != nil {
-		return obj.Type() == "ERROR"
+		return obj.Type() == ERROR_OBJ || obj.Type() == EXIT_OBJ
 	}
 	return false
 }
@@ -1117,12 +3098,12 @@ func (i *Interpreter) evalClassInstantiation(node *parser.ClassInst, env *Enviro
 	// Evaluate the class expression
 	classVal := i.eval(node.Class, env)
 	if classVal == nil {
-		return &StringValue{Value: "Error: Cannot instantiate nil class"}
+		return &ErrorValue{Kind: TypeError, Message: "Error: Cannot instantiate nil class"}
 	}
 
 	class, ok := classVal.(*ClassValue)
 	if !ok {
-		return &StringValue{Value: fmt.Sprintf("Error: %s is not a class", classVal.Inspect())}
+		return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Error: %s is not a class", classVal.Inspect())}
 	}
 
 	// Create a new object instance
@@ -1130,6 +3111,9 @@ func (i *Interpreter) evalClassInstantiation(node *parser.ClassInst, env *Enviro
 		Class:      class,
 		Properties: make(map[string]Value),
 	}
+	if errVal := i.initializeFields(obj, class); errVal != nil {
+		return errVal
+	}
 
 	// Evaluate arguments
 	var args []Value
@@ -1151,37 +3135,328 @@ func (i *Interpreter) evalMethodCall(node *parser.MethodCall, env *Environment)
 	// Evaluate the object that the method is being called on
 	objectVal := i.eval(node.Object, env)
 	if objectVal == nil {
-		return &StringValue{Value: "Error: Cannot call method on nil"}
+		return &ErrorValue{Kind: TypeError, Message: "Error: Cannot call method on nil"}
+	}
+	if isError(objectVal) {
+		return objectVal
+	}
+
+	// Optional chaining short-circuits on a nil receiver
+	if _, isNil := objectVal.(*NilValue); isNil && node.Optional {
+		return Nil
 	}
 
 	obj, ok := objectVal.(*ObjectValue)
 	if !ok {
-		return &StringValue{Value: fmt.Sprintf("Error: %s is not an object", objectVal.Inspect())}
+		// Built-in values have a few methods of their own
+		if method, ok := valueMethods[objectVal.Type()][node.Method]; ok {
+			args := i.evalExpressions(node.Args, env)
+			if len(args) == 1 && isError(args[0]) {
+				return args[0]
+			}
+			return method(objectVal, args)
+		}
+		if builtinMethods[objectVal.Type()][node.Method] {
+			args := i.evalExpressions(node.Args, env)
+			if len(args) == 1 && isError(args[0]) {
+				return args[0]
+			}
+			return i.applyFunction(env.builtins[node.Method], append([]Value{objectVal}, args...))
+		}
+		_, hasMethods := valueMethods[objectVal.Type()]
+		if _, hasBuiltinMethods := builtinMethods[objectVal.Type()]; hasMethods || hasBuiltinMethods {
+			return &ErrorValue{Kind: NameError, Message: fmt.Sprintf("Error: Method %s not found for %s",
+				node.Method, objectVal.VibeType().String())}
+		}
+		return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Error: %s is not an object", objectVal.Inspect())}
 	}
 
 	// Look up the method in the class
 	method, ok := obj.Class.Methods[node.Method]
 	if !ok {
-		return &StringValue{Value: fmt.Sprintf("Error: Method %s not found in class %s",
+		return &ErrorValue{Kind: NameError, Message: fmt.Sprintf("Error: Method %s not found in class %s",
 			node.Method, obj.Class.Name)}
 	}
 
-	// Build argument list with the object as the first argument (this)
-	var args []Value
-	args = append(args, obj) // The object instance is passed as the first argument
+	args := i.evalExpressions(node.Args, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
 
-	// Add the rest of the arguments
-	for _, argNode := range node.Args {
-		args = append(args, i.eval(argNode, env))
+	return i.callMethod(obj, method, args)
+}
+
+// lengthOf returns the number of bytes in a string, elements in an array or
+// entries in a map
+func lengthOf(value Value) (int, bool) {
+	switch value := value.(type) {
+	case *StringValue:
+		return len(value.Value), true
+	case *ArrayValue:
+		return len(value.Elements), true
+	case *MapValue:
+		return len(value.Keys), true
+	}
+	return 0, false
+}
+
+// checkMethodArgs returns an error when a value method is called with the
+// wrong number of arguments, or nil when the count is right
+func checkMethodArgs(args []Value, expected int) Value {
+	if len(args) != expected {
+		return &ErrorValue{Kind: ArgumentError, Message: fmt.Sprintf(
+			"Wrong number of arguments: method expects %d, got %d", expected, len(args))}
+	}
+	return nil
+}
+
+// sizeMethod implements size() and count(), which mirror the len builtin
+func sizeMethod(receiver Value, args []Value) Value {
+	if errVal := checkMethodArgs(args, 0); errVal != nil {
+		return errVal
 	}
+	length, _ := lengthOf(receiver)
+	return &IntegerValue{Value: length}
+}
+
+// stringTransform makes a string method that takes no arguments and returns
+// a new string, leaving the receiver unchanged
+func stringTransform(transform func(string) string) func(receiver Value, args []Value) Value {
+	return func(receiver Value, args []Value) Value {
+		if errVal := checkMethodArgs(args, 0); errVal != nil {
+			return errVal
+		}
+		return &StringValue{Value: transform(receiver.(*StringValue).Value)}
+	}
+}
+
+// stringArguments checks that every argument of a string method is a string
+func stringArguments(method string, args []Value) ([]string, Value) {
+	values := make([]string, len(args))
+	for idx, arg := range args {
+		str, ok := arg.(*StringValue)
+		if !ok {
+			return nil, &ErrorValue{Kind: TypeError, Message: fmt.Sprintf(
+				"Type error: %s expects string arguments, got %s", method, arg.VibeType().String())}
+		}
+		values[idx] = str.Value
+	}
+	return values, nil
+}
+
+// splitMethod implements split(sep), breaking a string into an array of the
+// pieces between each sep
+func splitMethod(receiver Value, args []Value) Value {
+	if errVal := checkMethodArgs(args, 1); errVal != nil {
+		return errVal
+	}
+	values, errVal := stringArguments("split", args)
+	if errVal != nil {
+		return errVal
+	}
+
+	pieces := strings.Split(receiver.(*StringValue).Value, values[0])
+	elements := make([]Value, len(pieces))
+	for idx, piece := range pieces {
+		elements[idx] = &StringValue{Value: piece}
+	}
+	return &ArrayValue{Elements: elements}
+}
+
+// replaceMethod implements replace(old, new), replacing every occurrence of old
+func replaceMethod(receiver Value, args []Value) Value {
+	if errVal := checkMethodArgs(args, 2); errVal != nil {
+		return errVal
+	}
+	values, errVal := stringArguments("replace", args)
+	if errVal != nil {
+		return errVal
+	}
+	return &StringValue{Value: strings.ReplaceAll(receiver.(*StringValue).Value, values[0], values[1])}
+}
 
+// valueMethods holds the methods of built-in values, by value type and then
+// method name. Each is called with the receiver and the evaluated arguments.
+var valueMethods = map[string]map[string]func(receiver Value, args []Value) Value{
+	ARRAY_OBJ: {"size": sizeMethod, "count": sizeMethod, "length": sizeMethod},
+	STRING_OBJ: {
+		"size":     sizeMethod,
+		"count":    sizeMethod,
+		"length":   sizeMethod,
+		"upcase":   stringTransform(strings.ToUpper),
+		"downcase": stringTransform(strings.ToLower),
+		"trim":     stringTransform(strings.TrimSpace),
+		"split":    splitMethod,
+		"replace":  replaceMethod,
+	},
+	MAP_OBJ: {"size": sizeMethod, "count": sizeMethod, "length": sizeMethod},
+}
+
+// valueProperties lists the read-only properties of built-in values, by
+// value type. Each is the number of elements, as len gives it.
+var valueProperties = map[string]map[string]bool{
+	ARRAY_OBJ:  {"length": true, "size": true, "count": true},
+	STRING_OBJ: {"length": true, "size": true, "count": true},
+	MAP_OBJ:    {"length": true, "size": true, "count": true},
+}
+
+// builtinMethods lists the methods of built-in values that call back into
+// Vibe code, by value type. Each is the builtin of the same name with the
+// receiver as its first argument, so 5.times(fn) is times(5, fn).
+var builtinMethods = map[string]map[string]bool{
+	INTEGER_OBJ: {"times": true},
+	ARRAY_OBJ:   {"each": true, "map": true},
+	STRING_OBJ:  {"each": true},
+	MAP_OBJ:     {"each": true},
+}
+
+// callMethod invokes a method with the object passed ahead of args as the receiver
+func (i *Interpreter) callMethod(obj *ObjectValue, method *FunctionValue, args []Value) Value {
 	// If it's a builtin method, use the builtin function
 	if method.BuiltinFunc != nil {
-		return method.BuiltinFunc(args)
+		return method.BuiltinFunc(append([]Value{obj}, args...))
+	}
+
+	// A user-defined method runs like a function, in a scope where self is the object
+	scope := newScope(method.Env, 1)
+	scope.store["self"] = obj
+	bound := *method
+	bound.Env = scope
+	return i.applyFunction(&bound, args)
+}
+
+// selfObject returns the object whose method is running in env
+func selfObject(env *Environment) (*ObjectValue, bool) {
+	self, ok := env.Get("self")
+	if !ok {
+		return nil, false
+	}
+	obj, ok := self.(*ObjectValue)
+	return obj, ok
+}
+
+// evalInstanceVariable reads @name off the object whose method is running
+func (i *Interpreter) evalInstanceVariable(name string, env *Environment) Value {
+	obj, ok := selfObject(env)
+	if !ok {
+		return &ErrorValue{Kind: NameError, Message: fmt.Sprintf("Error: instance variable @%s used outside of a method", name)}
+	}
+	if value, ok := obj.Properties[name]; ok {
+		return value
+	}
+	return &ErrorValue{Kind: NameError, Message: fmt.Sprintf("Error: instance variable @%s not found in class %s", name, obj.Class.Name)}
+}
+
+// assignInstanceVariable sets @name on the object whose method is running,
+// checking the value against the type of the field if the class declares one
+func (i *Interpreter) assignInstanceVariable(name string, value Value, env *Environment) Value {
+	obj, ok := selfObject(env)
+	if !ok {
+		return &ErrorValue{Kind: NameError, Message: fmt.Sprintf("Error: instance variable @%s used outside of a method", name)}
+	}
+	for class := obj.Class; class != nil; class = class.Parent {
+		for _, field := range class.Fields {
+			if field.Name == name && !isAssignable(value, field.Type) {
+				return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf(
+					"Type error: field @%s of class %s expects %s, got %s",
+					name, class.Name, field.Type.String(), value.VibeType().String())}
+			}
+		}
+	}
+	obj.Properties[name] = value
+	return Nil
+}
+
+// compareValues orders two values for <=> and sort, returning -1, 0 or 1.
+// Numbers and strings compare naturally. Objects are Comparable when their
+// class defines a <=> method, which is called with the other value and must
+// return an integer.
+func (i *Interpreter) compareValues(left, right Value) (int, Value) {
+	if obj, ok := left.(*ObjectValue); ok {
+		method, ok := obj.Class.Methods["<=>"]
+		if !ok {
+			return 0, &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: %s is not Comparable (no <=> method)", obj.Class.Name)}
+		}
+
+		result := i.callMethod(obj, method, []Value{right})
+		if isError(result) {
+			return 0, result
+		}
+		order, ok := result.(*IntegerValue)
+		if !ok {
+			return 0, &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: %s#<=> must return an int, got %s", obj.Class.Name, result.VibeType())}
+		}
+		return sign(float64(order.Value)), nil
+	}
+
+	switch {
+	case left.Type() == INTEGER_OBJ && right.Type() == INTEGER_OBJ:
+		a, b := left.(*IntegerValue).Value, right.(*IntegerValue).Value
+		if a == b {
+			return 0, nil
+		} else if a < b {
+			return -1, nil
+		}
+		return 1, nil
+	case (left.Type() == INTEGER_OBJ || left.Type() == FLOAT_OBJ) && (right.Type() == INTEGER_OBJ || right.Type() == FLOAT_OBJ):
+		return sign(toFloat(left) - toFloat(right)), nil
+	case left.Type() == STRING_OBJ && right.Type() == STRING_OBJ:
+		return strings.Compare(left.(*StringValue).Value, right.(*StringValue).Value), nil
+	}
+
+	return 0, &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Type error: cannot compare %s with %s", left.Type(), right.Type())}
+}
+
+func sign(x float64) int {
+	switch {
+	case x < 0:
+		return -1
+	case x > 0:
+		return 1
+	}
+	return 0
+}
+
+func toFloat(value Value) float64 {
+	if integer, ok := value.(*IntegerValue); ok {
+		return float64(integer.Value)
+	}
+	return value.(*FloatValue).Value
+}
+
+// evalDotExpression reads a property off an object instance, or one of the
+// pseudo-properties of a built-in value such as an array's length
+func (i *Interpreter) evalDotExpression(node *parser.DotExpr, env *Environment) Value {
+	objectVal := i.eval(node.Object, env)
+	if isError(objectVal) {
+		return objectVal
+	}
+
+	// Optional chaining short-circuits on a nil receiver
+	if _, isNil := objectVal.(*NilValue); isNil && node.Optional {
+		return Nil
+	}
+
+	obj, ok := objectVal.(*ObjectValue)
+	if !ok {
+		properties, hasProperties := valueProperties[objectVal.Type()]
+		if properties[node.Property] {
+			length, _ := lengthOf(objectVal)
+			return &IntegerValue{Value: length}
+		}
+		if hasProperties {
+			return &ErrorValue{Kind: NameError, Message: fmt.Sprintf("Error: Property %s not found for %s",
+				node.Property, objectVal.VibeType().String())}
+		}
+		return &ErrorValue{Kind: TypeError, Message: fmt.Sprintf("Error: Cannot access property %s on %s", node.Property, objectVal.Type())}
+	}
+
+	if value, ok := obj.Properties[node.Property]; ok {
+		return value
 	}
 
-	// Otherwise, it should be a user-defined method, but we haven't implemented this yet
-	return &StringValue{Value: "User-defined methods not yet supported"}
+	return &ErrorValue{Kind: NameError, Message: fmt.Sprintf("Error: Property %s not found in class %s",
+		node.Property, obj.Class.Name)}
 }
 
 // toString converts any value to a string representation
@@ -1202,7 +3477,7 @@ func toString(val Value) string {
 	case *ArrayValue:
 		return fmt.Sprintf("%v", v.Inspect())
 	case *FunctionValue:
-		return fmt.Sprintf("function %s", v.Name)
+		return v.Inspect()
 	case *ClassValue:
 		return fmt.Sprintf("class %s", v.Name)
 	case *ObjectValue:
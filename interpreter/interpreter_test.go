@@ -1,11 +1,15 @@
 package interpreter
 
 import (
+	"bytes"
 	"fmt"
+	"math"
+	"strings"
 	"testing"
 
 	"github.com/example/vibe/lexer"
 	"github.com/example/vibe/parser"
+	"github.com/example/vibe/types"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -106,6 +110,613 @@ func TestIfElseExpressions(t *testing.T) {
 	}
 }
 
+func TestIfConditionDoPlacement(t *testing.T) {
+	tests := []string{
+		"x = 10\nif x > 5 do\n  1\nelse\n  2\nend",
+		"x = 10\nif x > 5\ndo\n  1\nelse\n  2\nend",
+	}
+
+	for _, input := range tests {
+		evaluated := testEval(input)
+		if !testIntegerValue(t, evaluated, 1) {
+			t.Errorf("Failed test for input: %q", input)
+		}
+	}
+}
+
+func TestMultiLineWhileCondition(t *testing.T) {
+	input := `a = 3
+b = 0
+while a > 0 &&
+      a < 10
+do
+  a = a - 1
+  b = b + 1
+end
+b`
+
+	evaluated := testEval(input)
+	testIntegerValue(t, evaluated, 3)
+}
+
+func TestLogicalOperatorsShortCircuit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true && false", false},
+		{"false || true", true},
+		{"1 < 2 && 2 < 3", true},
+		// The right side would be an error if it were evaluated
+		{"false && missing(1)", false},
+		{"true || missing(1)", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if !testBooleanValue(t, evaluated, tt.expected) {
+			t.Errorf("Failed test for input: %s", tt.input)
+		}
+	}
+}
+
+func TestWordBooleanOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true and false", false},
+		{"true and true", true},
+		{"false or true", true},
+		{"false or false", false},
+		{"not true", false},
+		{"not nil", true},
+		// They bind exactly like the symbols they stand for
+		{"1 < 2 and 2 < 3", true},
+		{"true or false and false", true},
+		{"not false and false", false},
+		{"x = 5\nx > 1 and not (x == 3)", true},
+		{"true and false || true", true},
+		// And short-circuit the same way
+		{"false and missing(1)", false},
+		{"true or missing(1)", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if !testBooleanValue(t, evaluated, tt.expected) {
+			t.Errorf("Failed test for input: %s", tt.input)
+		}
+	}
+}
+
+func TestEmptyPrograms(t *testing.T) {
+	inputs := []string{
+		"",
+		"   \n  ",
+		"# only a comment\n// and another\n",
+	}
+
+	for _, input := range inputs {
+		evaluated := testEval(input)
+		if !testNilValue(t, evaluated) {
+			t.Errorf("Failed test for input: %q", input)
+		}
+	}
+}
+
+func TestEvalBuiltin(t *testing.T) {
+	testIntegerValue(t, testEval(`eval("1 + 2")`), 3)
+	testIntegerValue(t, testEval("x = 5\neval(\"x * 2\")"), 10)
+
+	// Source can define a variable and then use it, or leave it behind
+	testIntegerValue(t, testEval("eval(\"y = 3\ny * 2\")"), 6)
+	testIntegerValue(t, testEval("eval(\"y = 3\")\ny + 1"), 4)
+
+	// Inside a function, eval sees and assigns the function's own scope
+	testIntegerValue(t, testEval("def f(n) do\n  eval(\"m = n * 2\")\n  return m + 1\nend\nf(5)"), 11)
+	if evaluated := testEval("def f() do\n  eval(\"m = 1\")\n  return 0\nend\nf()\nm"); !isError(evaluated) {
+		t.Errorf("Expected m to stay local to the function, got %T (%+v)", evaluated, evaluated)
+	}
+
+	evaluated := testEval(`eval("x = (1 +")`)
+	if !isError(evaluated) {
+		t.Errorf("Expected an error for invalid source, got %T (%+v)", evaluated, evaluated)
+	}
+
+	evaluated = testEval(`s = "eval(s)"` + "\neval(s)")
+	if !isError(evaluated) {
+		t.Errorf("Expected an error for self-evaluating source, got %T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestQuoteBuiltin(t *testing.T) {
+	evaluated := testEval(`quote("1 + 2")`)
+
+	node, ok := evaluated.(*ObjectValue)
+	if !ok {
+		t.Fatalf("Expected a Node object, got %T (%+v)", evaluated, evaluated)
+	}
+	if node.Properties["type"].Inspect() != "BinaryExpr" {
+		t.Errorf("Expected node type BinaryExpr, got %s", node.Properties["type"].Inspect())
+	}
+	if node.Properties["operator"].Inspect() != "+" {
+		t.Errorf("Expected operator +, got %s", node.Properties["operator"].Inspect())
+	}
+
+	children, ok := node.Properties["children"].(*ArrayValue)
+	if !ok || len(children.Elements) != 2 {
+		t.Fatalf("Expected 2 children, got %+v", node.Properties["children"])
+	}
+	for idx, expected := range []int{1, 2} {
+		child := children.Elements[idx].(*ObjectValue)
+		if child.Properties["type"].Inspect() != "Number" {
+			t.Errorf("Child %d: expected type Number, got %s", idx, child.Properties["type"].Inspect())
+		}
+		testIntegerValue(t, child.Properties["value"], expected)
+	}
+
+	// Properties are reachable from Vibe code as well
+	evaluated = testEval(`q = quote("x = 1")` + "\nq.name")
+	if evaluated.Inspect() != "x" {
+		t.Errorf("Expected name x, got %s", evaluated.Inspect())
+	}
+}
+
+func TestBreakAndContinue(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"sum = 0\nfor x in [1, 2, 3, 4] do\n  if x == 3\n    break\n  end\n  sum += x\nend\nsum", 3},
+		{"sum = 0\nfor x in [1, 2, 3, 4] do\n  if x == 3\n    continue\n  end\n  sum += x\nend\nsum", 7},
+		{"i = 0\nwhile true do\n  i += 1\n  if i == 5\n    break\n  end\nend\ni", 5},
+		{"for i in 1..10 do\n  if i == 4\n    break\n  end\nend\ni", 4},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if !testIntegerValue(t, evaluated, tt.expected) {
+			t.Errorf("Failed test for input: %s", tt.input)
+		}
+	}
+}
+
+func TestLabeledBreakEndsOuterLoop(t *testing.T) {
+	input := `
+count = 0
+i = 0
+outer: while i < 3 do
+  i += 1
+  for j in [1, 2, 3] do
+    if i == 2
+      break outer
+    end
+    count += 1
+  end
+end
+count * 10 + i
+`
+
+	// The first pass counts 3 inner iterations, the second breaks out of both loops
+	testIntegerValue(t, testEval(input), 32)
+
+	input = `
+count = 0
+i = 0
+outer: while i < 3 do
+  i += 1
+  for j in [1, 2, 3] do
+    if j == 2
+      continue outer
+    end
+    count += 1
+  end
+end
+count
+`
+
+	// Each outer pass stops its inner loop at j == 2
+	testIntegerValue(t, testEval(input), 3)
+}
+
+func TestBreakInNestedBlockEndsOnlyItsLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		// The break sits two ifs deep in the inner loop, so each outer pass
+		// counts one inner iteration and still adds its 10
+		{`
+count = 0
+for i in [1, 2, 3] do
+  for j in [1, 2, 3] do
+    if j == 2
+      if true
+        break
+      end
+    end
+    count += 1
+  end
+  count += 10
+end
+count
+`, 33},
+		// Likewise continue skips only the inner loop's remaining body
+		{`
+count = 0
+i = 0
+while i < 2 do
+  i += 1
+  for j in 1..4 do
+    if j % 2 == 0
+      continue
+    end
+    count += 1
+  end
+end
+count * 10 + i
+`, 42},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if !testIntegerValue(t, evaluated, tt.expected) {
+			t.Errorf("Failed test for input: %s", tt.input)
+		}
+	}
+
+	// A break in a function called from a loop doesn't reach that loop
+	evaluated := testEval("def f() do\n  break\nend\nfor i in [1, 2] do\n  f()\nend")
+	if !isError(evaluated) {
+		t.Errorf("Expected an error for a break outside of a loop, got %T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestStrayLoopControl(t *testing.T) {
+	inputs := []string{
+		"break",
+		"continue",
+		"for x in [1] do\n  break nowhere\nend",
+	}
+
+	for _, input := range inputs {
+		evaluated := testEval(input)
+		if !isError(evaluated) {
+			t.Errorf("Expected an error for %q, got %T (%+v)", input, evaluated, evaluated)
+		}
+	}
+}
+
+func TestForLoopVariableKeepsDeclaredType(t *testing.T) {
+	inputs := []string{
+		"x: string = \"a\"\nfor x in [1, 2] do\n  puts x\nend",
+		"x: string = \"a\"\nfor x in 1..2 do\nend",
+		"k: int = 0\nfor k in {\"a\": 1} do\nend",
+		"v: string = \"a\"\nfor k, v in {\"a\": 1} do\nend",
+	}
+
+	for _, input := range inputs {
+		evaluated := testEval(input)
+		errVal, ok := evaluated.(*ErrorValue)
+		if !ok || errVal.Kind != TypeError {
+			t.Errorf("Expected a type error for %q, got %T (%+v)", input, evaluated, evaluated)
+		}
+	}
+
+	// An element of the declared type is bound as usual
+	evaluated := testEval("x: string = \"a\"\nfor x in [\"b\", \"c\"] do\nend\nx")
+	if str, ok := evaluated.(*StringValue); !ok || str.Value != "c" {
+		t.Errorf("Expected x to be c after the loop, got %T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestMacroGeneratesFunctions(t *testing.T) {
+	input := `
+macro constants(a: int, b: int) do
+  return "def one() do
+    return " + to_string(a) + "
+  end
+  def two() do
+    return " + to_string(b) + "
+  end"
+end
+
+constants(1, 2)
+one() * 10 + two()
+`
+
+	testIntegerValue(t, testEval(input), 12)
+
+	evaluated := testEval("macro broken() do\n  return 42\nend\nbroken()")
+	if !isError(evaluated) {
+		t.Errorf("Expected an error for a macro that returns no source, got %T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestArrayLiteralPropagatesErrors(t *testing.T) {
+	evaluated := testEval("[1, undefined_var, 3]")
+
+	errVal, ok := evaluated.(*ErrorValue)
+	if !ok {
+		t.Fatalf("Expected an ErrorValue, got %T (%+v)", evaluated, evaluated)
+	}
+	if !strings.Contains(errVal.Message, "undefined_var") {
+		t.Errorf("Unexpected error message: %q", errVal.Message)
+	}
+}
+
+func TestValueTypeConstants(t *testing.T) {
+	tests := []struct {
+		value    Value
+		expected string
+	}{
+		{&IntegerValue{Value: 1}, INTEGER_OBJ},
+		{&FloatValue{Value: 1.5}, FLOAT_OBJ},
+		{&StringValue{Value: "s"}, STRING_OBJ},
+		{&BooleanValue{Value: true}, BOOLEAN_OBJ},
+		{&NilValue{}, NIL_OBJ},
+		{&ReturnValue{Value: &NilValue{}}, RETURN_OBJ},
+		{&ErrorValue{Message: "Error: boom"}, ERROR_OBJ},
+		{&BreakValue{}, BREAK_OBJ},
+		{&ContinueValue{}, CONTINUE_OBJ},
+		{&ExitValue{}, EXIT_OBJ},
+		{&FunctionValue{}, FUNCTION_OBJ},
+		{&ArrayValue{}, ARRAY_OBJ},
+		{&RangeValue{}, RANGE_OBJ},
+		{NewMapValue(), MAP_OBJ},
+		{&BuiltinFunction{}, BUILTIN_OBJ},
+		{&ClassValue{}, CLASS_OBJ},
+		{&ObjectValue{}, OBJECT_OBJ},
+	}
+
+	for _, tt := range tests {
+		if tt.value.Type() != tt.expected {
+			t.Errorf("%T.Type() = %q, want %q", tt.value, tt.value.Type(), tt.expected)
+		}
+	}
+}
+
+func TestSpaceshipOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"1 <=> 2", -1},
+		{"2 <=> 2", 0},
+		{"3 <=> 2.5", 1},
+		{`"apple" <=> "banana"`, -1},
+	}
+
+	for _, tt := range tests {
+		testIntegerValue(t, testEval(tt.input), tt.expected)
+	}
+}
+
+// newVersionClass builds a Comparable class whose instances order by their "n" property
+func newVersionClass() *ClassValue {
+	class := &ClassValue{
+		Name:       "Version",
+		Methods:    make(map[string]*FunctionValue),
+		Properties: make(map[string]Value),
+	}
+	class.Methods["<=>"] = &FunctionValue{
+		Name: "<=>",
+		BuiltinFunc: func(args []Value) Value {
+			self := args[0].(*ObjectValue).Properties["n"].(*IntegerValue)
+			other := args[1].(*ObjectValue).Properties["n"].(*IntegerValue)
+			return &IntegerValue{Value: self.Value - other.Value}
+		},
+	}
+	return class
+}
+
+func TestSortComparableInstances(t *testing.T) {
+	class := newVersionClass()
+	version := func(n int) *ObjectValue {
+		return &ObjectValue{Class: class, Properties: map[string]Value{"n": &IntegerValue{Value: n}}}
+	}
+
+	interp := New()
+	interp.env.Set("versions", &ArrayValue{Elements: []Value{version(3), version(1), version(2)}})
+	interp.env.Set("older", version(1))
+	interp.env.Set("newer", version(2))
+
+	program, errors := parser.Parse(lexer.New("sort(versions)"))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	sorted, ok := interp.Eval(program).(*ArrayValue)
+	if !ok {
+		t.Fatalf("Expected an array from sort")
+	}
+	for idx, expected := range []int{1, 2, 3} {
+		testIntegerValue(t, sorted.Elements[idx].(*ObjectValue).Properties["n"], expected)
+	}
+
+	// Comparison operators dispatch to <=> as well
+	program, _ = parser.Parse(lexer.New("older < newer"))
+	testBooleanValue(t, interp.Eval(program), true)
+
+	program, _ = parser.Parse(lexer.New("older >= newer"))
+	testBooleanValue(t, interp.Eval(program), false)
+}
+
+func TestSortVibeComparableClass(t *testing.T) {
+	class := `class Version do
+  @major: int = 0
+
+  def with(major: int): Version do
+    @major = major
+    return self
+  end
+
+  def <=>(other): int do
+    @major <=> other.major
+  end
+end
+`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"sort([Version.new().with(3), Version.new().with(1), Version.new().with(2)]).map do |v|\n  v.major\nend", "[1, 2, 3]"},
+		{"Version.new().with(1) < Version.new().with(2)", "true"},
+		{"Version.new().with(2) <=> Version.new().with(2)", "0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(class + tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestSortRejectsIncomparableValues(t *testing.T) {
+	evaluated := testEval(`sort([1, "a"])`)
+	if !isError(evaluated) {
+		t.Errorf("Expected an error sorting mixed values, got %T (%+v)", evaluated, evaluated)
+	}
+
+	interp := New()
+	interp.env.Set("p", &ObjectValue{Class: &ClassValue{Name: "Plain", Methods: map[string]*FunctionValue{}}})
+	program, _ := parser.Parse(lexer.New("p < p"))
+	if result := interp.Eval(program); !isError(result) {
+		t.Errorf("Expected an error comparing objects without <=>, got %T (%+v)", result, result)
+	}
+}
+
+func TestMixedNumberComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		// An int and a float compare by value, whichever side each is on
+		{"5 == 5.0", true},
+		{"5.0 == 5", true},
+		{"5 != 5.0", false},
+		{"5 == 5.5", false},
+		{"5 != 5.5", true},
+		{"5 < 5.5", true},
+		{"5.5 < 5", false},
+		{"5 <= 5.0", true},
+		{"6 > 5.5", true},
+		{"[1, 2.0] == [1.0, 2]", true},
+	}
+
+	for _, tt := range tests {
+		testBooleanValue(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestAbs(t *testing.T) {
+	testIntegerValue(t, testEval("abs(-5)"), 5)
+	testIntegerValue(t, testEval("abs(5)"), 5)
+	testIntegerValue(t, testEval("abs(0)"), 0)
+
+	result, ok := testEval("abs(-2.5)").(*FloatValue)
+	if !ok || result.Value != 2.5 {
+		t.Errorf("Expected abs(-2.5) to be 2.5, got %+v", result)
+	}
+
+	errVal, ok := testEval(`abs("5")`).(*ErrorValue)
+	if !ok || errVal.Kind != TypeError {
+		t.Errorf("Expected a type error for abs of a string, got %+v", errVal)
+	}
+}
+
+func TestPowerOperator(t *testing.T) {
+	testIntegerValue(t, testEval("2 ** 10"), 1024)
+	testIntegerValue(t, testEval("2 ** 3 ** 2"), 512)
+	testIntegerValue(t, testEval("-2 ** 2"), -4)
+
+	floatTests := []struct {
+		input    string
+		expected float64
+	}{
+		{"2 ** -1", 0.5},
+		{"2.0 ** 3", 8.0},
+		{"4 ** 0.5", 2.0},
+	}
+
+	for _, tt := range floatTests {
+		evaluated := testEval(tt.input)
+		result, ok := evaluated.(*FloatValue)
+		if !ok {
+			t.Errorf("Input %q: expected a FloatValue, got %T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if result.Value != tt.expected {
+			t.Errorf("Input %q: expected %g, got %g", tt.input, tt.expected, result.Value)
+		}
+	}
+
+	for _, input := range []string{"0 ** -1", "0.0 ** -2"} {
+		if evaluated := testEval(input); !isError(evaluated) {
+			t.Errorf("Input %q: expected a domain error, got %T (%+v)", input, evaluated, evaluated)
+		}
+	}
+}
+
+func TestIntegerOverflow(t *testing.T) {
+	// Results right at the int64 boundary still fit
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"9223372036854775807", math.MaxInt64},
+		{"9223372036854775806 + 1", math.MaxInt64},
+		{"-9223372036854775807 - 1", math.MinInt64},
+		{"-9223372036854775807 + -1", math.MinInt64},
+		{"4611686018427387904 * -2", math.MinInt64},
+		{"(-2) ** 63", math.MinInt64},
+		{"3037000499 * 3037000499", 9223372030926249001},
+		{"9223372036854775807 + -9223372036854775807", 0},
+	}
+
+	for _, tt := range tests {
+		if !testIntegerValue(t, testEval(tt.input), tt.expected) {
+			t.Errorf("Failed test for input: %s", tt.input)
+		}
+	}
+
+	// One step past it is an error rather than wrapping around
+	overflows := []string{
+		"9223372036854775807 + 1",
+		"-9223372036854775807 - 2",
+		"9223372036854775807 - -1",
+		"4611686018427387904 * 2",
+		"3037000500 * 3037000500",
+		"-9223372036854775807 * -9223372036854775807",
+		"2 ** 63",
+		"10 ** 19",
+		"x = -9223372036854775807 - 1\nx / -1",
+		"x = -9223372036854775807 - 1\nx * -1",
+		"x = -9223372036854775807 - 1\ny = -x",
+		"x = 9223372036854775807\nx += 1\nx",
+	}
+
+	for _, input := range overflows {
+		evaluated := testEval(input)
+		errVal, ok := evaluated.(*ErrorValue)
+		if !ok {
+			t.Errorf("Input %q: expected an overflow error, got %T (%+v)", input, evaluated, evaluated)
+			continue
+		}
+		if !strings.Contains(errVal.Message, "integer overflow") {
+			t.Errorf("Input %q: unexpected error message %q", input, errVal.Message)
+		}
+	}
+
+	// Too large to even write down
+	if _, errors := parser.Parse(lexer.New("9223372036854775808")); len(errors) == 0 {
+		t.Errorf("Expected an error for an integer literal beyond int64")
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	// Test a simple return statement that should work
 	input := "return 5;"
@@ -173,6 +784,29 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" < "b"`, true},
+		{`"b" < "a"`, false},
+		{`"b" <= "b"`, true},
+		{`"b" >= "c"`, false},
+		{`"abc" > "ab"`, true},
+		{`"apple" < "banana"`, true},
+		// Comparison is case-sensitive: uppercase sorts before lowercase
+		{`"Z" < "a"`, true},
+		{`"a" < "B"`, false},
+	}
+
+	for _, tt := range tests {
+		if !testBooleanValue(t, testEval(tt.input), tt.expected) {
+			t.Errorf("Failed test for input: %s", tt.input)
+		}
+	}
+}
+
 // For now, we'll skip the array test since we haven't fully implemented it yet
 
 func TestTypeSystem(t *testing.T) {
@@ -221,6 +855,1989 @@ func TestTypeSystem(t *testing.T) {
 	}
 }
 
+func TestOptionalChaining(t *testing.T) {
+	// Reading a field through '?.' on a nil receiver yields nil
+	evaluated := testEval("obj = nil\nobj?.x")
+	testNilValue(t, evaluated)
+
+	// Calling a method through '?.' on a nil receiver yields nil
+	evaluated = testEval("obj = nil\nobj?.get_x()")
+	testNilValue(t, evaluated)
+
+	// On a real instance '?.' behaves like '.'
+	evaluated = testEval("obj = Point.new(3, 4)\nobj?.x")
+	testIntegerValue(t, evaluated, 3)
+
+	evaluated = testEval("obj = Point.new(3, 4)\nobj?.get_y()")
+	testIntegerValue(t, evaluated, 4)
+}
+
+func TestBlockInvokedPerElement(t *testing.T) {
+	// The block adds each element it's handed to seen, a variable of the
+	// scope it was defined in
+	input := `seen = ""
+each([1, 2, 3]) do |x|
+  seen += x
+end
+seen`
+
+	evaluated := testEval(input)
+	if str, ok := evaluated.(*StringValue); !ok || str.Value != "123" {
+		t.Errorf("Expected the block to see 1, 2 and 3 in turn, got %T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestBlockScope(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{} // nil when the variable should be unknown
+	}{
+		{"sum = 0\n[1, 2, 3].each do |x|\n  sum += x\nend\nsum", 6},
+		{"def total() do\n  t = 0\n  [1, 2].each do |n|\n    t += n\n  end\n  t\nend\ntotal()", 3},
+		// Blocks nested in blocks reach the same variables
+		{"n = 0\n2.times do |i|\n  [1, 2].each do |x|\n    n += x\n  end\nend\nn", 6},
+		// A parameter shadows a variable of the same name
+		{"x = 100\n[1].each do |x|\n  x = 5\nend\nx", 100},
+		// A variable the block introduces stays inside it
+		{"[1].each do |v|\n  fresh = v\nend\nfresh", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if expected, ok := tt.expected.(int); ok {
+			if !testIntegerValue(t, evaluated, expected) {
+				t.Errorf("Failed test for input: %q", tt.input)
+			}
+		} else if !isError(evaluated) {
+			t.Errorf("Input %q: expected an unknown variable error, got %T (%+v)", tt.input, evaluated, evaluated)
+		}
+	}
+
+	// A typed variable keeps its type when a block assigns to it
+	if evaluated := testEval("n: int = 0\n[1].each do |x|\n  n = \"s\"\nend"); !isError(evaluated) {
+		t.Errorf("Expected a type error, got %T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestEach(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // What the block is handed, in order
+		result   string
+	}{
+		{"each([1, 2, 3]) do |x|\n  seen += x\nend", "123", "[1, 2, 3]"},
+		{"[1, 2, 3].each do |x|\n  seen += x\nend", "123", "[1, 2, 3]"},
+		{`"abc".each do |c|` + "\n  seen += c\nend", "abc", "abc"},
+		{`each("hi") do |c|` + "\n  seen += c\nend", "hi", "hi"},
+		// A map hands over each key, in insertion order
+		{`{"b": 1, "a": 2}.each do |k|` + "\n  seen += k\nend", "ba", "{b: 1, a: 2}"},
+		{"[].each do |x|\n  seen += x\nend", "", "[]"},
+		// The collection comes back, so calls can be chained
+		{"[1, 2].each do |x|\n  seen += x\nend.length", "12", "2"},
+	}
+
+	for _, tt := range tests {
+		// The block collects what it's handed in seen
+		input := "seen = \"\"\n" + tt.input
+
+		evaluated := testEval(input)
+		if isError(evaluated) {
+			t.Errorf("Input %q: unexpected error %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if evaluated.Inspect() != tt.result {
+			t.Errorf("Input %q: expected result %s, got %s", tt.input, tt.result, evaluated.Inspect())
+		}
+		if seen := testEval(input + "\nseen"); seen.Inspect() != tt.expected {
+			t.Errorf("Input %q: expected the block to see %q, got %s", tt.input, tt.expected, seen.Inspect())
+		}
+	}
+
+	// Errors raised by the callback stop the iteration
+	evaluated := testEval(`{"a": 1}.each do |k|` + "\n  raise(\"bad key\")\nend")
+	if errVal, ok := evaluated.(*ErrorValue); !ok || errVal.Message != "Error: bad key" {
+		t.Errorf("Expected the callback's error, got %T (%+v)", evaluated, evaluated)
+	}
+
+	if evaluated := testEval("5.each do |x|\n  x\nend"); !isError(evaluated) {
+		t.Errorf("Expected an error calling each on an int, got %T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestMap(t *testing.T) {
+	double := "def double(x: int): int do\n  x * 2\nend\n"
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{double + "map([1, 2, 3], double)", "[2, 4, 6]"},
+		{double + "[1, 2, 3].map(double)", "[2, 4, 6]"},
+		{"[1, 2, 3].map do |x|\n  x * x\nend", "[1, 4, 9]"},
+		{"map(1..3) do |n|\n  n + 1\nend", "[2, 3, 4]"},
+		{`["a", "b"].map do |s|` + "\n  s.upcase()\nend", "[A, B]"},
+		{"[].map do |x|\n  x\nend", "[]"},
+		// Calls on literals chain like calls on variables
+		{double + "[1, 2].map(double).map(double)", "[4, 8]"},
+		{double + "[1, 2, 3].map(double).length", "3"},
+		{`"a,b".split(",").map do |s|` + "\n  s + s\nend", "[aa, bb]"},
+		{`{"a": 1, "b": 2}.size()`, "2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if isError(evaluated) {
+			t.Errorf("Input %q: unexpected error %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// Errors raised by the callback stop the mapping
+	evaluated := testEval(double + `[1, "a"].map(double)`)
+	if errVal, ok := evaluated.(*ErrorValue); !ok || errVal.Kind != TypeError {
+		t.Errorf("Expected the callback's type error, got %T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestEachWithIndex(t *testing.T) {
+	input := `sum = 0
+each_with_index([4, 5, 6]) do |x, idx|
+  sum += idx * x
+end`
+
+	testNilValue(t, testEval(input))
+
+	// 0*4 + 1*5 + 2*6
+	testIntegerValue(t, testEval(input+"\nsum"), 17)
+
+	// Errors raised by the callback stop the iteration
+	evaluated := testEval(`each_with_index([1, 2]) do |x, idx|
+  x / nil
+end`)
+	if !isError(evaluated) {
+		t.Errorf("Expected the callback's error, got %T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestTimes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int // Sum of the indices passed to the block
+	}{
+		{"times(5) do |i|\n  sum += i\nend", 10},
+		{"5.times do |i|\n  sum += i\nend", 10},
+		{"n = 4\nn.times() do |i|\n  sum += i * 2\nend", 12},
+		{"0.times do |i|\n  sum += 1\nend", 0},
+		{"times(-3) do |i|\n  sum += 1\nend", 0},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval("sum = 0\n" + tt.input + "\nsum")
+		if !testIntegerValue(t, evaluated, tt.expected) {
+			t.Errorf("%q: expected sum %d", tt.input, tt.expected)
+		}
+	}
+
+	// times returns its count, and errors from the block stop it
+	testIntegerValue(t, testEval("3.times do |i|\n  i\nend"), 3)
+	evaluated := testEval("3.times do |i|\n  i / nil\nend")
+	if !isError(evaluated) {
+		t.Errorf("Expected the block's error, got %T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestStoredFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"def double(x) do\n  return x * 2\nend\nfns = [double]\nfns[0](4)", 8},
+		{`def double(x) do
+  return x * 2
+end
+def square(x) do
+  return x * x
+end
+handlers = {"double": double, "square": square}
+handlers["double"](5) + handlers["square"](3)`, 19},
+		{"def add(a, b) do\n  return a + b\nend\nf = add\nf(2, 3)", 5},
+		{`h = {"len": len}` + "\n" + `h["len"]("abcd")`, 4},
+		// Stored, a function without parameters is called only through its index
+		{"def seven() do\n  return 7\nend\nx = [seven]\nx[0]()", 7},
+		// As a statement of its own, a bare name still calls it
+		{"def seven() do\n  return 7\nend\nseven", 7},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if !testIntegerValue(t, evaluated, tt.expected) {
+			t.Errorf("Failed test for input: %s", tt.input)
+		}
+	}
+
+	evaluated := testEval("fns = [1]\nfns[0](2)")
+	if !isError(evaluated) {
+		t.Errorf("Expected an error calling a number, got %T (%+v)", evaluated, evaluated)
+	}
+
+	// An array of functions has a type like any other array
+	arrays := []struct {
+		input    string
+		expected string
+	}{
+		{"def f(x: int): int do\n  return x\nend\n[f, f]", "Array<def(any) -> int>"},
+		{"def f(x: int): int do\n  return x\nend\n[f, 1]", "Array<any>"},
+		{"def f(x: int): int do\n  return x\nend\ntype([f, 1])", ""},
+	}
+	for _, tt := range arrays {
+		evaluated := testEval(tt.input)
+		if isError(evaluated) {
+			t.Errorf("Input %q: unexpected error %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if tt.expected != "" && evaluated.VibeType().String() != tt.expected {
+			t.Errorf("Input %q: expected type %s, got %s", tt.input, tt.expected, evaluated.VibeType().String())
+		}
+	}
+
+	// Storing a handler doesn't run it; calling it through the map does
+	var out bytes.Buffer
+	interp := New()
+	interp.SetOutput(&out)
+	program, errors := parser.Parse(lexer.New(`def on_click(): void do
+  puts "clicked"
+end
+handlers = {"click": on_click}
+listeners = [on_click]
+handler = on_click
+handlers["click"]`))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+	result := interp.Eval(program)
+	if _, ok := result.(*FunctionValue); !ok {
+		t.Fatalf("Expected the map to hold a function, got %T (%+v)", result, result)
+	}
+	if out.Len() > 0 {
+		t.Errorf("Expected storing the handler not to call it, got output %q", out.String())
+	}
+
+	program, errors = parser.Parse(lexer.New(`handlers["click"]()` + "\nlisteners[0]()\nhandler()"))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+	if result := interp.Eval(program); isError(result) {
+		t.Fatalf("Unexpected error: %s", result.Inspect())
+	}
+	if out.String() != "clicked\nclicked\nclicked\n" {
+		t.Errorf("Expected each call to run the handler once, got %q", out.String())
+	}
+}
+
+func TestToArray(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []Value
+	}{
+		{"to_array(1..5)", []Value{
+			&IntegerValue{Value: 1}, &IntegerValue{Value: 2}, &IntegerValue{Value: 3},
+			&IntegerValue{Value: 4}, &IntegerValue{Value: 5},
+		}},
+		{`to_array("abc")`, []Value{
+			&StringValue{Value: "a"}, &StringValue{Value: "b"}, &StringValue{Value: "c"},
+		}},
+		{"to_array(3..1)", []Value{}},
+		// A range ending at the largest int stops there rather than wrapping
+		{"to_array(9223372036854775806..9223372036854775807)", []Value{
+			&IntegerValue{Value: math.MaxInt - 1}, &IntegerValue{Value: math.MaxInt},
+		}},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		array, ok := evaluated.(*ArrayValue)
+		if !ok {
+			t.Errorf("Input %q: expected an ArrayValue, got %T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if array.Inspect() != (&ArrayValue{Elements: tt.expected}).Inspect() {
+			t.Errorf("Input %q: expected %s, got %s", tt.input,
+				(&ArrayValue{Elements: tt.expected}).Inspect(), array.Inspect())
+		}
+	}
+
+	if evaluated := testEval("to_array(3)"); !isError(evaluated) {
+		t.Errorf("Expected an error converting an integer, got %T (%+v)", evaluated, evaluated)
+	}
+
+	// Loops over such a range end too, whether it's written in place or held
+	// in a variable
+	inputs := []string{
+		"count = 0\nfor n in 9223372036854775806..9223372036854775807 do\n  count += 1\nend\ncount",
+		"r = 9223372036854775806..9223372036854775807\ncount = 0\nfor n in r do\n  count += 1\nend\ncount",
+	}
+	for _, input := range inputs {
+		testIntegerValue(t, testEval(input), 2)
+	}
+}
+
+func TestRangesAndStringsAcceptedAsArrays(t *testing.T) {
+	interp := New()
+
+	// A builtin declared to take an array receives the converted elements
+	interp.env.RegisterBuiltin("sum", func(args []Value) Value {
+		total := 0
+		for _, element := range args[0].(*ArrayValue).Elements {
+			total += element.(*IntegerValue).Value
+		}
+		return &IntegerValue{Value: total}
+	}, []types.Type{types.ArrayType{ElementType: types.IntType}}, types.IntType)
+
+	program, errors := parser.Parse(lexer.New("sum(1..4)"))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+	testIntegerValue(t, interp.Eval(program), 10)
+
+	// Ranges stored in variables can be iterated
+	testIntegerValue(t, testEval("r = 1..3\ntotal = 0\nfor x in r do\n  total = total + x\nend\ntotal"), 6)
+
+	sorted, ok := testEval(`sort("cab")`).(*ArrayValue)
+	if !ok || sorted.Inspect() != "[a, b, c]" {
+		t.Errorf("Expected sort to accept a string, got %+v", sorted)
+	}
+}
+
+func TestToIntWithBase(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{`to_int("ff", 16)`, 255},
+		{`to_int("FF", 16)`, 255},
+		{`to_int("101", 2)`, 5},
+		{`to_int("z", 36)`, 35},
+		{`to_int("42")`, 42},
+	}
+
+	for _, tt := range tests {
+		testIntegerValue(t, testEval(tt.input), tt.expected)
+	}
+
+	for _, input := range []string{`to_int("102", 2)`, `to_int("ff", 10)`, `to_int("1", 1)`, `to_int("1", 37)`} {
+		if evaluated := testEval(input); !isError(evaluated) {
+			t.Errorf("Input %q: expected an error, got %T (%+v)", input, evaluated, evaluated)
+		}
+	}
+}
+
+func TestSlicing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Reversal
+		{"[1, 2, 3, 4, 5][::-1]", "[5, 4, 3, 2, 1]"},
+		{`"hello"[::-1]`, "olleh"},
+		// Positive step
+		{"[1, 2, 3, 4, 5, 6][1:5:2]", "[2, 4]"},
+		{`"abcdef"[0:6:3]`, "ad"},
+		// Omitted bounds with a step
+		{"[1, 2, 3, 4, 5][::2]", "[1, 3, 5]"},
+		{"[1, 2, 3, 4, 5][3::-1]", "[4, 3, 2, 1]"},
+		// Negative and out of range bounds are clamped
+		{"[1, 2, 3, 4, 5][-2:]", "[4, 5]"},
+		{"[1, 2, 3][-10:10]", "[1, 2, 3]"},
+		{"[1, 2, 3][5:]", "[]"},
+		// Steps too large to add to an index take just the first element
+		{"[1, 2, 3][1::9223372036854775807]", "[2]"},
+		{`"abc"[::9223372036854775807]`, "a"},
+		{"[1, 2, 3][1::-9223372036854775807]", "[2]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if isError(evaluated) {
+			t.Errorf("Input %q: unexpected error %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	if evaluated := testEval("[1, 2][::0]"); !isError(evaluated) {
+		t.Errorf("Expected an error for a zero step, got %T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestIndexing(t *testing.T) {
+	testIntegerValue(t, testEval("[1, 2, 3][0]"), 1)
+	testIntegerValue(t, testEval("[1, 2, 3][-1]"), 3)
+
+	if evaluated := testEval(`"abc"[1]`); evaluated.Inspect() != "b" {
+		t.Errorf("Expected b, got %s", evaluated.Inspect())
+	}
+
+	for _, input := range []string{"[1, 2, 3][3]", "[1, 2, 3][-4]", `[1, 2, 3]["a"]`} {
+		if evaluated := testEval(input); !isError(evaluated) {
+			t.Errorf("Input %q: expected an error, got %T (%+v)", input, evaluated, evaluated)
+		}
+	}
+}
+
+func TestMapEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`{"a": 1, "b": 2} == {"a": 1, "b": 2}`, true},
+		{`{"a": 1, "b": 2} == {"b": 2, "a": 1}`, true},
+		{`{"a": [1, {"x": 2}]} == {"a": [1, {"x": 2}]}`, true},
+		{`{} == {}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"a": 1, "b": 2}`, false},
+		{`{1: "a"} == {"1": "a"}`, false},
+		{`{"a": 1} != {"a": 2}`, true},
+		{`contains([{"a": 1}], {"a": 1})`, true},
+		{`contains({"a": 1}, "a")`, true},
+		{`contains({"a": 1}, 1)`, false},
+		// Values of different types differ even when they print the same,
+		// except for numbers
+		{`[1] == ["1"]`, false},
+		{`[nil] == ["nil"]`, false},
+		{`{"a": true} == {"a": "true"}`, false},
+		{`contains([1], "1")`, false},
+		{`"1" in [1]`, false},
+		{`nil == "nil"`, false},
+		{`[1] == [1.0]`, true},
+		// Ints compare exactly, even past where a float can tell them apart
+		{`[9007199254740993] == [9007199254740992]`, false},
+		{`{"a": 9007199254740993} == {"a": 9007199254740992}`, false},
+		{`9007199254740992 in [9007199254740993]`, false},
+		{`[9007199254740993] == [9007199254740993]`, true},
+		{`{"a": [nil, true]} == {"a": [nil, true]}`, true},
+	}
+
+	for _, tt := range tests {
+		testBooleanValue(t, testEval(tt.input), tt.expected)
+	}
+
+	testIntegerValue(t, testEval(`m = {"a": 1, 2: 3}`+"\n"+`m[2]`), 3)
+	testNilValue(t, testEval(`m = {"a": 1}`+"\n"+`m["b"]`))
+}
+
+func TestMapRejectsMapKeys(t *testing.T) {
+	for _, input := range []string{
+		`{{"a": 1}: 2}`,
+		`m = {"a": 1}` + "\n" + `m[{"a": 1}]`,
+		`contains({"a": 1}, {"a": 1})`,
+	} {
+		evaluated := testEval(input)
+		errVal, ok := evaluated.(*ErrorValue)
+		if !ok {
+			t.Errorf("Input %q: expected an error, got %T (%+v)", input, evaluated, evaluated)
+			continue
+		}
+		if !strings.Contains(errVal.Message, "map cannot be used as a map key") {
+			t.Errorf("Input %q: unexpected error message %q", input, errVal.Message)
+		}
+	}
+}
+
+func TestSizeMethods(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"[1, 2, 3].size()", 3},
+		{"[1, 2, 3].count()", 3},
+		{"[].size()", 0},
+		{`"abc".size()`, 3},
+		{`"abc".count()`, 3},
+		{`m = {"a": 1, "b": 2}` + "\n" + "m.size()", 2},
+		{`m = {"a": 1}` + "\n" + "m.count() + len(m)", 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerValue(t, testEval(tt.input), tt.expected)
+	}
+
+	for _, input := range []string{"[1].size(2)", "[1].missing()", "x = 5\nx.size()"} {
+		if evaluated := testEval(input); !isError(evaluated) {
+			t.Errorf("Input %q: expected an error, got %T (%+v)", input, evaluated, evaluated)
+		}
+	}
+}
+
+func TestValueProperties(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"[1, 2, 3].length", 3},
+		{"[].size", 0},
+		{`"abc".length`, 3},
+		{`"abc".count + 1`, 4},
+		{`m = {"a": 1, "b": 2}` + "\n" + "m.size", 2},
+		{"[1, 2].length()", 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerValue(t, testEval(tt.input), tt.expected)
+	}
+
+	errVal, ok := testEval("[1, 2].width").(*ErrorValue)
+	if !ok || errVal.Kind != NameError || !strings.Contains(errVal.Message, "Property width not found") {
+		t.Errorf("Expected a name error for an unknown property, got %+v", errVal)
+	}
+
+	errVal, ok = testEval("x = 5\nx.length").(*ErrorValue)
+	if !ok || errVal.Kind != TypeError {
+		t.Errorf("Expected a type error for a property of an int, got %+v", errVal)
+	}
+}
+
+func TestSliceBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"slice([1, 2, 3, 4, 5], 1, 3)", "[2, 3]"},
+		{"slice([1, 2, 3], 0, 3)", "[1, 2, 3]"},
+		{"slice([1, 2, 3], 2, 1)", "[]"},
+		// Out of range bounds are clamped
+		{"slice([1, 2, 3], 1, 10)", "[2, 3]"},
+		{"slice([1, 2, 3], -10, 2)", "[1, 2]"},
+		{"slice([1, 2, 3], 5, 8)", "[]"},
+		// Negative indices count from the end
+		{"slice([1, 2, 3, 4, 5], -3, -1)", "[3, 4]"},
+		{"slice([1, 2, 3, 4, 5], -2)", "[4, 5]"},
+		// Two arguments slice to the end
+		{"slice([1, 2, 3, 4], 1)", "[2, 3, 4]"},
+		// The input is left alone
+		{"a = [1, 2, 3]\nb = slice(a, 1)\na", "[1, 2, 3]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		array, ok := evaluated.(*ArrayValue)
+		if !ok {
+			t.Errorf("Input %q: expected an ArrayValue, got %T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if array.Inspect() != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, array.Inspect())
+		}
+	}
+
+	for _, input := range []string{"slice([1, 2])", "slice(5, 1)", `slice([1, 2], "a")`} {
+		if evaluated := testEval(input); !isError(evaluated) {
+			t.Errorf("Input %q: expected an error, got %T (%+v)", input, evaluated, evaluated)
+		}
+	}
+}
+
+func TestMapKeysAndEntries(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`keys({"z": 1, "a": 2, "m": 3})`, "[z, a, m]"},
+		{`entries({"z": 1, "a": 2, "m": 3})`, "[[z, 1], [a, 2], [m, 3]]"},
+		{`entries({1: "one", true: "yes"})`, "[[1, one], [true, yes]]"},
+		{"entries({})", "[]"},
+		// A repeated key keeps its first position but takes the later value
+		{`entries({"a": 1, "b": 2, "a": 3})`, "[[a, 3], [b, 2]]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		array, ok := evaluated.(*ArrayValue)
+		if !ok {
+			t.Errorf("Input %q: expected an ArrayValue, got %T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if array.Inspect() != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, array.Inspect())
+		}
+	}
+
+	// Iterating the entries visits each pair in insertion order
+	var out bytes.Buffer
+	interp := New()
+	interp.SetOutput(&out)
+	program, errors := parser.Parse(lexer.New(`m = {"z": 1, "a": 2}
+for pair in entries(m) do
+  puts pair[0] + "=" + to_string(pair[1])
+end`))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+	if result := interp.Eval(program); isError(result) {
+		t.Fatalf("Unexpected error: %s", result.Inspect())
+	}
+	if out.String() != "z=1\na=2\n" {
+		t.Errorf("Expected pairs in insertion order, got %q", out.String())
+	}
+
+	if evaluated := testEval("entries([1, 2])"); !isError(evaluated) {
+		t.Errorf("Expected an error for a non-map argument, got %T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestForLoopOverMap(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// One variable takes each key, in insertion order
+		{`names = ""
+for k in {"b": 1, "a": 2, "c": 3} do
+  names = names + k
+end
+names`, "bac"},
+		// Two variables take each key and its value
+		{`pairs = ""
+for k, v in {"b": 1, "a": 2} do
+  pairs = pairs + k + to_string(v)
+end
+pairs`, "b1a2"},
+		{`total = 0
+for k, v in {1: 10, 2: 20} do
+  total += k * v
+end
+to_string(total)`, "50"},
+		{`for k in {} do
+  x = 1
+end
+"done"`, "done"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*StringValue)
+		if !ok {
+			t.Errorf("Input %q: expected a StringValue, got %T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("Input %q: expected %q, got %q", tt.input, tt.expected, str.Value)
+		}
+	}
+
+	// Only maps have values to bind to a second variable
+	if evaluated := testEval("for a, b in [1, 2] do\nend"); !isError(evaluated) {
+		t.Errorf("Expected an error iterating an array with two variables, got %T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestDoWhile(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		// The body runs once even though the condition is false from the start
+		{"i = 10\ndo\n  i += 1\nend while i < 3\ni", 11},
+		{"i = 0\ndo\n  i += 1\nend while i < 5\ni", 5},
+		// continue skips ahead to the condition rather than past it
+		{"i = 0\nn = 0\ndo\n  i += 1\n  if i % 2 == 0\n    continue\n  end\n  n += 1\nend while i < 5\nn", 3},
+		{"i = 0\ndo\n  i += 1\n  if i == 4\n    break\n  end\nend while true\ni", 4},
+		{"def first_power(limit: int): int do\n  n = 1\n  do\n    n *= 2\n  end while n < limit\n  n\nend\nfirst_power(100)", 128},
+	}
+
+	for _, tt := range tests {
+		if !testIntegerValue(t, testEval(tt.input), tt.expected) {
+			t.Errorf("Failed test for input: %q", tt.input)
+		}
+	}
+
+	if evaluated := testEval("do\n  1\nend while missing"); !isError(evaluated) {
+		t.Errorf("Expected the condition's error, got %T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestIfAndLoopsAsExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{} // nil when the result should be nil
+	}{
+		{"x = if true do 1 else 2 end\nx", 1},
+		{"def f() do\n  x = if true do 1 else 2 end\n  return x\nend\nf()", 1},
+		{"x = 1\nx += if x > 0 do 10 else 20 end\nx", 11},
+		{"x = if false do 1 else 2 end\nx", 2},
+		{"n = 2\nx = if n > 2\n  3\nelsif n > 1\n  2\nelse\n  1\nend\nx", 2},
+		{"x = if false\n  1\nend\nx", nil},
+		// A loop evaluates to its last completed iteration
+		{"x = for n in [1, 2, 3] do\n  n * n\nend\nx", 9},
+		{"x = for n in 1..4 do\n  n + 10\nend\nx", 14},
+		{"i = 0\nx = while i < 3 do\n  i += 1\n  i * 10\nend\nx", 30},
+		{"x = for n in [1, 2, 3] do\n  if n == 3\n    continue\n  end\n  n\nend\nx", 2},
+		{"x = for n in [] do\n  n\nend\nx", nil},
+		{"x = for n in [1, 2] do\n  break\nend\nx", nil},
+		{"i = 0\nx = do\n  i += 1\n  i * 10\nend while i < 3\nx", 30},
+		// Functions without a return give back their last value
+		{"def sign_of(n) do\n  if n > 0\n    1\n  else\n    -1\n  end\nend\nsign_of(5)", 1},
+		{"def last_even(limit) do\n  for n in 1..limit do\n    n - n % 2\n  end\nend\nlast_even(7)", 6},
+		{`x = if 1 > 2 do "big" else "small" end` + "\nx", "small"},
+		// then works like do, reading better before a one-line branch
+		{`x = if 1 < 2 then "big" else "small" end` + "\nx", "big"},
+		{"n = -4\nx = if n < 0 then -n else n end\nx", 4},
+		{"n = 1\nx = if n > 1 then 3 elsif n > 0 then 2 else 1 end\nx", 2},
+		{"x = if false then 1 end\nx", nil},
+		// An if is an expression anywhere a value is
+		{"def f(c) do\n  return if c then 1 else 2 end\nend\nf(false)", 2},
+		{"c = true\n[if c then 1 else 2 end][0]", 1},
+		{`len(if true then "abc" else "" end)`, 3},
+		{"x = 1 + if true then 1 else 2 end\nx", 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			if !testIntegerValue(t, evaluated, expected) {
+				t.Errorf("Failed test for input: %q", tt.input)
+			}
+		case string:
+			if str, ok := evaluated.(*StringValue); !ok || str.Value != expected {
+				t.Errorf("Input %q: expected %q, got %T (%+v)", tt.input, expected, evaluated, evaluated)
+			}
+		default:
+			if !testNilValue(t, evaluated) {
+				t.Errorf("Failed test for input: %q", tt.input)
+			}
+		}
+	}
+}
+
+func TestElsifWithoutElse(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{} // nil when no branch should match
+	}{
+		{"x = 7\nif x > 10 do\n  1\nelsif x > 5 do\n  2\nend", 2},
+		{"x = 3\nif x > 10 do\n  1\nelsif x > 5 do\n  2\nelsif x > 1 do\n  3\nend", 3},
+		{"x = 11\nif x > 10\n  1\nelsif x > 5\n  2\nend", 1},
+		{"x = 0\nif x > 10 do\n  1\nelsif x > 5 do\n  2\nend", nil},
+		{"x = 0\ny = if x > 10 do\n  1\nelsif x > 5 do\n  2\nend\ny", nil},
+		{"def grade(n) do\n  if n >= 90 do\n    return 4\n  elsif n >= 80 do\n    return 3\n  end\n  return 0\nend\ngrade(85) * 10 + grade(20)", 30},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if expected, ok := tt.expected.(int); ok {
+			if !testIntegerValue(t, evaluated, expected) {
+				t.Errorf("Failed test for input: %q", tt.input)
+			}
+		} else if !testNilValue(t, evaluated) {
+			t.Errorf("Failed test for input: %q", tt.input)
+		}
+	}
+}
+
+func TestIndexAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a = [1, 2, 3]\na[0] = 10\na", "[10, 2, 3]"},
+		{"a = [1, 2, 3]\na[-1] = 30\na", "[1, 2, 30]"},
+		{"a = [1, 2, 3]\na[1] += 5\na", "[1, 7, 3]"},
+		{"a = [[1, 2], [3]]\na[0][1] = 9\na", "[[1, 9], [3]]"},
+		{`m = {"a": 1}` + "\n" + `m["b"] = 2` + "\n" + `m["a"] *= 5` + "\nm", "{a: 5, b: 2}"},
+		// Both names see the change, as arrays are shared rather than copied
+		{"a = [1, 2]\nb = a\nb[0] = 5\na", "[5, 2]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if isError(evaluated) {
+			t.Errorf("Input %q: unexpected error %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	for _, input := range []string{"a = [1]\na[1] = 2", `a = [1]` + "\n" + `a["x"] = 2`, `s = "ab"` + "\n" + `s[0] = "c"`, "m = {}\nm[[1]] = 2"} {
+		if evaluated := testEval(input); !isError(evaluated) {
+			t.Errorf("Input %q: expected an error, got %T (%+v)", input, evaluated, evaluated)
+		}
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	// Reads and other non-mutating operations work as usual
+	readTests := []struct {
+		input    string
+		expected string
+	}{
+		{"a = freeze([1, 2, 3])\na[1]", "2"},
+		{"a = freeze([1, 2, 3])\na[-1] + len(a)", "6"},
+		{"a = freeze([3, 1, 2])\nsort(a)", "[1, 2, 3]"},
+		{"a = freeze([1, 2, 3])\na[1:]", "[2, 3]"},
+		{"a = freeze([1, 2])\na == [1, 2]", "true"},
+		{`m = freeze({"a": 1, "b": 2})` + "\n" + `m["b"]`, "2"},
+		{`m = freeze({"a": 1, "b": 2})` + "\nkeys(m)", "[a, b]"},
+		// The original stays writable, and changing it leaves the frozen copy alone
+		{"a = [1, 2]\nf = freeze(a)\na[0] = 5\nto_string(a) + to_string(f)", "[5, 2][1, 2]"},
+		// Only the outer collection is frozen
+		{"a = freeze([[1], [2]])\na[0][0] = 5\na", "[[5], [2]]"},
+	}
+
+	for _, tt := range readTests {
+		evaluated := testEval(tt.input)
+		if isError(evaluated) {
+			t.Errorf("Input %q: unexpected error %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	writes := []string{
+		"a = freeze([1, 2])\na[0] = 5",
+		"a = freeze([1, 2])\na[0] += 1",
+		`m = freeze({"a": 1})` + "\n" + `m["a"] = 2`,
+		`m = freeze({"a": 1})` + "\n" + `m["new"] = 2`,
+	}
+
+	for _, input := range writes {
+		evaluated := testEval(input)
+		errVal, ok := evaluated.(*ErrorValue)
+		if !ok {
+			t.Errorf("Input %q: expected an error, got %T (%+v)", input, evaluated, evaluated)
+			continue
+		}
+		if !strings.Contains(errVal.Message, "cannot modify frozen collection") {
+			t.Errorf("Input %q: unexpected error message %q", input, errVal.Message)
+		}
+	}
+
+	if evaluated := testEval("freeze(5)"); !isError(evaluated) {
+		t.Errorf("Expected an error freezing an int, got %T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected ErrorKind
+	}{
+		{`1 + true`, TypeError},
+		{`len(5)`, TypeError},
+		{"missing_variable + 1", NameError},
+		{"[1, 2][5]", IndexError},
+		{`"abc"[-4]`, IndexError},
+		{"len()", ArgumentError},
+		{"def f(a) do\n  return a\nend\nf(1, 2)", ArgumentError},
+		{`to_int("ff", 99)`, ArgumentError},
+		{"10 / 0", DivisionByZero},
+		{"10 % 0", DivisionByZero},
+		{"9223372036854775807 + 1", OverflowError},
+		{"a = freeze([1])\na[0] = 2", FrozenError},
+		{`eval("x = (")`, SyntaxError},
+		{`eval("1 +")`, SyntaxError},
+		{`eval("1 + )")`, SyntaxError},
+		{"break", RuntimeError},
+		// An error in a method's receiver keeps its kind
+		{"(1 / 0).size()", DivisionByZero},
+		{"nope.size()", NameError},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errVal, ok := evaluated.(*ErrorValue)
+		if !ok {
+			t.Errorf("Input %q: expected an error, got %T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errVal.Kind != tt.expected {
+			t.Errorf("Input %q: expected kind %s, got %s (%s)", tt.input, tt.expected, errVal.Kind, errVal.Message)
+		}
+	}
+}
+
+func TestNilIsShared(t *testing.T) {
+	// Different ways of ending up with nil all give the one shared value
+	inputs := []string{
+		"nil",
+		"while false do\n  1\nend",
+		"if false do\n  1\nend",
+		`{"a": 1}["b"]`,
+		"x = nil\nx",
+		"def nothing(): void do\n  1\nend\nnothing()",
+	}
+
+	for _, input := range inputs {
+		evaluated := testEval(input)
+		if evaluated != Value(Nil) {
+			t.Errorf("Input %q: expected the shared nil, got %T (%+v)", input, evaluated, evaluated)
+		}
+	}
+
+	testBooleanValue(t, testEval("x = nil\ny = if false do\n  1\nend\nx == y"), true)
+}
+
+func TestBooleansAreShared(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected *BooleanValue
+	}{
+		{"true", True},
+		{"false", False},
+		{"1 < 2", True},
+		{"1.5 >= 2.5", False},
+		{`"a" == "a"`, True},
+		{"!true", False},
+		{"!nil", True},
+		{"1 == 1 && 2 > 3", False},
+		{"1 != 1 || true", True},
+		{"3 in [1, 2, 3]", True},
+		{`defined("missing")`, False},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated != Value(tt.expected) {
+			t.Errorf("Input %q: expected the shared %s, got %T (%+v)", tt.input, tt.expected.Inspect(), evaluated, evaluated)
+		}
+	}
+}
+
+func TestPrintingCyclicValues(t *testing.T) {
+	node := `class Node do
+  @next: any = nil
+  def link(other): void do
+    @next = other
+  end
+  def next_node(): any do
+    @next
+  end
+end
+n = Node.new()
+n.link(n)
+`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// A collection inside itself is cut short rather than written forever
+		{"a = [1, 2]\na[0] = a\na", "[[...], 2]"},
+		{`m = {"a": 1}` + "\n" + `m["self"] = m` + "\nm", "{a: 1, self: {...}}"},
+		{`a = [1]` + "\n" + `m = {"list": a}` + "\na[0] = m\na", "[{list: [...]}]"},
+		// The same collection twice over isn't a cycle
+		{"b = [1]\n[b, b]", "[[1], [1]]"},
+		// Instances that point back to themselves print as well
+		{node + "n.next_node() == n", "true"},
+		{node + "[n, n.next_node()]", "[Node instance, Node instance]"},
+		{node + "items = [n]\nn.link(items)\nitems[0].next_node()", "[Node instance]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if isError(evaluated) {
+			t.Errorf("Input %q: unexpected error %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+		if display := New().Display(evaluated); display != tt.expected {
+			t.Errorf("Input %q: expected display %s, got %s", tt.input, tt.expected, display)
+		}
+	}
+
+	// A cycle doesn't stop the array from having a type
+	evaluated := testEval("a = [1]\na[0] = a\na")
+	if got := evaluated.VibeType().String(); got != "Array<Array<any>>" {
+		t.Errorf("Expected Array<Array<any>>, got %s", got)
+	}
+}
+
+func TestComparingCyclicValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"a = [1]\na[0] = a\nb = [1]\nb[0] = b\na == b", true},
+		{"a = [1]\na[0] = a\na == a", true},
+		{"a = [1, 2]\na[0] = a\nb = [1, 3]\nb[0] = b\na == b", false},
+		{"a = [1, 2]\na[0] = a\nb = [1, 3]\nb[0] = b\na != b", true},
+		{`m = {"a": 1}` + "\n" + `m["self"] = m` + "\n" + `n = {"a": 1}` + "\n" + `n["self"] = n` + "\nm == n", true},
+		{`m = {"a": 1}` + "\n" + `m["self"] = m` + "\n" + `n = {"a": 2}` + "\n" + `n["self"] = n` + "\nm == n", false},
+		{"a = [1]\na[0] = a\nb = [1]\nb[0] = b\nb in [a]", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if !testBooleanValue(t, evaluated, tt.expected) {
+			t.Errorf("Failed test for input: %s", tt.input)
+		}
+	}
+}
+
+func TestIterableObjects(t *testing.T) {
+	// Countdown hands out its elements one at a time through next
+	countdown := `class Countdown do
+  @n: int = 0
+
+  def start(n: int): Countdown do
+    @n = n
+    self
+  end
+
+  def next(): int || nil do
+    if @n == 0 do
+      return nil
+    end
+    @n -= 1
+    @n + 1
+  end
+end
+`
+	// Bag hands over a collection to iterate in its place through iter
+	bag := `class Bag do
+  @items: Array<string> = ["a", "b", "c"]
+
+  def iter(): any do
+    @items
+  end
+end
+`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{countdown + "total = 0\nfor x in Countdown.new().start(3) do\n  total = total * 10 + x\nend\ntotal", "321"},
+		{countdown + "total = 0\nfor x in Countdown.new() do\n  total += 1\nend\ntotal", "0"},
+		// Loops over objects are expressions like any other loop
+		{countdown + "for x in Countdown.new().start(4) do\n  x * 10\nend", "10"},
+		{countdown + "seen = 0\nfor x in Countdown.new().start(5) do\n  if x == 4\n    continue\n  end\n  if x == 2\n    break\n  end\n  seen = seen * 10 + x\nend\nseen", "53"},
+		{bag + `s = ""` + "\nfor item in Bag.new() do\n  s = s + item\nend\ns", "abc"},
+		// iter can hand over another object that has next
+		{countdown + "class Launch do\n  def iter(): any do\n    Countdown.new().start(2)\n  end\nend\ntotal = 0\nfor x in Launch.new() do\n  total += x\nend\ntotal", "3"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if isError(evaluated) {
+			t.Errorf("Input %q: unexpected error %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input   string
+		message string
+	}{
+		{"class Plain do\nend\nfor x in Plain.new() do\n  x\nend", "Type error: Plain is not Iterable (no iter or next method)"},
+		{countdown + "for k, v in Countdown.new().start(1) do\n  k\nend", "Type error: cannot iterate over Countdown with two variables"},
+		{"class Broken do\n  def next(): any do\n    raise(\"no more\")\n  end\nend\nfor x in Broken.new() do\n  x\nend", "Error: no more"},
+	}
+
+	for _, tt := range errorTests {
+		errVal, ok := testEval(tt.input).(*ErrorValue)
+		if !ok || errVal.Message != tt.message {
+			t.Errorf("Input %q: expected error %q, got %+v", tt.input, tt.message, errVal)
+		}
+	}
+}
+
+func TestHoisting(t *testing.T) {
+	// A function can be called above its definition
+	testIntegerValue(t, testEval(`x = double(21)
+def double(n: int): int do
+  return n * 2
+end
+x`), 42)
+
+	// Functions that call each other, both used before they're defined
+	input := `result = is_even(10) && is_odd(7)
+def is_even(n: int): bool do
+  if n == 0 do
+    return true
+  end
+  return is_odd(n - 1)
+end
+def is_odd(n: int): bool do
+  if n == 0 do
+    return false
+  end
+  return is_even(n - 1)
+end
+result`
+	testBooleanValue(t, testEval(input), true)
+
+	// So can a class
+	testIntegerValue(t, testEval("b = Box.new()\nclass Box do\n  @size: int = 3\nend\nb.size"), 3)
+
+	// Only the first definition is hoisted; a later one takes over when reached
+	input = `a = f()
+def f(): int do
+  return 1
+end
+b = f()
+def f(): int do
+  return 2
+end
+a * 10 + b * 100 + f()`
+	testIntegerValue(t, testEval(input), 112)
+}
+
+func TestRaiseAndPanic(t *testing.T) {
+	// raise is caught like any other error
+	input := `try do
+  raise("disk full")
+rescue RuntimeError as e do
+  e["message"]
+end`
+	evaluated := testEval(input)
+	if str, ok := evaluated.(*StringValue); !ok || str.Value != "Error: disk full" {
+		t.Errorf("Expected the raised message, got %T (%+v)", evaluated, evaluated)
+	}
+
+	// panic goes straight past every rescue, even from inside a function
+	inputs := []string{
+		"try do\n  panic(\"disk gone\")\nrescue\n  1\nend",
+		"try do\n  panic(\"disk gone\")\nrescue RuntimeError do\n  1\nend",
+		"def f() do\n  panic(\"disk gone\")\nend\ntry do\n  try do\n    f()\n  rescue\n    1\n  end\nrescue\n  2\nend",
+	}
+	for _, input := range inputs {
+		evaluated := testEval(input)
+		errVal, ok := evaluated.(*ErrorValue)
+		if !ok || !errVal.Fatal || errVal.Message != "Panic: disk gone" {
+			t.Errorf("Input %q: expected the panic to go unhandled, got %T (%+v)", input, evaluated, evaluated)
+		}
+	}
+
+	if errVal, ok := testEval(`raise("x")`).(*ErrorValue); !ok || errVal.Fatal {
+		t.Errorf("Expected raise to give a recoverable error, got %+v", errVal)
+	}
+}
+
+func TestTryRescue(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// No error: the try block's value
+		{"try do\n  5\nrescue do\n  0\nend", 5},
+		// A bare rescue handles any kind
+		{"try do\n  1 / 0\nrescue do\n  -1\nend", -1},
+		// A matching kind is caught
+		{"try do\n  1 + true\nrescue TypeError do\n  2\nend", 2},
+		// Clauses are tried in order, skipping ones of another kind
+		{"try do\n  1 + true\nrescue DivisionByZero do\n  1\nrescue TypeError do\n  2\nrescue do\n  3\nend", 2},
+		{"try do\n  [1][3]\nrescue TypeError do\n  1\nrescue do\n  3\nend", 3},
+		// The bound error says what went wrong
+		{"try do\n  missing\nrescue NameError as e do\n  e[\"kind\"] == \"NameError\"\nend", true},
+		{"try\n  1 / 0\nrescue as e\n  e[\"message\"]\nend", "Error: division by zero"},
+		// Errors raised inside a called function are caught too
+		{"def f() do\n  return 1 / 0\nend\ntry do\n  f()\nrescue DivisionByZero do\n  7\nend", 7},
+		{"try do\n  (1 / 0).size()\nrescue DivisionByZero do\n  8\nend", 8},
+		// Source that doesn't parse is a SyntaxError, even missing an operand
+		{"try do\n  eval(\"1 +\")\nrescue SyntaxError do\n  9\nend", 9},
+		{"try do\n  eval(\"1 + )\")\nrescue SyntaxError do\n  9\nend", 9},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerValue(t, evaluated, expected)
+		case bool:
+			testBooleanValue(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*StringValue)
+			if !ok || str.Value != expected {
+				t.Errorf("Input %q: expected %q, got %+v", tt.input, expected, evaluated)
+			}
+		}
+	}
+
+	// An error no clause matches passes through unchanged
+	passedThrough := []struct {
+		input    string
+		expected ErrorKind
+	}{
+		{"try do\n  1 + true\nrescue DivisionByZero do\n  0\nend", TypeError},
+		{"try do\n  1 / 0\nrescue TypeError as e do\n  0\nrescue IndexError do\n  0\nend", DivisionByZero},
+		{"try do\n  1 / 0\nrescue NoSuchKind do\n  0\nend", NameError},
+	}
+
+	for _, tt := range passedThrough {
+		evaluated := testEval(tt.input)
+		errVal, ok := evaluated.(*ErrorValue)
+		if !ok {
+			t.Errorf("Input %q: expected an error, got %T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errVal.Kind != tt.expected {
+			t.Errorf("Input %q: expected kind %s, got %s (%s)", tt.input, tt.expected, errVal.Kind, errVal.Message)
+		}
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{5, "5.0"},
+		{-3, "-3.0"},
+		{0, "0.0"},
+		{2.5, "2.5"},
+		{0.1, "0.1"},
+		{1e21, "1000000000000000000000.0"},
+		{math.Inf(1), "+Inf"},
+	}
+
+	for _, tt := range tests {
+		got := (&FloatValue{Value: tt.value}).Inspect()
+		if got != tt.expected {
+			t.Errorf("Inspect of %v: expected %q, got %q", tt.value, tt.expected, got)
+		}
+	}
+
+	// Printed output and string conversion keep the short form
+	var out bytes.Buffer
+	interp := New()
+	interp.SetOutput(&out)
+	program, errors := parser.Parse(lexer.New(`print 5.0
+print [1.0, 2.5]
+print "n=" + 4.0
+print to_string(3.0)`))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+	interp.Eval(program)
+	if out.String() != "5\n[1, 2.5]\nn=4\n3\n" {
+		t.Errorf("Unexpected printed output: %q", out.String())
+	}
+
+	// Whole floats still equal the matching ints inside collections
+	testBooleanValue(t, testEval("[1, 2] == [1.0, 2.0]"), true)
+	testBooleanValue(t, testEval("contains([3.0], 3)"), true)
+}
+
+func TestHeadAndTail(t *testing.T) {
+	testIntegerValue(t, testEval("head([4, 5, 6])"), 4)
+	testNilValue(t, testEval("head([])"))
+	testIntegerValue(t, testEval("len(tail([]))"), 0)
+
+	tail, ok := testEval("tail([4, 5, 6])").(*ArrayValue)
+	if !ok || len(tail.Elements) != 2 {
+		t.Fatalf("Expected a two element array, got %+v", tail)
+	}
+	testIntegerValue(t, tail.Elements[0], 5)
+	testIntegerValue(t, tail.Elements[1], 6)
+
+	// Neither changes the array it's given
+	input := `a = [1, 2, 3]
+b = tail(a)
+b[0] = 9
+head(a) + a[1] + len(a)`
+	testIntegerValue(t, testEval(input), 6)
+
+	// They support recursive list processing
+	input = `def sum(items) do
+  if len(items) == 0 do
+    return 0
+  end
+  return head(items) + sum(tail(items))
+end
+sum([1, 2, 3, 4])`
+	testIntegerValue(t, testEval(input), 10)
+
+	errVal, ok := testEval(`head("abc")`).(*ErrorValue)
+	if !ok || errVal.Kind != TypeError {
+		t.Errorf("Expected a type error for head of a string, got %+v", errVal)
+	}
+}
+
+func TestInOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"2 in [1, 2, 3]", true},
+		{"4 in [1, 2, 3]", false},
+		{"[1] in [[1], [2]]", true},
+		{`"a" in {"a": 1}`, true},
+		{`1 in {"a": 1}`, false},
+		{`"ell" in "hello"`, true},
+		{`"z" in "hello"`, false},
+		{"x = 1\nx + 1 in [2] && !(x in [3])", true},
+		{"seen = [1, 2]\nfound = 0\nfor n in [1, 3] do\n  if n in seen do\n    found += 1\n  end\nend\nfound == 1", true},
+	}
+
+	for _, tt := range tests {
+		testBooleanValue(t, testEval(tt.input), tt.expected)
+	}
+
+	for _, input := range []string{"1 in 5", `1 in "abc"`} {
+		evaluated := testEval(input)
+		if errVal, ok := evaluated.(*ErrorValue); !ok || errVal.Kind != TypeError {
+			t.Errorf("Input %q: expected a TypeError, got %T (%+v)", input, evaluated, evaluated)
+		}
+	}
+}
+
+func TestFunctionInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"def add(x: int, y: int): int do\n  x + y\nend\nadd", "def add(x: int, y: int): int"},
+		{"def greet(name): string do\n  name\nend\ngreet", "def greet(name): string"},
+		{"def apply(f: any, n: float) do\n  n\nend\napply", "def apply(f, n: float)"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		function, ok := evaluated.(*FunctionValue)
+		if !ok {
+			t.Errorf("input %q: expected a function, got %T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if function.Inspect() != tt.expected {
+			t.Errorf("input %q: expected %q, got %q", tt.input, tt.expected, function.Inspect())
+		}
+	}
+}
+
+func TestRangeBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"range(0, 5)", "[0, 1, 2, 3, 4]"},
+		{"range(0, 6, 2)", "[0, 2, 4]"},
+		{"range(1, 6, 2)", "[1, 3, 5]"},
+		// A negative step counts down, still stopping short of end
+		{"range(5, 0, -1)", "[5, 4, 3, 2, 1]"},
+		{"range(10, 0, -3)", "[10, 7, 4, 1]"},
+		// Counting the wrong way gives nothing rather than looping forever
+		{"range(5, 0)", "[]"},
+		{"range(0, 5, -1)", "[]"},
+		{"range(3, 3)", "[]"},
+		{"total = 0\nfor n in range(3, 0, -1) do\n  total = total * 10 + n\nend\ntotal", "321"},
+		// Steps that would carry n past the limits of int stop at end instead
+		{"range(9223372036854775806, 9223372036854775807, 2)", "[9223372036854775806]"},
+		{"range(9223372036854775805, 9223372036854775807)", "[9223372036854775805, 9223372036854775806]"},
+		{"range(-9223372036854775806, -9223372036854775807 - 1, -2)", "[-9223372036854775806]"},
+		{"range(0, 10, 9223372036854775807)", "[0]"},
+		{"range(-9223372036854775807, 9223372036854775807, 9223372036854775807)", "[-9223372036854775807, 0]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if isError(evaluated) {
+			t.Errorf("Input %q: unexpected error %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errVal, ok := testEval("range(0, 5, 0)").(*ErrorValue)
+	if !ok || errVal.Kind != ArgumentError {
+		t.Errorf("Expected an argument error for a zero step, got %+v", errVal)
+	}
+}
+
+func TestZip(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`zip([1, 2], ["a", "b"])`, "[[1, a], [2, b]]"},
+		// The result is as long as the shortest array
+		{"zip([1, 2, 3], [4])", "[[1, 4]]"},
+		{"zip([1], [2, 3, 4])", "[[1, 2]]"},
+		{"zip([], [1, 2])", "[]"},
+		{"zip()", "[]"},
+		{"zip([1, 2], [3, 4], [5, 6])", "[[1, 3, 5], [2, 4, 6]]"},
+		{`zip(1..3, "ab")`, "[[1, a], [2, b]]"},
+		// Pairs can be taken apart again in a loop
+		{"total = 0\nfor pair in zip([1, 2], [10, 20]) do\n  total += pair[0] * pair[1]\nend\ntotal", "50"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if isError(evaluated) {
+			t.Errorf("Input %q: unexpected error %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errVal, ok := testEval("zip([1], 5)").(*ErrorValue)
+	if !ok || errVal.Kind != TypeError {
+		t.Errorf("Expected a type error zipping an int, got %+v", errVal)
+	}
+}
+
+func TestDeclaredReturnTypes(t *testing.T) {
+	// A body whose value conforms to the declared type
+	testIntegerValue(t, testEval("def f(): int do\n  x = 5\n  x * 2\nend\nf()"), 10)
+
+	// A void function gives nil, whatever its last statement is
+	testNilValue(t, testEval("def f(): void do\n  x = 5\n  x * 2\nend\nf()"))
+	testNilValue(t, testEval("def f(): void do\n  return\nend\nf()"))
+	testNilValue(t, testEval("def f(): void do\n  return\n  5\nend\nf()"))
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Ending in an assignment leaves nothing to return
+		{"def f(): int do\n  x = 5\nend\nf()", "Function 'f' returns int, got nil"},
+		// A bare return gives nil, even with a statement after it
+		{"def f(): int do\n  return\n  5\nend\nf()", "Function 'f' returns int, got nil"},
+		{"def f(): string do\n  return 5\nend\nf()", "Function 'f' returns string, got int"},
+		{"def f(): void do\n  return 5\nend\nf()", "Function 'f' is void but returns int"},
+	}
+
+	for _, tt := range tests {
+		errVal, ok := testEval(tt.input).(*ErrorValue)
+		if !ok {
+			t.Errorf("Input %q: expected an error", tt.input)
+			continue
+		}
+		if errVal.Kind != TypeError || !strings.Contains(errVal.Message, tt.expected) {
+			t.Errorf("Input %q: expected a type error mentioning %q, got %s: %s", tt.input, tt.expected, errVal.Kind, errVal.Message)
+		}
+	}
+}
+
+func TestUntypedReturnValues(t *testing.T) {
+	// Without a declared return type nothing is checked, and a function
+	// ending without return gives back its last value
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"def greet(name) do\n  puts \"Hello, \" + name\nend\ngreet(\"a\")", "nil"},
+		{"def log_message do\n  puts \"logged\"\nend\nlog_message", "nil"},
+		{"def f() do\n  \"s\"\nend\nf()", "s"},
+		{"def f() do\n  return\nend\nf()", "nil"},
+		{"def f(x) do\n  if x do\n    return 1\n  end\n  \"none\"\nend\n[f(true), f(false)]", "[1, none]"},
+		// Fluent methods that return self, and iter methods
+		{`class Counter do
+  @n = 0
+  def bump() do
+    @n = @n + 1
+    return self
+  end
+  def count() do
+    @n
+  end
+end
+Counter.new().bump().bump().count()`, "2"},
+		{`class Pair do
+  def iter() do
+    [1, 2]
+  end
+end
+total = 0
+for x in Pair.new() do
+  total += x
+end
+total`, "3"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if isError(evaluated) {
+			t.Errorf("Input %q: unexpected error %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestBuiltinsWithNil(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"len(nil)", "len: argument is nil"},
+		{"to_int(nil)", "to_int: argument is nil"},
+		{"to_float(nil)", "to_float: argument is nil"},
+		{"sort(nil)", "sort: argument is nil"},
+		{"head(nil)", "head: argument is nil"},
+		{"contains(nil, 1)", "contains: argument is nil"},
+		// Typed parameters are checked before the builtin runs
+		{"keys(nil)", "keys: argument is nil"},
+		{"slice([1, 2], nil)", "slice: argument 2 is nil"},
+		{`m = {"a": 1}
+len(m["missing"])`, "len: argument is nil"},
+	}
+
+	for _, tt := range tests {
+		errVal, ok := testEval(tt.input).(*ErrorValue)
+		if !ok {
+			t.Errorf("Input %q: expected an error", tt.input)
+			continue
+		}
+		if errVal.Kind != TypeError || !strings.HasSuffix(errVal.Message, tt.expected) {
+			t.Errorf("Input %q: expected a type error ending %q, got %s: %s", tt.input, tt.expected, errVal.Kind, errVal.Message)
+		}
+	}
+
+	// Converting nil to a string is still fine
+	str, ok := testEval("to_string(nil)").(*StringValue)
+	if !ok || str.Value != "nil" {
+		t.Errorf("Expected to_string(nil) to give \"nil\", got %+v", str)
+	}
+	testBooleanValue(t, testEval("contains([1, nil], nil)"), true)
+}
+
+func TestStringMethods(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"  Hi ".trim().upcase()`, "HI"},
+		{`"MiXeD".downcase()`, "mixed"},
+		{`"a-b-a".replace("a", "x")`, "x-b-x"},
+		{`"hello".length()`, 5},
+		{`" padded ".trim().length()`, 6},
+		{`s = "keep"
+t = s.upcase()
+s`, "keep"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerValue(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*StringValue)
+			if !ok || str.Value != expected {
+				t.Errorf("Input %q: expected %q, got %+v", tt.input, expected, evaluated)
+			}
+		}
+	}
+
+	// split returns an array of strings
+	parts, ok := testEval(`"a,b,,c".split(",")`).(*ArrayValue)
+	if !ok {
+		t.Fatalf("Expected split to return an array")
+	}
+	expected := []string{"a", "b", "", "c"}
+	if len(parts.Elements) != len(expected) {
+		t.Fatalf("Expected %d parts, got %d", len(expected), len(parts.Elements))
+	}
+	for idx, want := range expected {
+		if str, ok := parts.Elements[idx].(*StringValue); !ok || str.Value != want {
+			t.Errorf("Part %d: expected %q, got %+v", idx, want, parts.Elements[idx])
+		}
+	}
+	testIntegerValue(t, testEval(`len("x y z".split(" "))`), 3)
+
+	errVal, ok := testEval(`"abc".split(1)`).(*ErrorValue)
+	if !ok || errVal.Kind != TypeError {
+		t.Errorf("Expected a type error for a non-string separator, got %+v", errVal)
+	}
+	errVal, ok = testEval(`"abc".upcase(1)`).(*ErrorValue)
+	if !ok || errVal.Kind != ArgumentError {
+		t.Errorf("Expected an argument error for upcase(1), got %+v", errVal)
+	}
+}
+
+func TestRepetition(t *testing.T) {
+	strs := []struct {
+		input    string
+		expected string
+	}{
+		{`"ab" * 3`, "ababab"},
+		{`"ab" * 1`, "ab"},
+		{`"ab" * 0`, ""},
+		{`"ab" * -2`, ""},
+		{`"" * 9223372036854775807`, ""},
+		{`s = "-"
+s *= 4
+s`, "----"},
+	}
+
+	for _, tt := range strs {
+		str, ok := testEval(tt.input).(*StringValue)
+		if !ok || str.Value != tt.expected {
+			t.Errorf("Input %q: expected %q, got %+v", tt.input, tt.expected, str)
+		}
+	}
+
+	arrays := []struct {
+		input    string
+		expected []int
+	}{
+		{"[0] * 3", []int{0, 0, 0}},
+		{"[1, 2] * 2", []int{1, 2, 1, 2}},
+		{"[1, 2] * 0", []int{}},
+		{"[1, 2] * -1", []int{}},
+		{"[] * 5", []int{}},
+		{"[] * 9223372036854775807", []int{}},
+	}
+
+	for _, tt := range arrays {
+		array, ok := testEval(tt.input).(*ArrayValue)
+		if !ok || len(array.Elements) != len(tt.expected) {
+			t.Errorf("Input %q: expected %d elements, got %+v", tt.input, len(tt.expected), array)
+			continue
+		}
+		for idx, want := range tt.expected {
+			testIntegerValue(t, array.Elements[idx], want)
+		}
+	}
+
+	// Results too long to build are an error rather than exhausting memory
+	for _, input := range []string{`[1] * 9223372036854775807`, `[1, 2] * 9223372036854775807`, `"a" * 9223372036854775807`} {
+		if errVal, ok := testEval(input).(*ErrorValue); !ok || errVal.Kind != OverflowError {
+			t.Errorf("Input %q: expected an overflow error, got %+v", input, errVal)
+		}
+	}
+
+	// Only a string or array on the left and an int on the right repeat
+	for _, input := range []string{`3 * "ab"`, `"ab" * 1.5`, `[1] * [2]`} {
+		if errVal, ok := testEval(input).(*ErrorValue); !ok || errVal.Kind != TypeError {
+			t.Errorf("Input %q: expected a type error, got %+v", input, errVal)
+		}
+	}
+}
+
+func TestClassFieldDefaults(t *testing.T) {
+	input := `class Counter do
+  @count: int = 0
+  @step = 2 * 5
+  @label: string
+end
+c = Counter.new()
+c.count + c.step`
+	testIntegerValue(t, testEval(input), 10)
+
+	testNilValue(t, testEval("class Counter do\n  @label: string\nend\nCounter.new().label"))
+
+	// Each instance gets its own default collection
+	input = `class Bag do
+  @items = [0]
+end
+a = Bag.new()
+b = Bag.new()
+items = a.items
+items[0] = 1
+b.items[0]`
+	testIntegerValue(t, testEval(input), 0)
+
+	// A subclass has its parent's fields as well as its own
+	input = `class Base do
+  @x: int = 1
+end
+class Derived inherits Base do
+  @y: int = 2
+end
+d = Derived.new()
+d.x + d.y`
+	testIntegerValue(t, testEval(input), 3)
+
+	errVal, ok := testEval("class Counter do\n  @count: int = \"zero\"\nend\nCounter.new()").(*ErrorValue)
+	if !ok || errVal.Kind != TypeError || !strings.Contains(errVal.Message, "field @count of class Counter expects int, got string") {
+		t.Errorf("Expected a type error for a mistyped default, got %+v", errVal)
+	}
+
+	errVal, ok = testEval("class Derived inherits Missing do\nend").(*ErrorValue)
+	if !ok || errVal.Kind != NameError {
+		t.Errorf("Expected a name error for an undefined parent, got %+v", errVal)
+	}
+}
+
+func TestFluentMethods(t *testing.T) {
+	builder := `class Builder do
+  @items: int = 0
+  def add(n: int): Builder do
+    @items = @items + n
+    return self
+  end
+  def add_twice(n: int): Builder do
+    self.add(n)
+    return self.add(n)
+  end
+  def total(): int do
+    return @items
+  end
+end
+`
+	testIntegerValue(t, testEval(builder+"Builder.new().add(1).add(2).total()"), 3)
+	testIntegerValue(t, testEval(builder+"Builder.new().add_twice(3).add(1).total()"), 7)
+
+	// Each call changes the same instance, which the chain hands back
+	testIntegerValue(t, testEval(builder+"b = Builder.new()\nb.add(4).add(5)\nb.total()"), 9)
+	testBooleanValue(t, testEval(builder+"b = Builder.new()\nb.add(1) == b"), true)
+
+	// Instance variables keep their declared types
+	errVal, ok := testEval(builder + "class Named do\n  @name: string = \"\"\n  def rename(n) do\n    @name = n\n  end\nend\nNamed.new().rename(5)").(*ErrorValue)
+	if !ok || errVal.Kind != TypeError || !strings.Contains(errVal.Message, "field @name of class Named expects string, got int") {
+		t.Errorf("Expected a type error assigning to a string field, got %+v", errVal)
+	}
+
+	inputs := []string{"self", "@items", "@items = 1"}
+	for _, input := range inputs {
+		errVal, ok := testEval(input).(*ErrorValue)
+		if !ok || errVal.Kind != NameError || !strings.Contains(errVal.Message, "outside of a method") {
+			t.Errorf("Input %q: expected a name error outside a method, got %+v", input, errVal)
+		}
+	}
+}
+
+func TestIncrementDecrement(t *testing.T) {
+	testIntegerValue(t, testEval("x = 1\nx++\nx++\nx"), 3)
+	testIntegerValue(t, testEval("x = 1\nx--\nx--\nx"), -1)
+	testIntegerValue(t, testEval("items = [1, 2]\nitems[1]++\nitems[1]"), 3)
+	testIntegerValue(t, testEval("total = 0\nfor n in [1, 2, 3] do\n  total++\nend\ntotal"), 3)
+
+	errVal, ok := testEval("x++").(*ErrorValue)
+	if !ok || errVal.Kind != NameError {
+		t.Errorf("Expected a name error for an undefined variable, got %+v", errVal)
+	}
+}
+
+func TestDefined(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`x = 5
+defined("x")`, true},
+		{`defined("missing")`, false},
+		{`x = nil
+defined("x")`, true},
+		{`defined("len")`, true},
+		{`def f(a): bool do
+  return defined("a") && !defined("b")
+end
+f(nil)`, true},
+		{`def f(): bool do
+  return defined("local")
+end
+local = 1
+f()`, true},
+	}
+
+	for _, tt := range tests {
+		testBooleanValue(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTypedArrays(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"xs: Array<int> = [1, 2]\nxs", "[1, 2]"},
+		// An empty array fits any element type
+		{"xs: Array<int> = []\nxs", "[]"},
+		{"xs: Array<string> = [\"a\"]\nxs = []\nxs", "[]"},
+		{"def count(xs: Array<string>): int do\n  return len(xs)\nend\ncount([])", "0"},
+		// Each element is checked on its own, so ints fit among floats
+		{"xs: Array<float> = [1, 2.5]\nxs", "[1, 2.5]"},
+		{"xs: Array<int || string> = [1, \"a\"]\nxs", "[1, a]"},
+		{"xs: Array<float> = [1.5]\nxs[0] = 2\nxs", "[2]"},
+		{"xs = [1]\nxs[0] = \"s\"\nxs", "[s]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if isError(evaluated) {
+			t.Errorf("Input %q: unexpected error %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	invalid := []string{
+		`xs: Array<int> = ["a"]`,
+		`xs: Array<int> = [1, "a"]`,
+		"xs: Array<int> = [1]\nxs = [\"a\"]",
+		"xs: Array<int> = [1, 2.5]",
+		// Elements assigned later keep the declared type too
+		"xs: Array<int> = [1]\nxs[0] = \"s\"",
+		"xs: Array<int> = [1]\nxs[0] += 0.5",
+		"xs: Array<int> = [1]\n[0].each do |i|\n  xs[i] = nil\nend",
+	}
+	for _, input := range invalid {
+		evaluated := testEval(input)
+		if errVal, ok := evaluated.(*ErrorValue); !ok || errVal.Kind != TypeError {
+			t.Errorf("Input %q: expected a TypeError, got %T (%+v)", input, evaluated, evaluated)
+		}
+	}
+}
+
+func TestCastExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"5" as int`, "5"},
+		{"5 as float", "5.0"},
+		{"3.9 as int + 1", "4"},
+		{`"2.5" as float * 2`, "5.0"},
+		{"[1, 2] as string", "[1, 2]"},
+		// Other types are checked rather than converted
+		{"x = [1]\nx as Array<int>", "[1]"},
+		{"true as bool", "true"},
+		// A class accepts its instances and those of its subclasses
+		{"class A do\n  @n = 1\nend\nclass B inherits A do\nend\n(B.new() as A).n", "1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if isError(evaluated) {
+			t.Errorf("Input %q: unexpected error %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	invalid := []string{`"abc" as int`, "[1] as float", "5 as bool", `"x" as Array<int>`,
+		// Names that aren't a type or a class
+		"5 as Foo", `"x" as intt`, "[1] as Array<Foo>",
+		"class A do\nend\n5 as A", "class A do\nend\nclass B do\nend\nB.new() as A"}
+	for _, input := range invalid {
+		evaluated := testEval(input)
+		if errVal, ok := evaluated.(*ErrorValue); !ok || errVal.Kind != TypeError {
+			t.Errorf("Input %q: expected a TypeError, got %T (%+v)", input, evaluated, evaluated)
+		}
+	}
+}
+
+func TestUnaryPlus(t *testing.T) {
+	testIntegerValue(t, testEval("+5"), 5)
+	testIntegerValue(t, testEval("x = 2\n+x"), 2)
+	testIntegerValue(t, testEval("3 - +2"), 1)
+
+	if float, ok := testEval("+3.14").(*FloatValue); !ok || float.Value != 3.14 {
+		t.Errorf("Expected 3.14 from +3.14, got %+v", float)
+	}
+
+	// Only numbers have a plus
+	evaluated := testEval(`+"x"`)
+	if errVal, ok := evaluated.(*ErrorValue); !ok || errVal.Kind != TypeError {
+		t.Errorf("Expected a TypeError for +\"x\", got %T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestUndef(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"x = 5\nundef x\ndefined(\"x\")", false},
+		{"x = 5\nundef x\nx = \"five\"\ndefined(\"x\")", true},
+		// Only the function's own scope is affected
+		{`x = 1
+def f(): bool do
+  x = 2
+  undef x
+  return defined("x")
+end
+f()`, true},
+	}
+
+	for _, tt := range tests {
+		testBooleanValue(t, testEval(tt.input), tt.expected)
+	}
+
+	// Reading a removed variable fails like any undefined one
+	evaluated := testEval("x = 5\nundef x\nx + 1")
+	if errVal, ok := evaluated.(*ErrorValue); !ok || errVal.Kind != NameError {
+		t.Errorf("Expected a NameError reading a removed variable, got %T (%+v)", evaluated, evaluated)
+	}
+
+	// So does removing a variable that isn't there, including one from an
+	// enclosing scope
+	inputs := []string{
+		"undef missing",
+		"x = 1\nundef x\nundef x",
+		"x = 1\ndef f() do\n  undef x\nend\nf()",
+	}
+	for _, input := range inputs {
+		evaluated := testEval(input)
+		errVal, ok := evaluated.(*ErrorValue)
+		if !ok || errVal.Kind != NameError || !strings.Contains(errVal.Message, "cannot undef") {
+			t.Errorf("Input %q: expected a NameError, got %T (%+v)", input, evaluated, evaluated)
+		}
+	}
+}
+
+func TestEnvironmentDelete(t *testing.T) {
+	env := NewEnvironment()
+	env.SetWithType("count", &IntegerValue{Value: 1}, types.IntType)
+
+	if !env.Delete("count") {
+		t.Fatalf("Expected Delete to report removing count")
+	}
+	if _, ok := env.Get("count"); ok {
+		t.Errorf("Expected count to be gone")
+	}
+	if env.Delete("count") {
+		t.Errorf("Expected a second Delete to report nothing to remove")
+	}
+
+	// The declared type goes with it, so the name can be reused freely
+	if err := env.Set("count", &StringValue{Value: "one"}); err != nil {
+		t.Errorf("Expected to reuse the name with a new type, got %v", err)
+	}
+}
+
+func TestIsA(t *testing.T) {
+	classes := `class Animal do
+end
+class Dog inherits Animal do
+end
+class Car do
+end
+rex = Dog.new()
+`
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`is_a(rex, "Dog")`, true},
+		{`is_a(rex, "Animal")`, true},
+		{`is_a(rex, "Car")`, false},
+		{`is_a(Animal.new(), "Dog")`, false},
+		{`is_a(5, "Animal")`, false},
+		{`is_a(nil, "Dog")`, false},
+	}
+
+	for _, tt := range tests {
+		testBooleanValue(t, testEval(classes+tt.input), tt.expected)
+	}
+}
+
 // Helper functions
 
 func testEval(input string) Value {
@@ -0,0 +1,100 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/example/vibe/lexer"
+	"github.com/example/vibe/parser"
+	"github.com/example/vibe/types"
+)
+
+// expandMacros removes the macro definitions from program and replaces every
+// top-level call to a macro with the statements it generates.
+//
+// Macro bodies run before any of the program does, in an environment that
+// only holds the builtins, and must return a string of Vibe source. That
+// source is parsed and spliced into the program in place of the call.
+func (i *Interpreter) expandMacros(program *parser.Program) (*parser.Program, Value) {
+	macros := make(map[string]*FunctionValue)
+	var statements []parser.Node
+
+	for _, stmt := range program.Statements {
+		if def, ok := stmt.(*parser.MacroDef); ok {
+			macros[def.Name] = &FunctionValue{
+				Name:       def.Name,
+				Parameters: def.Parameters,
+				Body:       def.Body,
+				ReturnType: types.AnyType,
+				Env:        i.macroEnvironment(),
+			}
+			continue
+		}
+		statements = append(statements, stmt)
+	}
+
+	// Nothing to expand, so leave the program untouched
+	if len(macros) == 0 {
+		return program, nil
+	}
+
+	expanded := &parser.Program{Statements: []parser.Node{}}
+	for _, stmt := range statements {
+		call, ok := stmt.(*parser.CallExpr)
+		if !ok {
+			expanded.Statements = append(expanded.Statements, stmt)
+			continue
+		}
+		ident, ok := call.Function.(*parser.Identifier)
+		if !ok || macros[ident.Name] == nil {
+			expanded.Statements = append(expanded.Statements, stmt)
+			continue
+		}
+
+		generated, errVal := i.expandMacroCall(macros[ident.Name], call)
+		if errVal != nil {
+			return nil, errVal
+		}
+		expanded.Statements = append(expanded.Statements, generated...)
+	}
+
+	return expanded, nil
+}
+
+// expandMacroCall runs a macro with the call's arguments and parses the
+// source it returns
+func (i *Interpreter) expandMacroCall(macro *FunctionValue, call *parser.CallExpr) ([]parser.Node, Value) {
+	args := i.evalExpressions(call.Args, macro.Env)
+	if len(args) == 1 && isError(args[0]) {
+		return nil, args[0]
+	}
+
+	result := i.applyFunction(macro, args)
+	if isError(result) {
+		return nil, result
+	}
+
+	source, ok := result.(*StringValue)
+	if !ok {
+		return nil, &ErrorValue{Kind: TypeError, Message: fmt.Sprintf(
+			"Type error: macro '%s' must return a string of source, got %s",
+			macro.Name, result.VibeType().String())}
+	}
+
+	generated, errors := parser.Parse(lexer.New(source.Value))
+	if len(errors) > 0 {
+		return nil, &ErrorValue{Kind: SyntaxError, Message: fmt.Sprintf(
+			"Error: macro '%s' generated invalid source: %s",
+			macro.Name, strings.Join(errors, "; "))}
+	}
+
+	return generated.Statements, nil
+}
+
+// macroEnvironment creates the isolated environment macro bodies run in
+func (i *Interpreter) macroEnvironment() *Environment {
+	env := NewEnvironment()
+	registerBuiltins(env)
+	i.registerFormatBuiltins(env)
+	return env
+}
@@ -0,0 +1,161 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/example/vibe/parser"
+	"github.com/example/vibe/types"
+)
+
+// MapKey identifies a map key by its value type and contents, so that 1 and
+// "1" are different keys
+type MapKey struct {
+	Type  string
+	Value string
+}
+
+// MapValue represents a map. Keys are kept in insertion order.
+type MapValue struct {
+	Keys   []Value
+	Values map[MapKey]Value
+	Frozen bool // Set by freeze; keys can't be assigned
+}
+
+// NewMapValue creates an empty map
+func NewMapValue() *MapValue {
+	return &MapValue{Keys: []Value{}, Values: make(map[MapKey]Value)}
+}
+
+func (m *MapValue) Type() string { return MAP_OBJ }
+func (m *MapValue) Inspect() string {
+	return formatValue(m, Value.Inspect, nil)
+}
+func (m *MapValue) VibeType() types.Type { return types.MapType }
+
+// Get looks up key, returning an error value if key can't be a map key
+func (m *MapValue) Get(key Value) (Value, bool, Value) {
+	hash, errVal := hashKey(key)
+	if errVal != nil {
+		return nil, false, errVal
+	}
+	value, ok := m.Values[hash]
+	return value, ok, nil
+}
+
+// Set stores value under key. A new key is added at the end; an existing
+// key keeps its position.
+func (m *MapValue) Set(key Value, value Value) Value {
+	hash, errVal := hashKey(key)
+	if errVal != nil {
+		return errVal
+	}
+	if _, ok := m.Values[hash]; !ok {
+		m.Keys = append(m.Keys, key)
+	}
+	m.Values[hash] = value
+	return nil
+}
+
+// hashKey converts a value into a MapKey. Only scalars can be keys: maps
+// and arrays can change after being used as a key, so they're rejected.
+func hashKey(key Value) (MapKey, Value) {
+	switch key.(type) {
+	case *IntegerValue, *FloatValue, *StringValue, *BooleanValue, *NilValue:
+		return MapKey{Type: key.Type(), Value: key.Inspect()}, nil
+	case *MapValue:
+		return MapKey{}, &ErrorValue{Kind: TypeError, Message: "Type error: a map cannot be used as a map key"}
+	}
+	return MapKey{}, &ErrorValue{Kind: TypeError, Message: fmt.Sprintf(
+		"Type error: %s cannot be used as a map key", key.VibeType().String())}
+}
+
+// valuesEqual reports whether two values are equal. Arrays and maps are
+// compared structurally; maps are equal when they have the same keys with
+// equal values, regardless of order. Values of different types are never
+// equal, except that an int and a float compare by value.
+func valuesEqual(left, right Value) bool {
+	return collectionsEqual(left, right, nil)
+}
+
+// valuePair is an array or map compared with another one
+type valuePair struct {
+	left, right Value
+}
+
+// collectionsEqual compares left and right for valuesEqual. comparing holds
+// the pairs of arrays and maps whose comparison is under way, so that a
+// collection containing itself doesn't recurse forever: meeting one of those
+// pairs again, it counts as equal and the rest of the elements decide.
+func collectionsEqual(left, right Value, comparing []valuePair) bool {
+	switch left.(type) {
+	case *ArrayValue, *MapValue:
+		pair := valuePair{left, right}
+		for _, outer := range comparing {
+			if outer == pair {
+				return true
+			}
+		}
+		comparing = append(comparing, pair)
+	}
+
+	switch left := left.(type) {
+	case *MapValue:
+		right, ok := right.(*MapValue)
+		if !ok || len(left.Values) != len(right.Values) {
+			return false
+		}
+		for hash, value := range left.Values {
+			other, ok := right.Values[hash]
+			if !ok || !collectionsEqual(value, other, comparing) {
+				return false
+			}
+		}
+		return true
+	case *ArrayValue:
+		right, ok := right.(*ArrayValue)
+		if !ok || len(left.Elements) != len(right.Elements) {
+			return false
+		}
+		for idx, element := range left.Elements {
+			if !collectionsEqual(element, right.Elements[idx], comparing) {
+				return false
+			}
+		}
+		return true
+	case *IntegerValue, *FloatValue:
+		// Numbers compare like == does: two ints exactly, and an int with a
+		// float by value, so [1] == [1.0] like 1 == 1.0
+		switch {
+		case left.Type() == INTEGER_OBJ && right.Type() == INTEGER_OBJ:
+			return evalIntegerBinaryExpression("==", left, right) == True
+		case right.Type() == INTEGER_OBJ || right.Type() == FLOAT_OBJ:
+			return evalNumberBinaryExpression("==", left, right) == True
+		}
+		return false
+	case *StringValue:
+		return right.Type() == STRING_OBJ && evalStringBinaryExpression("==", left, right) == True
+	}
+	// Anything else, like ["1"] against [1] or "nil" against nil, only
+	// matches a value of its own type that shows the same way
+	return left.Type() == right.Type() && left.Inspect() == right.Inspect()
+}
+
+func (i *Interpreter) evalMapLiteral(node *parser.MapLiteral, env *Environment) Value {
+	result := NewMapValue()
+
+	for idx, keyNode := range node.Keys {
+		key := i.eval(keyNode, env)
+		if isError(key) {
+			return key
+		}
+		value := i.evalStoredValue(node.Values[idx], env)
+		if isError(value) {
+			return value
+		}
+		if errVal := result.Set(key, value); errVal != nil {
+			return errVal
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,64 @@
+package interpreter
+
+import (
+	"github.com/example/vibe/parser"
+)
+
+// astNodeClass is the class of every value produced by quote
+var astNodeClass = &ClassValue{
+	Name:       "Node",
+	Methods:    make(map[string]*FunctionValue),
+	Properties: make(map[string]Value),
+}
+
+// quoteNode converts an AST node into a Node object without evaluating it.
+//
+// Every Node has a "type" property holding the parser's node type name and a
+// "children" array of Node objects, as given by parser.Children. Leaf data is
+// exposed as "value" (literals), "name" (identifiers, assignments,
+// declarations, loop variables), "operator" (binary and unary expressions)
+// or "property" (dot access and method calls).
+func quoteNode(node parser.Node) Value {
+	props := map[string]Value{
+		"type": &StringValue{Value: string(node.Type())},
+	}
+
+	switch node := node.(type) {
+	case *parser.NumberLiteral:
+		if node.IsInt {
+			props["value"] = &IntegerValue{Value: int(node.Integer())}
+		} else {
+			props["value"] = &FloatValue{Value: node.Value}
+		}
+	case *parser.StringLiteral:
+		props["value"] = &StringValue{Value: node.Value}
+	case *parser.BooleanLiteral:
+		props["value"] = nativeBoolToBooleanObject(node.Value)
+	case *parser.Identifier:
+		props["name"] = &StringValue{Value: node.Name}
+	case *parser.BinaryExpr:
+		props["operator"] = &StringValue{Value: node.Operator}
+	case *parser.UnaryExpr:
+		props["operator"] = &StringValue{Value: node.Operator}
+	case *parser.DotExpr:
+		props["property"] = &StringValue{Value: node.Property}
+	case *parser.MethodCall:
+		props["property"] = &StringValue{Value: node.Method}
+	case *parser.Assignment:
+		props["name"] = &StringValue{Value: node.Name}
+	case *parser.VariableDecl:
+		props["name"] = &StringValue{Value: node.Name}
+	case *parser.ForStmt:
+		props["name"] = &StringValue{Value: node.Iterator}
+	case *parser.FunctionDef:
+		props["name"] = &StringValue{Value: node.Name}
+	}
+
+	elements := []Value{}
+	for _, child := range parser.Children(node) {
+		elements = append(elements, quoteNode(child))
+	}
+	props["children"] = &ArrayValue{Elements: elements}
+
+	return &ObjectValue{Class: astNodeClass, Properties: props}
+}
@@ -0,0 +1,50 @@
+package interpreter_test
+
+import (
+	"testing"
+
+	"github.com/example/vibe/interpreter"
+	"github.com/example/vibe/lexer"
+	"github.com/example/vibe/parser"
+	"github.com/example/vibe/types"
+)
+
+func TestRegisterFunction(t *testing.T) {
+	interp := interpreter.New()
+
+	interp.RegisterFunction("double", func(args []interpreter.Value) interpreter.Value {
+		n := args[0].(*interpreter.IntegerValue)
+		return &interpreter.IntegerValue{Value: n.Value * 2}
+	}, []types.Type{types.IntType}, types.IntType)
+
+	program, errors := parser.Parse(lexer.New("x = double(21)\nx"))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	result := interp.Eval(program)
+
+	integer, ok := result.(*interpreter.IntegerValue)
+	if !ok {
+		t.Fatalf("Result is not an IntegerValue. got=%T (%+v)", result, result)
+	}
+	if integer.Value != 42 {
+		t.Errorf("Expected 42, got %d", integer.Value)
+	}
+}
+
+func TestRegisterFunctionTypeChecksArguments(t *testing.T) {
+	interp := interpreter.New()
+
+	interp.RegisterFunction("double", func(args []interpreter.Value) interpreter.Value {
+		n := args[0].(*interpreter.IntegerValue)
+		return &interpreter.IntegerValue{Value: n.Value * 2}
+	}, []types.Type{types.IntType}, types.IntType)
+
+	program, _ := parser.Parse(lexer.New(`double("oops")`))
+	result := interp.Eval(program)
+
+	if _, ok := result.(*interpreter.IntegerValue); ok {
+		t.Fatalf("Expected a type error for a string argument, got %s", result.Inspect())
+	}
+}
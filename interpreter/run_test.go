@@ -0,0 +1,458 @@
+package interpreter_test
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/example/vibe/interpreter"
+)
+
+func TestRun(t *testing.T) {
+	interp := interpreter.New()
+
+	result, err := interp.Run("x = 20\nx + 22")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	integer, ok := result.(*interpreter.IntegerValue)
+	if !ok {
+		t.Fatalf("Result is not an IntegerValue. got=%T (%+v)", result, result)
+	}
+	if integer.Value != 42 {
+		t.Errorf("Expected 42, got %d", integer.Value)
+	}
+}
+
+func TestRunParseError(t *testing.T) {
+	interp := interpreter.New()
+
+	_, err := interp.Run("x = (1 + 2")
+	if err == nil {
+		t.Fatalf("Expected a parse error, got none")
+	}
+
+	parseErr, ok := err.(*interpreter.ParseError)
+	if !ok {
+		t.Fatalf("Error is not a ParseError. got=%T (%v)", err, err)
+	}
+	if len(parseErr.Errors) == 0 {
+		t.Errorf("Expected parser errors to be reported")
+	}
+}
+
+func TestRunRuntimeError(t *testing.T) {
+	interp := interpreter.New()
+
+	_, err := interp.Run("x = 1\ny = x / 0\nputs \"unreachable\"")
+	if err == nil {
+		t.Fatalf("Expected a runtime error, got none")
+	}
+
+	if _, ok := err.(*interpreter.ParseError); ok {
+		t.Fatalf("Expected a runtime error, got a parse error: %v", err)
+	}
+	if !strings.Contains(err.Error(), "division by zero") {
+		t.Errorf("Unexpected error message: %q", err.Error())
+	}
+
+	// The error keeps its kind for callers to inspect
+	var errVal *interpreter.ErrorValue
+	if !errors.As(err, &errVal) {
+		t.Fatalf("Error is not an ErrorValue. got=%T (%v)", err, err)
+	}
+	if errVal.Kind != interpreter.DivisionByZero {
+		t.Errorf("Expected kind DivisionByZero, got %s", errVal.Kind)
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	interp := interpreter.New()
+
+	var out bytes.Buffer
+	interp.SetOutput(&out)
+
+	_, err := interp.Run("puts \"hello\"\nprint 1 + 2")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "hello\n3\n"
+	if out.String() != expected {
+		t.Errorf("Expected output %q, got %q", expected, out.String())
+	}
+}
+
+func TestSetErrorOutput(t *testing.T) {
+	interp := interpreter.New()
+
+	var out, errOut bytes.Buffer
+	interp.SetOutput(&out)
+	interp.SetErrorOutput(&errOut)
+
+	_, err := interp.Run("puts \"result\"\neprint(\"warning: low disk\")\nwarn(42)")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if out.String() != "result\n" {
+		t.Errorf("Expected output %q, got %q", "result\n", out.String())
+	}
+	expected := "warning: low disk\n42\n"
+	if errOut.String() != expected {
+		t.Errorf("Expected error output %q, got %q", expected, errOut.String())
+	}
+}
+
+func TestRecursionDepthLimit(t *testing.T) {
+	input := `
+def forever(n: int): int do
+  return forever(n + 1)
+end
+
+forever(0)
+`
+
+	_, err := interpreter.New().Run(input)
+	if err == nil || !strings.Contains(err.Error(), "stack overflow: maximum recursion depth exceeded") {
+		t.Fatalf("Expected a stack overflow error, got %v", err)
+	}
+
+	// The limit is configurable, and calls within it still succeed
+	interp := interpreter.New()
+	interp.SetMaxCallDepth(10)
+
+	result, err := interp.Run(`
+def count(n: int): int do
+  if n == 0
+    return 0
+  end
+  return count(n - 1)
+end
+
+count(5)
+`)
+	if err != nil {
+		t.Fatalf("Unexpected error within the limit: %v", err)
+	}
+	if result.Inspect() != "0" {
+		t.Errorf("Expected 0, got %s", result.Inspect())
+	}
+
+	if _, err := interp.Run("count(20)"); err == nil {
+		t.Errorf("Expected recursion past the configured limit to fail")
+	}
+}
+
+func TestSetFloatPrecision(t *testing.T) {
+	interp := interpreter.New()
+	interp.SetFloatPrecision(2)
+
+	var out bytes.Buffer
+	interp.SetOutput(&out)
+
+	result, err := interp.Run("x = 3.14159\nputs x\nputs [x, 1]\nto_string(x) + \" / \" + x")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "3.14\n[3.14, 1]\n"
+	if out.String() != expected {
+		t.Errorf("Expected output %q, got %q", expected, out.String())
+	}
+	if result.Inspect() != "3.14 / 3.14" {
+		t.Errorf("Expected \"3.14 / 3.14\", got %q", result.Inspect())
+	}
+
+	// A negative precision restores the shortest form
+	interp.SetFloatPrecision(-1)
+	result, _ = interp.Run("to_string(x)")
+	if result.Inspect() != "3.14159" {
+		t.Errorf("Expected \"3.14159\", got %q", result.Inspect())
+	}
+}
+
+func TestExit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"exit()", 0},
+		{"exit", 0},
+		{"exit(3)", 3},
+	}
+
+	for _, tt := range tests {
+		result, err := interpreter.New().Run(tt.input)
+		if err != nil {
+			t.Fatalf("Input %q: unexpected error: %v", tt.input, err)
+		}
+		exit, ok := result.(*interpreter.ExitValue)
+		if !ok {
+			t.Fatalf("Input %q: expected an ExitValue, got %T (%+v)", tt.input, result, result)
+		}
+		if exit.Code != tt.expected {
+			t.Errorf("Input %q: expected code %d, got %d", tt.input, tt.expected, exit.Code)
+		}
+	}
+
+	// Exiting from inside a loop in a function stops the whole program
+	interp := interpreter.New()
+	var out bytes.Buffer
+	interp.SetOutput(&out)
+
+	result, err := interp.Run(`
+def stop() do
+  for x in [1, 2, 3] do
+    print x
+    exit(2)
+  end
+  print "unreachable"
+end
+
+stop()
+print "unreachable"
+`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if exit, ok := result.(*interpreter.ExitValue); !ok || exit.Code != 2 {
+		t.Errorf("Expected exit code 2, got %T (%+v)", result, result)
+	}
+	if out.String() != "1\n" {
+		t.Errorf("Expected output %q, got %q", "1\n", out.String())
+	}
+}
+
+func TestStrictConditions(t *testing.T) {
+	loop := `
+i = 0
+while i < 3 do
+  i = i + 1
+end
+if i == 3
+  "done"
+else
+  "not done"
+end
+`
+
+	// Boolean conditions behave the same either way
+	for _, strict := range []bool{false, true} {
+		interp := interpreter.New()
+		interp.SetStrictConditions(strict)
+
+		result, err := interp.Run(loop)
+		if err != nil {
+			t.Fatalf("Strict %v: unexpected error: %v", strict, err)
+		}
+		if result.Inspect() != "done" {
+			t.Errorf("Strict %v: expected \"done\", got %q", strict, result.Inspect())
+		}
+	}
+
+	// By default any value is truthy except false and nil
+	result, err := interpreter.New().Run("if 5\n  1\nelse\n  2\nend")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Inspect() != "1" {
+		t.Errorf("Expected 1, got %s", result.Inspect())
+	}
+
+	// In strict mode a non-boolean condition is an error
+	inputs := map[string]string{
+		"while 5 do\n  break\nend":           "while condition must be a bool, got int",
+		"if \"yes\"\n  1\nend":               "if condition must be a bool, got string",
+		"if false\n  1\nelsif nil\n  2\nend": "elsif condition must be a bool, got nil",
+	}
+	for input, expected := range inputs {
+		interp := interpreter.New()
+		interp.SetStrictConditions(true)
+
+		_, err := interp.Run(input)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Input %q: expected an error containing %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestStrictArguments(t *testing.T) {
+	program := `
+def describe(name, age): string do
+  if age == nil
+    return name + " (age unknown)"
+  end
+  return name
+end
+describe("Ada")
+`
+
+	// By default a missing argument is nil
+	result, err := interpreter.New().Run(program)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Inspect() != "Ada (age unknown)" {
+		t.Errorf("Expected \"Ada (age unknown)\", got %q", result.Inspect())
+	}
+
+	// In strict mode it's an error
+	interp := interpreter.New()
+	interp.SetStrictArguments(true)
+	_, err = interp.Run(program)
+	expected := "Wrong number of arguments: function 'describe' expects 2, got 1"
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected an error containing %q, got %v", expected, err)
+	}
+	if errVal, ok := err.(*interpreter.ErrorValue); !ok || errVal.Kind != interpreter.ArgumentError {
+		t.Errorf("Expected an ArgumentError, got %T (%v)", err, err)
+	}
+
+	// Calls with every argument, or with too many, behave the same either way
+	result, err = interp.Run(`describe("Ada", 36)`)
+	if err != nil || result.Inspect() != "Ada" {
+		t.Errorf("Expected \"Ada\", got %v (%v)", result, err)
+	}
+	if _, err := interp.Run(`describe("Ada", 36, 1)`); err == nil {
+		t.Errorf("Expected an error for too many arguments")
+	}
+}
+
+func TestPutsPrints(t *testing.T) {
+	interp := interpreter.New()
+
+	var out bytes.Buffer
+	interp.SetOutput(&out)
+
+	_, err := interp.Run(`
+puts("hi")
+each([1, 2]) do |x|
+  puts(x)
+end
+def greet(name) do
+  puts "hello " + name
+  return 0
+end
+greet("vibe")
+`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "hi\n1\n2\nhello vibe\n"
+	if out.String() != expected {
+		t.Errorf("Expected output %q, got %q", expected, out.String())
+	}
+}
+
+func TestWriteOmitsNewline(t *testing.T) {
+	interp := interpreter.New()
+
+	var out bytes.Buffer
+	interp.SetOutput(&out)
+
+	_, err := interp.Run(`write("a"); write("b")
+write(1, " and ", 2.5, [3.0])
+puts "!"`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "ab1 and 2.5[3]!\n"
+	if out.String() != expected {
+		t.Errorf("Expected output %q, got %q", expected, out.String())
+	}
+}
+
+func TestBooleanOutput(t *testing.T) {
+	interp := interpreter.New()
+
+	var out bytes.Buffer
+	interp.SetOutput(&out)
+
+	// Booleans print as they're spelled in source, alone or nested
+	result, err := interp.Run(`puts true
+print(false)
+puts [true, false]
+puts {"ok": 1 < 2}
+puts to_string(true) + "!"
+puts type(false)
+1 > 2`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "true\nfalse\n[true, false]\n{ok: true}\ntrue!\nbool\n"
+	if out.String() != expected {
+		t.Errorf("Expected output %q, got %q", expected, out.String())
+	}
+
+	if result.Inspect() != "false" || result.VibeType().String() != "bool" {
+		t.Errorf("Expected false : bool, got %s : %s", result.Inspect(), result.VibeType())
+	}
+}
+
+func TestVersion(t *testing.T) {
+	version := interpreter.Version()
+	if !regexp.MustCompile(`^\d+\.\d+\.\d+$`).MatchString(version) {
+		t.Errorf("Expected a version of the form x.y.z, got %q", version)
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	interp := interpreter.New()
+	if interp.FeatureEnabled(interpreter.FeatureStrictConditions) {
+		t.Errorf("Expected strict conditions to be off by default")
+	}
+
+	interp.SetStrictConditions(true)
+	if !interp.FeatureEnabled(interpreter.FeatureStrictConditions) || !interp.Features()[interpreter.FeatureStrictConditions] {
+		t.Errorf("Expected strict conditions to be reported once enabled")
+	}
+	if interp.FeatureEnabled(interpreter.FeatureStrictArguments) {
+		t.Errorf("Expected only the enabled feature to be reported")
+	}
+	if interp.FeatureEnabled("no_such_feature") {
+		t.Errorf("Expected an unknown feature to be disabled")
+	}
+}
+
+func TestFrozenAssignmentHaltsProgram(t *testing.T) {
+	inputs := []string{
+		"a = freeze([1, 2])\na[0] = 5\nputs \"after\"",
+		"m = freeze({\"a\": 1})\nfor k in keys(m) do\n  m[k] += 1\n  puts \"after\"\nend",
+		"a = freeze([1])\ndef f(x) do\n  x[0] = 9\n  puts \"after\"\nend\nf(a)",
+		"a = [freeze([1])]\na[0][0] = 2\nputs \"after\"",
+	}
+
+	for _, input := range inputs {
+		interp := interpreter.New()
+		var out bytes.Buffer
+		interp.SetOutput(&out)
+
+		_, err := interp.Run(input)
+		if errVal, ok := err.(*interpreter.ErrorValue); !ok || errVal.Kind != interpreter.FrozenError {
+			t.Errorf("Input %q: expected a FrozenError, got %v", input, err)
+		}
+		if out.Len() > 0 {
+			t.Errorf("Input %q: expected nothing to run after the error, got output %q", input, out.String())
+		}
+	}
+
+	// The error can be rescued by its kind like any other
+	interp := interpreter.New()
+	var out bytes.Buffer
+	interp.SetOutput(&out)
+
+	_, err := interp.Run("a = freeze([1])\ntry do\n  a[0] = 2\nrescue FrozenError as e do\n  puts e[\"kind\"]\nend\nputs a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if out.String() != "FrozenError\n[1]\n" {
+		t.Errorf("Expected output %q, got %q", "FrozenError\n[1]\n", out.String())
+	}
+}
@@ -0,0 +1,31 @@
+package interpreter
+
+// version is the language version, following semantic versioning
+const version = "0.1.0"
+
+// Version returns the version of the Vibe language this interpreter
+// implements, as a semantic version string such as "0.1.0"
+func Version() string {
+	return version
+}
+
+// Feature names accepted by FeatureEnabled
+const (
+	FeatureStrictConditions = "strict_conditions"
+	FeatureStrictArguments  = "strict_arguments"
+)
+
+// Features reports which optional language features are enabled on this
+// interpreter, keyed by feature name
+func (i *Interpreter) Features() map[string]bool {
+	return map[string]bool{
+		FeatureStrictConditions: i.strictConditions,
+		FeatureStrictArguments:  i.strictArguments,
+	}
+}
+
+// FeatureEnabled reports whether the named optional feature is enabled.
+// Unknown feature names are never enabled.
+func (i *Interpreter) FeatureEnabled(name string) bool {
+	return i.Features()[name]
+}
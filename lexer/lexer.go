@@ -19,6 +19,7 @@ type Token struct {
 const (
 	ILLEGAL = "ILLEGAL" // Illegal token
 	EOF     = "EOF"     // End of file
+	NEWLINE = "NEWLINE" // Line break, only emitted when enabled with SetEmitNewlines
 
 	// Identifiers and literals
 	IDENT  = "IDENT"  // Variable and function names
@@ -32,6 +33,7 @@ const (
 	MINUS    = "-"
 	BANG     = "!"
 	ASTERISK = "*"
+	POWER    = "**"
 	SLASH    = "/"
 	MODULO   = "%"
 
@@ -43,14 +45,18 @@ const (
 	LT_EQ  = "<="
 	GT_EQ  = ">="
 
-	AND = "&&"
-	OR  = "||"
+	SPACESHIP = "<=>" // Three-way comparison
+
+	AND  = "&&"
+	OR   = "||"
+	PIPE = "|" // Block parameter delimiter (do |x| ... end)
 
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
 	DOT       = "."
+	SAFE_DOT  = "?." // Optional chaining (obj?.field)
 	AT        = "@"  // For instance variables
 
 	LPAREN   = "("
@@ -69,15 +75,23 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	ELSIF    = "ELSIF"
+	THEN     = "THEN"
 	RETURN   = "RETURN"
 	WHILE    = "WHILE"
 	FOR      = "FOR"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
 	IN       = "IN"
 	NIL      = "NIL"
 	PRINT    = "PRINT"
 	END      = "END"
 	DO       = "DO"
 	REQUIRE  = "REQUIRE"
+	MACRO    = "MACRO"
+	TRY      = "TRY"
+	RESCUE   = "RESCUE"
+	UNDEF    = "UNDEF"
+	AS       = "AS"
 
 	// Class-related keywords
 	CLASS    = "CLASS"
@@ -92,11 +106,16 @@ const (
 	MUL_ASSIGN    = "*="
 	DIV_ASSIGN    = "/="
 	MOD_ASSIGN    = "%="
+
+	// Increment and decrement operators
+	INCREMENT = "++"
+	DECREMENT = "--"
 )
 
 // keywords maps strings to their keyword TokenType
 var keywords = map[string]TokenType{
 	"def":      FUNCTION,
+	"function": FUNCTION,
 	"let":      LET,
 	"var":      VAR,
 	"true":     TRUE,
@@ -104,9 +123,12 @@ var keywords = map[string]TokenType{
 	"if":       IF,
 	"else":     ELSE,
 	"elsif":    ELSIF,
+	"then":     THEN,
 	"return":   RETURN,
 	"while":    WHILE,
 	"for":      FOR,
+	"break":    BREAK,
+	"continue": CONTINUE,
 	"in":       IN,
 	"nil":      NIL,
 	"print":    PRINT,
@@ -114,6 +136,16 @@ var keywords = map[string]TokenType{
 	"end":      END,
 	"do":       DO,
 	"require":  REQUIRE,
+	"macro":    MACRO,
+	"try":      TRY,
+	"rescue":   RESCUE,
+	"undef":    UNDEF,
+	"as":       AS,
+
+	// Word forms of the boolean operators
+	"and": AND,
+	"or":  OR,
+	"not": BANG,
 
 	// Class-related keywords
 	"class":    CLASS,
@@ -131,6 +163,7 @@ type Lexer struct {
 	ch           byte // current character being examined
 	line         int  // current line number
 	column       int  // current column number
+	emitNewlines bool // whether line breaks produce NEWLINE tokens
 }
 
 // New creates a new Lexer
@@ -140,6 +173,13 @@ func New(input string) *Lexer {
 	return l
 }
 
+// SetEmitNewlines sets whether line breaks produce NEWLINE tokens. By
+// default they're skipped like any other whitespace. A run of line breaks
+// with only whitespace between them produces a single NEWLINE.
+func (l *Lexer) SetEmitNewlines(emit bool) {
+	l.emitNewlines = emit
+}
+
 // readChar reads the next character and advances the position in the input string
 func (l *Lexer) readChar() {
 	if l.readPosition >= len(l.input) {
@@ -170,6 +210,17 @@ func (l *Lexer) peekChar() byte {
 func (l *Lexer) NextToken() Token {
 	var tok Token
 
+	if l.emitNewlines {
+		for l.ch == ' ' || l.ch == '\t' || l.ch == '\r' {
+			l.readChar()
+		}
+		if l.ch == '\n' {
+			// readChar has already moved the line count past this break
+			tok = Token{Type: NEWLINE, Literal: "\n", Line: l.line - 1}
+			l.skipWhitespace()
+			return tok
+		}
+	}
 	l.skipWhitespace()
 
 	// Remember the starting position of the token
@@ -190,6 +241,10 @@ func (l *Lexer) NextToken() Token {
 			ch := l.ch
 			l.readChar()
 			tok = Token{Type: PLUS_ASSIGN, Literal: string(ch) + string(l.ch)}
+		} else if l.peekChar() == '+' {
+			ch := l.ch
+			l.readChar()
+			tok = Token{Type: INCREMENT, Literal: string(ch) + string(l.ch)}
 		} else {
 			tok = newToken(PLUS, l.ch)
 		}
@@ -198,6 +253,10 @@ func (l *Lexer) NextToken() Token {
 			ch := l.ch
 			l.readChar()
 			tok = Token{Type: MINUS_ASSIGN, Literal: string(ch) + string(l.ch)}
+		} else if l.peekChar() == '-' {
+			ch := l.ch
+			l.readChar()
+			tok = Token{Type: DECREMENT, Literal: string(ch) + string(l.ch)}
 		} else {
 			tok = newToken(MINUS, l.ch)
 		}
@@ -214,6 +273,10 @@ func (l *Lexer) NextToken() Token {
 			ch := l.ch
 			l.readChar()
 			tok = Token{Type: MUL_ASSIGN, Literal: string(ch) + string(l.ch)}
+		} else if l.peekChar() == '*' {
+			ch := l.ch
+			l.readChar()
+			tok = Token{Type: POWER, Literal: string(ch) + string(l.ch)}
 		} else {
 			tok = newToken(ASTERISK, l.ch)
 		}
@@ -251,7 +314,12 @@ func (l *Lexer) NextToken() Token {
 		if l.peekChar() == '=' {
 			ch := l.ch
 			l.readChar()
-			tok = Token{Type: LT_EQ, Literal: string(ch) + string(l.ch)}
+			if l.peekChar() == '>' {
+				l.readChar()
+				tok = Token{Type: SPACESHIP, Literal: "<=>"}
+			} else {
+				tok = Token{Type: LT_EQ, Literal: string(ch) + string(l.ch)}
+			}
 		} else {
 			tok = newToken(LT, l.ch)
 		}
@@ -277,7 +345,7 @@ func (l *Lexer) NextToken() Token {
 			l.readChar()
 			tok = Token{Type: OR, Literal: string(ch) + string(l.ch)}
 		} else {
-			tok = newToken(ILLEGAL, l.ch)
+			tok = newToken(PIPE, l.ch)
 		}
 	case ',':
 		tok = newToken(COMMA, l.ch)
@@ -287,6 +355,14 @@ func (l *Lexer) NextToken() Token {
 		tok = newToken(COLON, l.ch)
 	case '.':
 		tok = newToken(DOT, l.ch)
+	case '?':
+		if l.peekChar() == '.' {
+			ch := l.ch
+			l.readChar()
+			tok = Token{Type: SAFE_DOT, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(ILLEGAL, l.ch)
+		}
 	case '@':
 		tok = newToken(AT, l.ch)
 	case '(':
@@ -311,6 +387,10 @@ func (l *Lexer) NextToken() Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = lookupIdent(tok.Literal)
+			if tok.Type == AND || tok.Type == OR || tok.Type == BANG {
+				// A word operator reads exactly like its symbol
+				tok.Literal = string(tok.Type)
+			}
 			fmt.Printf("DEBUG: NextToken - identifier: %s, token type: %s\n", tok.Literal, tok.Type)
 			tok.Line = line
 			tok.Column = column
@@ -148,12 +148,12 @@ func TestNumberTokens(t *testing.T) {
 }
 
 func TestKeywords(t *testing.T) {
-	input := `def let var true false if else elsif return while nil print`
+	input := `def let var true false if else elsif then return while nil print`
 
 	l := New(input)
 
 	expectedTokens := []TokenType{
-		FUNCTION, LET, VAR, TRUE, FALSE, IF, ELSE, ELSIF, RETURN, WHILE, NIL, PRINT,
+		FUNCTION, LET, VAR, TRUE, FALSE, IF, ELSE, ELSIF, THEN, RETURN, WHILE, NIL, PRINT,
 	}
 
 	for i, expected := range expectedTokens {
@@ -199,6 +199,59 @@ func TestDelimiters(t *testing.T) {
 	}
 }
 
+func TestSafeDot(t *testing.T) {
+	input := `obj?.field`
+
+	l := New(input)
+
+	expectedTokens := []TokenType{IDENT, SAFE_DOT, IDENT, EOF}
+
+	for i, expected := range expectedTokens {
+		tok := l.NextToken()
+		if tok.Type != expected {
+			t.Fatalf("Token %d: expected %s, got %s", i, expected, tok.Type)
+		}
+	}
+}
+
+func TestBlockParameterPipes(t *testing.T) {
+	input := `do |x, y| end`
+
+	l := New(input)
+
+	expectedTokens := []TokenType{DO, PIPE, IDENT, COMMA, IDENT, PIPE, END, EOF}
+
+	for i, expected := range expectedTokens {
+		tok := l.NextToken()
+		if tok.Type != expected {
+			t.Fatalf("Token %d: expected %s, got %s", i, expected, tok.Type)
+		}
+	}
+}
+
+func TestEmptyInputs(t *testing.T) {
+	inputs := []string{
+		"",
+		"   \n  ",
+		"# only a comment\n// and another\n# no trailing newline",
+	}
+
+	for _, input := range inputs {
+		l := New(input)
+
+		tok := l.NextToken()
+		if tok.Type != EOF {
+			t.Fatalf("Input %q: expected EOF, got %s (%q)", input, tok.Type, tok.Literal)
+		}
+
+		// Reading past the end keeps returning EOF
+		tok = l.NextToken()
+		if tok.Type != EOF {
+			t.Fatalf("Input %q: expected repeated EOF, got %s", input, tok.Type)
+		}
+	}
+}
+
 func TestComplexInputs(t *testing.T) {
 	input := `# This is a comment
 def factorial(n) {
@@ -241,4 +294,112 @@ arr[2] = 10;`
 	if !defFound {
 		t.Fatal("Could not find 'def' keyword token in collected tokens")
 	}
-}
\ No newline at end of file
+}
+func TestSpaceship(t *testing.T) {
+	input := `a <=> b <= c`
+
+	l := New(input)
+
+	expectedTokens := []TokenType{IDENT, SPACESHIP, IDENT, LT_EQ, IDENT, EOF}
+
+	for i, expected := range expectedTokens {
+		tok := l.NextToken()
+		if tok.Type != expected {
+			t.Fatalf("Token %d: expected %s, got %s", i, expected, tok.Type)
+		}
+	}
+}
+
+func TestPowerOperator(t *testing.T) {
+	input := `2 ** 3 * 4 *= 5`
+
+	l := New(input)
+
+	expectedTokens := []TokenType{INT, POWER, INT, ASTERISK, INT, MUL_ASSIGN, INT, EOF}
+
+	for i, expected := range expectedTokens {
+		tok := l.NextToken()
+		if tok.Type != expected {
+			t.Fatalf("Token %d: expected %s, got %s", i, expected, tok.Type)
+		}
+	}
+}
+
+func TestNewlineTokens(t *testing.T) {
+	input := "x = 1  \n\n  y\r\n# comment\nz"
+
+	// Line breaks are skipped by default
+	l := New(input)
+	for _, expected := range []TokenType{IDENT, ASSIGN, INT, IDENT, IDENT, EOF} {
+		if tok := l.NextToken(); tok.Type != expected {
+			t.Fatalf("Expected %s, got %s", expected, tok.Type)
+		}
+	}
+
+	l = New(input)
+	l.SetEmitNewlines(true)
+
+	expectedTokens := []struct {
+		tokenType TokenType
+		line      int
+	}{
+		{IDENT, 1}, {ASSIGN, 1}, {INT, 1}, {NEWLINE, 1},
+		{IDENT, 3}, {NEWLINE, 3},
+		{NEWLINE, 4},
+		{IDENT, 5}, {EOF, 5},
+	}
+
+	for i, expected := range expectedTokens {
+		tok := l.NextToken()
+		if tok.Type != expected.tokenType || tok.Line != expected.line {
+			t.Fatalf("Token %d: expected %s on line %d, got %s on line %d", i, expected.tokenType, expected.line, tok.Type, tok.Line)
+		}
+	}
+}
+
+func TestIncrementDecrement(t *testing.T) {
+	input := `x++ y-- a += 1 b - -1`
+
+	l := New(input)
+
+	expectedTokens := []TokenType{IDENT, INCREMENT, IDENT, DECREMENT, IDENT, PLUS_ASSIGN, INT, IDENT, MINUS, MINUS, INT, EOF}
+
+	for i, expected := range expectedTokens {
+		tok := l.NextToken()
+		if tok.Type != expected {
+			t.Fatalf("Token %d: expected %s, got %s", i, expected, tok.Type)
+		}
+	}
+}
+
+func TestWordOperators(t *testing.T) {
+	input := `a and b or not c`
+
+	l := New(input)
+
+	// The words lex as the operators themselves, literal included
+	expectedTokens := []Token{
+		{Type: IDENT, Literal: "a"},
+		{Type: AND, Literal: "&&"},
+		{Type: IDENT, Literal: "b"},
+		{Type: OR, Literal: "||"},
+		{Type: BANG, Literal: "!"},
+		{Type: IDENT, Literal: "c"},
+		{Type: EOF, Literal: ""},
+	}
+
+	for i, expected := range expectedTokens {
+		tok := l.NextToken()
+		if tok.Type != expected.Type || tok.Literal != expected.Literal {
+			t.Fatalf("Token %d: expected %s %q, got %s %q", i, expected.Type, expected.Literal, tok.Type, tok.Literal)
+		}
+	}
+
+	// Only whole words count, so longer identifiers are left alone
+	l = New(`android order nothing`)
+	for i := 0; i < 3; i++ {
+		if tok := l.NextToken(); tok.Type != IDENT {
+			t.Fatalf("Token %d: expected IDENT, got %s %q", i, tok.Type, tok.Literal)
+		}
+	}
+}
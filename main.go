@@ -3,10 +3,13 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
 
+	"github.com/example/vibe/analysis"
 	"github.com/example/vibe/interpreter"
 	"github.com/example/vibe/lexer"
 	"github.com/example/vibe/parser"
@@ -14,12 +17,25 @@ import (
 
 var debug bool = false
 
+// floatPrecision is the number of decimal places floats are displayed with,
+// set with --precision=N; -1 keeps the interpreter's shortest form
+var floatPrecision int = -1
+
+// foldConstants runs the constant-folding pass before evaluation, set with --fold
+var foldConstants bool = false
+
+// checkTypes runs the static type checker before evaluation, set with --check
+var checkTypes bool = false
+
 func main() {
 	args := os.Args[1:]
 
 	if len(args) == 0 {
 		fmt.Println("Usage: vibe <filename> or vibe -i (for interactive mode)")
 		fmt.Println("       vibe <filename> -d (for debug mode)")
+		fmt.Println("       vibe <filename> --precision=N (print floats with N decimal places)")
+		fmt.Println("       vibe <filename> --fold (fold constant expressions before running)")
+		fmt.Println("       vibe <filename> --check (type check the program before running)")
 		return
 	}
 
@@ -33,6 +49,41 @@ func main() {
 		}
 	}
 
+	// Check for float precision flag
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "--precision=") {
+			digits, err := strconv.Atoi(strings.TrimPrefix(arg, "--precision="))
+			if err != nil {
+				fmt.Printf("Invalid precision: %s\n", arg)
+				return
+			}
+			floatPrecision = digits
+			// Remove the precision flag from args
+			args = append(args[:i], args[i+1:]...)
+			break
+		}
+	}
+
+	// Check for constant folding flag
+	for i, arg := range args {
+		if arg == "--fold" {
+			foldConstants = true
+			// Remove the fold flag from args
+			args = append(args[:i], args[i+1:]...)
+			break
+		}
+	}
+
+	// Check for type checking flag
+	for i, arg := range args {
+		if arg == "--check" {
+			checkTypes = true
+			// Remove the check flag from args
+			args = append(args[:i], args[i+1:]...)
+			break
+		}
+	}
+
 	if len(args) == 0 {
 		fmt.Println("Usage: vibe <filename> or vibe -i (for interactive mode)")
 		fmt.Println("       vibe <filename> -d (for debug mode)")
@@ -63,142 +114,253 @@ func runInteractiveMode() {
 	fmt.Println("Type 'exit' to quit")
 
 	interp := interpreter.New()
+	interp.SetFloatPrecision(floatPrecision)
 	scanner := bufio.NewScanner(os.Stdin)
 
 	for {
-		// Track input buffer for multiline input
-		var inputBuffer strings.Builder
-		var isMultiline bool
-		var blockCount int = 0
-
-		fmt.Print(">> ")
-		if !scanner.Scan() {
+		code, ok := readInput(scanner, os.Stdout)
+		if !ok {
 			break
 		}
 
-		line := scanner.Text()
-		if line == "exit" {
-			break
+		program, errors, err := parseProgram(code)
+		if err != nil {
+			fmt.Println(err)
+			continue
 		}
-
-		// Check if this line might start a multi-line block
-		if containsBlockOpener(line) {
-			isMultiline = true
-			blockCount++
+		if len(errors) > 0 {
+			printParserErrors(errors)
+			continue
 		}
 
-		inputBuffer.WriteString(line)
-
-		// If we're in a multiline context, keep collecting lines until the blocks are closed
-		for isMultiline && blockCount > 0 {
-			fmt.Print(".. ")
-			if !scanner.Scan() {
-				break
-			}
-
-			line = scanner.Text()
-			if line == "exit" {
-				break
-			}
+		// Blank lines and comments leave nothing to evaluate
+		if len(program.Statements) == 0 {
+			continue
+		}
 
-			// Track block openers and closers
-			if containsBlockOpener(line) {
-				blockCount++
-			}
-			if containsBlockCloser(line) {
-				blockCount--
-			}
+		// Evaluate the program
+		result := interp.Eval(program)
 
-			// Add the line to our buffer
-			inputBuffer.WriteString("\n")
-			inputBuffer.WriteString(line)
+		// exit() leaves the REPL, just like typing exit
+		if _, ok := result.(*interpreter.ExitValue); ok {
+			break
 		}
 
-		code := inputBuffer.String()
+		if result != nil {
+			fmt.Printf("=> %s : %s\n", formatResult(interp, result), result.VibeType())
+		}
+	}
+}
 
-		// Create a lexer from the input
-		l := lexer.New(code)
+// readInput reads lines until they form a complete piece of input,
+// prompting with ">> " and then ".. " while more is needed. The buffer is
+// trial-parsed after every line, so a pasted def or class is only submitted
+// once its closing end arrives. It returns false when input runs out or the
+// user types exit.
+func readInput(scanner *bufio.Scanner, out io.Writer) (string, bool) {
+	var inputBuffer strings.Builder
+	prompt := ">> "
 
-		// Parse the input
-		program, errors := parser.Parse(l)
+	for {
+		fmt.Fprint(out, prompt)
+		if !scanner.Scan() {
+			// Evaluate whatever was left unfinished so its errors are shown
+			return inputBuffer.String(), inputBuffer.Len() > 0
+		}
 
-		if len(errors) > 0 {
-			printParserErrors(errors)
-			continue
+		line := scanner.Text()
+		if inputBuffer.Len() == 0 && line == "exit" {
+			return "", false
 		}
 
-		// Evaluate the program
-		result := interp.Eval(program)
-		if result != nil {
-			fmt.Printf("=> %s : %s\n", result.Inspect(), result.VibeType())
+		if inputBuffer.Len() > 0 {
+			inputBuffer.WriteString("\n")
 		}
-	}
-}
+		inputBuffer.WriteString(line)
 
-// Helper function to detect if a line contains a block opener token
-func containsBlockOpener(line string) bool {
-	// Check for block openers: for, if, function, class, while, etc.
-	keywords := []string{"for", "if", "function", "class", "while", "do"}
-	for _, keyword := range keywords {
-		if strings.Contains(line, keyword+" ") || strings.HasSuffix(line, keyword) ||
-		   strings.Contains(line, keyword+"\n") {
-			return true
+		// Input that crashes the parser is as complete as it will get
+		_, errors, err := parseProgram(inputBuffer.String())
+		if err != nil || !incompleteInput(errors) {
+			return inputBuffer.String(), true
 		}
+		prompt = ".. "
 	}
-	// Also check for array literals that span multiple lines
-	if strings.Contains(line, "[") && !strings.Contains(line, "]") {
-		return true
-	}
-	return false
 }
 
-// Helper function to detect if a line contains a block closer token
-func containsBlockCloser(line string) bool {
-	// Check for 'end' keyword which closes most blocks
-	if strings.TrimSpace(line) == "end" || strings.HasPrefix(strings.TrimSpace(line), "end ") ||
-	   strings.HasSuffix(strings.TrimSpace(line), " end") || strings.Contains(line, " end ") {
-		return true
+// incompleteInput reports whether every parse error comes from the input
+// stopping early, such as a missing end or closing bracket, so that reading
+// another line could complete it
+func incompleteInput(errors []string) bool {
+	if len(errors) == 0 {
+		return false
 	}
-	// Also check for closing brackets for array literals
-	if strings.Contains(line, "]") {
-		return true
+	for _, err := range errors {
+		if !strings.Contains(err, "EOF") && !strings.HasPrefix(err, "Expected 'end'") {
+			return false
+		}
 	}
-	return false
+	return true
 }
 
 func runProgram(source string) {
-	// Create a lexer from the source code
-	l := lexer.New(source)
-
-	// Parse the input
-	program, errors := parser.Parse(l)
-
+	program, errors, err := parseProgram(source)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 	if len(errors) > 0 {
 		printParserErrors(errors)
 		return
 	}
 
+	if checkTypes {
+		if diagnostics := analysis.TypeCheck(program); len(diagnostics) > 0 {
+			printTypeErrors(diagnostics)
+			os.Exit(1)
+		}
+	}
+
 	if debug {
 		fmt.Println("Program AST:")
 		for i, stmt := range program.Statements {
 			fmt.Printf("Statement %d: %s\n", i, stmt.String())
 		}
 		fmt.Println()
+		fmt.Println("Program source:")
+		fmt.Println(parser.Format(program))
+		fmt.Println()
 	}
 
 	// Create an interpreter and evaluate the program
 	interp := interpreter.New()
-	result := interp.Eval(program)
+	interp.SetFloatPrecision(floatPrecision)
+	result, err := evalProgram(interp, program, source)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if debug {
+		printEnvironment(os.Stdout, interp)
+	}
+
+	if exit, ok := result.(*interpreter.ExitValue); ok {
+		os.Exit(exit.Code)
+	}
 
-	// The result is the last evaluated statement
-	if result != nil && result.Type() != "NIL" {
-		fmt.Printf("Result: %s : %s\n", result.Inspect(), result.VibeType())
+	if errVal := runtimeError(result); errVal != nil {
+		fmt.Println(errVal)
+		os.Exit(1)
+	}
+
+	if value, ok := programResult(program, result); ok {
+		fmt.Printf("Result: %s : %s\n", formatResult(interp, value), value.VibeType())
 	}
 }
 
+// parseProgram parses source, folding its constants when asked to. Like
+// evalProgram, it reports a panic as an internal error rather than crashing.
+func parseProgram(source string) (program *parser.Program, errors []string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			program, errors, err = nil, nil, internalError(r, parser.Position{}, source)
+		}
+	}()
+
+	program, errors = parser.Parse(lexer.New(source))
+	if len(errors) == 0 && foldConstants {
+		program = parser.Fold(program)
+	}
+	return program, errors, nil
+}
+
+// evalProgram evaluates program, recovering from a panic inside the
+// interpreter so that a bug there is reported as an error naming the line
+// of source being run, rather than crashing with a Go stack trace. A call to
+// panic in the program is returned as an error too.
+func evalProgram(interp *interpreter.Interpreter, program *parser.Program, source string) (result interpreter.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = internalError(r, interp.Position(), source)
+		}
+	}()
+
+	result = interp.Eval(program)
+	if errVal, ok := result.(*interpreter.ErrorValue); ok && errVal.Fatal {
+		return nil, errVal
+	}
+	return result, nil
+}
+
+// internalError describes a panic recovered while running the statement at
+// pos, quoting that line of source when it's known
+func internalError(r interface{}, pos parser.Position, source string) error {
+	lines := strings.Split(source, "\n")
+	if pos.Line < 1 || pos.Line > len(lines) {
+		return fmt.Errorf("Internal error: %v", r)
+	}
+	return fmt.Errorf("Internal error at line %d: %v\n\t%d | %s", pos.Line, r, pos.Line, strings.TrimRight(lines[pos.Line-1], "\r"))
+}
+
+// formatResult renders a result reported alongside its type. Printed output
+// drops the fraction of whole floats, but here 5.0 must stay distinguishable
+// from 5, so the default precision shows values as Inspect does.
+func formatResult(interp *interpreter.Interpreter, value interpreter.Value) string {
+	if floatPrecision >= 0 {
+		return interp.Display(value)
+	}
+	return value.Inspect()
+}
+
+// runtimeError returns the error that stopped a program, if one did. It's
+// checked before programResult, which would drop an error raised by any
+// statement other than a trailing expression.
+func runtimeError(result interpreter.Value) *interpreter.ErrorValue {
+	errVal, _ := result.(*interpreter.ErrorValue)
+	return errVal
+}
+
+// programResult decides whether a finished program has a result worth
+// reporting. Only a program ending in a bare expression does, and only when
+// that expression isn't nil; assignments, declarations, output and control
+// flow run for their effects, so a script ending in x = 5 stays quiet.
+func programResult(program *parser.Program, result interpreter.Value) (interpreter.Value, bool) {
+	if len(program.Statements) == 0 || result == nil || result.Type() == interpreter.NIL_OBJ {
+		return nil, false
+	}
+	if !parser.IsExpression(program.Statements[len(program.Statements)-1]) {
+		return nil, false
+	}
+	return result, true
+}
+
 func printParserErrors(errors []string) {
 	fmt.Println("Parser errors:")
 	for _, err := range errors {
 		fmt.Printf("\t%s\n", err)
 	}
+}
+
+// printEnvironment writes each top-level binding left after running a
+// program, with its value and type, in name order
+func printEnvironment(w io.Writer, interp *interpreter.Interpreter) {
+	env := interp.Globals()
+	fmt.Fprintln(w, "Environment:")
+	for _, name := range env.Names() {
+		value, _ := env.Get(name)
+		fmt.Fprintf(w, "\t%s = %s : %s\n", name, formatResult(interp, value), value.VibeType())
+	}
+}
+
+// printTypeErrors lists the problems the type checker found, each with the
+// line it was found on when that's known
+func printTypeErrors(diagnostics []analysis.Diagnostic) {
+	fmt.Println("Type errors:")
+	for _, diagnostic := range diagnostics {
+		if line := diagnostic.Node.Pos().Line; line > 0 {
+			fmt.Printf("\tline %d: %s\n", line, diagnostic.Message)
+		} else {
+			fmt.Printf("\t%s\n", diagnostic.Message)
+		}
+	}
 }
\ No newline at end of file
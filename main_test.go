@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/example/vibe/interpreter"
+	"github.com/example/vibe/lexer"
+	"github.com/example/vibe/parser"
+	"github.com/example/vibe/types"
+)
+
+func TestProgramResult(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // Empty when the program reports no result
+	}{
+		{"x = 5\nx + 1", "6"},
+		{"[1, 2][0]", "1"},
+		{"x = 5", ""},
+		{"y: int = 5", ""},
+		{"x = 5\nputs x", ""},
+		{"x = 5\nif x > 1\n  x\nend", ""},
+		{"def f() do\n  return 1\nend", ""},
+		{"nil", ""},
+		{`"5" as int`, "5"},
+	}
+
+	for _, tt := range tests {
+		program, errors := parser.Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("Input %q: parser encountered errors: %v", tt.input, errors)
+		}
+
+		interp := interpreter.New()
+		interp.SetOutput(&bytes.Buffer{})
+		value, ok := programResult(program, interp.Eval(program))
+
+		if tt.expected == "" {
+			if ok {
+				t.Errorf("Input %q: expected no result, got %s", tt.input, value.Inspect())
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("Input %q: expected result %s, got none", tt.input, tt.expected)
+			continue
+		}
+		if value.Inspect() != tt.expected {
+			t.Errorf("Input %q: expected result %s, got %s", tt.input, tt.expected, value.Inspect())
+		}
+	}
+}
+
+func TestEvalProgramRecoversFromPanics(t *testing.T) {
+	source := "x = 1\nif x > 0 do\n  broken(x)\nend"
+	program, errors := parser.Parse(lexer.New(source))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	interp := interpreter.New()
+	interp.SetOutput(&bytes.Buffer{})
+	interp.RegisterFunction("broken", func(args []interpreter.Value) interpreter.Value {
+		var values []interpreter.Value
+		return values[0]
+	}, []types.Type{types.AnyType}, types.AnyType)
+
+	_, err := evalProgram(interp, program, source)
+	if err == nil {
+		t.Fatalf("Expected the panic to be reported as an error")
+	}
+
+	expected := "Internal error at line 3: runtime error: index out of range [0] with length 0\n\t3 |   broken(x)"
+	if err.Error() != expected {
+		t.Errorf("Expected error %q, got %q", expected, err.Error())
+	}
+}
+
+func TestEvalProgramReportsPanics(t *testing.T) {
+	source := "try do\n  panic(\"config missing\")\nrescue\n  puts \"rescued\"\nend\nputs \"after\""
+	program, errors := parser.Parse(lexer.New(source))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	var out bytes.Buffer
+	interp := interpreter.New()
+	interp.SetOutput(&out)
+
+	_, err := evalProgram(interp, program, source)
+	if err == nil || err.Error() != "Panic: config missing" {
+		t.Errorf("Expected the panic to be reported, got %v", err)
+	}
+	if out.Len() > 0 {
+		t.Errorf("Expected the program to stop at the panic, got output %q", out.String())
+	}
+}
+
+func TestResultHoldingFunctions(t *testing.T) {
+	source := "def f(x: int): int do\n  return x\nend\nfs: Array<any> = [f]\n[f, f]"
+	program, errors := parser.Parse(lexer.New(source))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	interp := interpreter.New()
+	interp.SetOutput(&bytes.Buffer{})
+	result, err := evalProgram(interp, program, source)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	value, ok := programResult(program, result)
+	if !ok {
+		t.Fatalf("Expected a result, got none")
+	}
+	if got := value.VibeType().String(); got != "Array<def(any) -> int>" {
+		t.Errorf("Expected type Array<def(any) -> int>, got %s", got)
+	}
+}
+
+func TestRuntimeErrorEndingInStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"puts nope\nputs 5", "variable 'nope' not found"},
+		{"x = 1 / 0", "division by zero"},
+	}
+
+	for _, tt := range tests {
+		program, errors := parser.Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("Input %q: parser encountered errors: %v", tt.input, errors)
+		}
+
+		interp := interpreter.New()
+		interp.SetOutput(&bytes.Buffer{})
+		result, err := evalProgram(interp, program, tt.input)
+		if err != nil {
+			t.Fatalf("Input %q: unexpected error: %v", tt.input, err)
+		}
+
+		errVal := runtimeError(result)
+		if errVal == nil {
+			t.Errorf("Input %q: expected a runtime error, got %s", tt.input, result.Inspect())
+			continue
+		}
+		if !strings.Contains(errVal.Error(), tt.expected) {
+			t.Errorf("Input %q: expected error containing %q, got %q", tt.input, tt.expected, errVal.Error())
+		}
+	}
+}
+
+func TestPrintEnvironment(t *testing.T) {
+	interp := interpreter.New()
+	interp.SetOutput(&bytes.Buffer{})
+	if _, err := interp.Run("x = 5\nname = \"vibe\"\ndef double(n: int): int do\n  n * 2\nend"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var out bytes.Buffer
+	printEnvironment(&out, interp)
+	dump := out.String()
+
+	if !strings.HasPrefix(dump, "Environment:\n") {
+		t.Errorf("Expected the dump to start with a heading, got %q", dump)
+	}
+	// Bindings are listed in name order, each with its value and type
+	expected := []string{
+		"\tdouble = def double(n: int): int : ",
+		"\tname = vibe : string\n",
+		"\tx = 5 : int\n",
+	}
+	last := -1
+	for _, line := range expected {
+		idx := strings.Index(dump, line)
+		if idx < 0 {
+			t.Errorf("Expected the dump to contain %q, got %q", line, dump)
+			continue
+		}
+		if idx < last {
+			t.Errorf("Expected %q to come later in %q", line, dump)
+		}
+		last = idx
+	}
+}
+
+func TestReadInputWaitsForCompleteInput(t *testing.T) {
+	// A function and a class pasted in one go, followed by a one-liner
+	pasted := `def larger(a, b) do
+  if a > b
+    return a
+  end
+  return b
+end
+class Point do
+  def x() do
+    return 1
+  end
+end
+larger(1, 2)
+exit
+never read`
+
+	scanner := bufio.NewScanner(strings.NewReader(pasted))
+	var prompts bytes.Buffer
+
+	expected := []string{
+		"def larger(a, b) do\n  if a > b\n    return a\n  end\n  return b\nend",
+		"class Point do\n  def x() do\n    return 1\n  end\nend",
+		"larger(1, 2)",
+	}
+	for _, want := range expected {
+		code, ok := readInput(scanner, &prompts)
+		if !ok {
+			t.Fatalf("Expected input %q, got none", want)
+		}
+		if code != want {
+			t.Errorf("Expected input %q, got %q", want, code)
+		}
+	}
+
+	if code, ok := readInput(scanner, &prompts); ok {
+		t.Errorf("Expected exit to end input, got %q", code)
+	}
+
+	if prompts.String() != ">> .. .. .. .. .. >> .. .. .. .. >> >> " {
+		t.Errorf("Unexpected prompts %q", prompts.String())
+	}
+}
+
+func TestReadInputSubmitsBrokenInput(t *testing.T) {
+	// A real syntax error is submitted straight away rather than waiting
+	scanner := bufio.NewScanner(strings.NewReader("x = [1, 2)\n1"))
+	code, ok := readInput(scanner, &bytes.Buffer{})
+	if !ok || code != "x = [1, 2)" {
+		t.Errorf("Expected the first line alone, got %q", code)
+	}
+
+	// Input that ends unfinished is still returned so its errors can be shown
+	scanner = bufio.NewScanner(strings.NewReader("def f() do\n  return 1"))
+	code, ok = readInput(scanner, &bytes.Buffer{})
+	if !ok || code != "def f() do\n  return 1" {
+		t.Errorf("Expected the unfinished function, got %q", code)
+	}
+	if _, ok := readInput(scanner, &bytes.Buffer{}); ok {
+		t.Errorf("Expected no more input")
+	}
+}
+
+func TestParseProgramRecoversFromPanics(t *testing.T) {
+	// Whatever the parser makes of these, a crash inside it must come back
+	// as an error rather than taking the CLI down
+	for _, source := range []string{"len(,)", "f(,)", "x = 1\ny = len(,)"} {
+		_, errors, err := parseProgram(source)
+		if err == nil && len(errors) == 0 {
+			t.Errorf("Input %q: expected an error", source)
+		}
+	}
+
+	program, errors, err := parseProgram("x = 1 + 2")
+	if err != nil || len(errors) > 0 {
+		t.Fatalf("Unexpected errors: %v %v", err, errors)
+	}
+	if len(program.Statements) != 1 {
+		t.Errorf("Expected 1 statement, got %d", len(program.Statements))
+	}
+}
@@ -0,0 +1,256 @@
+package parser
+
+import (
+	"math"
+	"reflect"
+)
+
+// Fold replaces constant sub-expressions in program with their values, so
+// 2 * (5 + 10) becomes 30 and "a" + "b" becomes "ab" before the program
+// runs. Only operators applied to literals are folded: anything involving a
+// variable or call is left alone, as is an operation that would fail at
+// runtime, such as a division by zero or an integer overflow, so it still
+// reports its error when evaluated. The program is updated in place and
+// returned.
+func Fold(program *Program) *Program {
+	Walk(program, func(node Node) bool {
+		foldChildren(node)
+		return true
+	})
+	return program
+}
+
+// foldChildren folds the expressions held directly by node
+func foldChildren(node Node) {
+	foldAll := func(nodes []Node) {
+		for idx := range nodes {
+			nodes[idx] = fold(nodes[idx])
+		}
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		foldAll(node.Statements)
+	case *BlockStmt:
+		foldAll(node.Statements)
+	case *BinaryExpr:
+		node.Left, node.Right = fold(node.Left), fold(node.Right)
+	case *UnaryExpr:
+		node.Right = fold(node.Right)
+	case *CastExpr:
+		node.Value = fold(node.Value)
+	case *CallExpr:
+		foldAll(node.Args)
+	case *ArrayLiteral:
+		foldAll(node.Elements)
+	case *MapLiteral:
+		foldAll(node.Keys)
+		foldAll(node.Values)
+	case *IndexExpr:
+		node.Array, node.Index = fold(node.Array), fold(node.Index)
+	case *SliceExpr:
+		node.Start, node.End, node.Step = fold(node.Start), fold(node.End), fold(node.Step)
+	case *MethodCall:
+		foldAll(node.Args)
+	case *ClassInst:
+		foldAll(node.Arguments)
+	case *ClassDef:
+		for idx := range node.Fields {
+			node.Fields[idx].Default = fold(node.Fields[idx].Default)
+		}
+	case *Assignment:
+		node.Value = fold(node.Value)
+	case *IndexAssignment:
+		node.Value = fold(node.Value)
+	case *VariableDecl:
+		node.Value = fold(node.Value)
+	case *PrintStmt:
+		node.Value = fold(node.Value)
+	case *ReturnStmt:
+		node.Value = fold(node.Value)
+	case *IfStmt:
+		node.Condition = fold(node.Condition)
+		for idx := range node.ElseIfBlocks {
+			node.ElseIfBlocks[idx].Condition = fold(node.ElseIfBlocks[idx].Condition)
+		}
+	case *WhileStmt:
+		node.Condition = fold(node.Condition)
+	case *DoWhileStmt:
+		node.Condition = fold(node.Condition)
+	case *ForStmt:
+		node.Iterable = fold(node.Iterable)
+	}
+}
+
+// fold returns the literal that node evaluates to when it's a constant
+// expression, and node itself otherwise
+func fold(node Node) Node {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return node
+	}
+
+	var folded Node
+	switch node := node.(type) {
+	case *BinaryExpr:
+		node.Left, node.Right = fold(node.Left), fold(node.Right)
+		folded = foldBinary(node)
+	case *UnaryExpr:
+		node.Right = fold(node.Right)
+		folded = foldUnary(node)
+	}
+	if folded == nil {
+		return node
+	}
+
+	// The value takes the place of the expression in the source
+	if positioned, ok := folded.(interface{ setPos(Position) }); ok {
+		positioned.setPos(node.Pos())
+	}
+	return folded
+}
+
+func foldUnary(node *UnaryExpr) Node {
+	switch right := node.Right.(type) {
+	case *BooleanLiteral:
+		if node.Operator == "!" {
+			return &BooleanLiteral{Value: !right.Value}
+		}
+	case *NumberLiteral:
+		if node.Operator != "-" {
+			return nil
+		}
+		if !right.IsInt {
+			return &NumberLiteral{Value: -right.Value}
+		}
+		if right.Integer() == math.MinInt64 {
+			return nil
+		}
+		return intLiteral(-right.Integer())
+	}
+	return nil
+}
+
+func foldBinary(node *BinaryExpr) Node {
+	// A boolean on the left of && or || can decide the result without the
+	// right side, which isn't evaluated at runtime either
+	if left, ok := node.Left.(*BooleanLiteral); ok {
+		if (node.Operator == "&&" && !left.Value) || (node.Operator == "||" && left.Value) {
+			return &BooleanLiteral{Value: left.Value}
+		}
+		if right, ok := node.Right.(*BooleanLiteral); ok && (node.Operator == "&&" || node.Operator == "||") {
+			return &BooleanLiteral{Value: right.Value}
+		}
+	}
+
+	if left, ok := node.Left.(*StringLiteral); ok {
+		if right, ok := node.Right.(*StringLiteral); ok && node.Operator == "+" {
+			return &StringLiteral{Value: left.Value + right.Value}
+		}
+		return nil
+	}
+
+	left, ok := node.Left.(*NumberLiteral)
+	if !ok {
+		return nil
+	}
+	right, ok := node.Right.(*NumberLiteral)
+	if !ok {
+		return nil
+	}
+	if left.IsInt && right.IsInt {
+		return foldIntegers(node.Operator, left.Integer(), right.Integer())
+	}
+
+	// Mixing an int and a float widens the int, as at runtime
+	leftVal, rightVal := numberValue(left), numberValue(right)
+	switch node.Operator {
+	case "+":
+		return &NumberLiteral{Value: leftVal + rightVal}
+	case "-":
+		return &NumberLiteral{Value: leftVal - rightVal}
+	case "*":
+		return &NumberLiteral{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return nil
+		}
+		return &NumberLiteral{Value: leftVal / rightVal}
+	}
+	return compareNumbers(node.Operator, leftVal, rightVal)
+}
+
+func foldIntegers(operator string, left, right int64) Node {
+	switch operator {
+	case "+":
+		sum := left + right
+		if (left < 0) == (right < 0) && (sum < 0) != (left < 0) {
+			return nil
+		}
+		return intLiteral(sum)
+	case "-":
+		difference := left - right
+		if (left < 0) != (right < 0) && (difference < 0) != (left < 0) {
+			return nil
+		}
+		return intLiteral(difference)
+	case "*":
+		if left == 0 || right == 0 {
+			return intLiteral(0)
+		}
+		product := left * right
+		if product/right != left || (left == math.MinInt64 && right == -1) {
+			return nil
+		}
+		return intLiteral(product)
+	case "/", "%":
+		if right == 0 || (left == math.MinInt64 && right == -1) {
+			return nil
+		}
+		if operator == "/" {
+			return intLiteral(left / right)
+		}
+		return intLiteral(left % right)
+	case "<":
+		return &BooleanLiteral{Value: left < right}
+	case ">":
+		return &BooleanLiteral{Value: left > right}
+	case "<=":
+		return &BooleanLiteral{Value: left <= right}
+	case ">=":
+		return &BooleanLiteral{Value: left >= right}
+	case "==":
+		return &BooleanLiteral{Value: left == right}
+	case "!=":
+		return &BooleanLiteral{Value: left != right}
+	}
+	return nil
+}
+
+func compareNumbers(operator string, left, right float64) Node {
+	switch operator {
+	case "<":
+		return &BooleanLiteral{Value: left < right}
+	case ">":
+		return &BooleanLiteral{Value: left > right}
+	case "<=":
+		return &BooleanLiteral{Value: left <= right}
+	case ">=":
+		return &BooleanLiteral{Value: left >= right}
+	case "==":
+		return &BooleanLiteral{Value: left == right}
+	case "!=":
+		return &BooleanLiteral{Value: left != right}
+	}
+	return nil
+}
+
+func intLiteral(value int64) *NumberLiteral {
+	return &NumberLiteral{Value: float64(value), IsInt: true, Int: value}
+}
+
+func numberValue(number *NumberLiteral) float64 {
+	if number.IsInt {
+		return float64(number.Integer())
+	}
+	return number.Value
+}
@@ -0,0 +1,69 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/example/vibe/lexer"
+	"github.com/example/vibe/parser"
+)
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Arithmetic and comparisons on literals
+		{"2 * (5 + 10)", "Number(30)"},
+		{"7 / 2 - 1", "Number(2)"},
+		{"1 + 2.5", "Number(3.500000)"},
+		{"-(3 * 2)", "Number(-6)"},
+		{"x = 1 + 1 < 3", "Assignment(x = Boolean(true))"},
+		{"!(2 == 2)", "Boolean(false)"},
+		{"false && y", "Boolean(false)"},
+		// String concatenation
+		{`"a" + "b"`, `String("ab")`},
+		{`puts "Hello, " + "World"`, `PrintStmt(String("Hello, World"))`},
+		// Nested inside statements and collections
+		{"def f() do\n  return 60 * 60\nend", "FunctionDef(f, [], Block {\n  ReturnStmt(Number(3600))\n})"},
+		{"[1 + 1, 2 * 2]", "[Number(2), Number(4)]"},
+		{"while 1 > 2 do\nend", "WhileStmt(Boolean(false), Block {\n})"},
+		{"(1 + 2) as float", "Cast(Number(3) as Type(float))"},
+		// Anything involving a variable or call is left alone
+		{"x + 1", "BinaryExpr(x + Number(1))"},
+		{"x * (2 + 3)", "BinaryExpr(x * Number(5))"},
+		{"f(1) + 2", "BinaryExpr(CallExpr(f, [Number(1)]) + Number(2))"},
+		{`"a" + name`, `BinaryExpr(String("a") + CallExpr(name, []))`},
+		{"true && y", "BinaryExpr(Boolean(true) && CallExpr(y, []))"},
+		// So are operations that fail, which must still fail at runtime
+		{"1 / 0", "BinaryExpr(Number(1) / Number(0))"},
+		{"9223372036854775807 + 1", "BinaryExpr(Number(9223372036854775807) + Number(1))"},
+		{`"a" + 1`, `BinaryExpr(String("a") + Number(1))`},
+	}
+
+	for _, tt := range tests {
+		program, errors := parser.Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("%q: parser encountered errors: %v", tt.input, errors)
+		}
+
+		folded := parser.Fold(program)
+		if len(folded.Statements) != 1 {
+			t.Fatalf("%q: expected 1 statement, got %d", tt.input, len(folded.Statements))
+		}
+		if got := folded.Statements[0].String(); got != tt.expected {
+			t.Errorf("%q: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestFoldKeepsPosition(t *testing.T) {
+	program, errors := parser.Parse(lexer.New("x = 1\ny = 2 + 3"))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	assignment := parser.Fold(program).Statements[1].(*parser.Assignment)
+	if pos := assignment.Value.Pos(); pos.Line != 2 || pos.Column != 5 {
+		t.Errorf("Expected the folded value at 2:5, got %d:%d", pos.Line, pos.Column)
+	}
+}
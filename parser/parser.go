@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
 
@@ -22,9 +23,11 @@ const (
 	ReturnStmtNode   NodeType = "ReturnStmt"
 	IfStmtNode       NodeType = "IfStmt"
 	WhileStmtNode    NodeType = "WhileStmt"
+	DoWhileStmtNode  NodeType = "DoWhileStmt"
 	ForStmtNode      NodeType = "ForStmt"
 	BlockStmtNode    NodeType = "BlockStmt"
 	AssignmentNode   NodeType = "Assignment"
+	IndexAssignmentNode NodeType = "IndexAssignment"
 	VariableUseNode  NodeType = "VariableUse"
 	BooleanNode      NodeType = "Boolean"
 	NilNode          NodeType = "Nil"
@@ -34,9 +37,18 @@ const (
 	VariableDeclNode NodeType = "VariableDecl"
 	UnaryExprNode    NodeType = "UnaryExpr"
 	ArrayLiteralNode   NodeType = "ArrayLiteral"
+	MapLiteralNode   NodeType = "MapLiteral"
 	IndexExprNode    NodeType = "IndexExpr"
+	SliceExprNode    NodeType = "SliceExpr"
 	DotExprNode      NodeType = "DotExpr"
 	RequireStmtNode  NodeType = "RequireStmt"
+	BlockLiteralNode NodeType = "BlockLiteral"
+	BreakStmtNode    NodeType = "BreakStmt"
+	ContinueStmtNode NodeType = "ContinueStmt"
+	MacroDefNode     NodeType = "MacroDef"
+	TryStmtNode      NodeType = "TryStmt"
+	UndefStmtNode    NodeType = "UndefStmt"
+	CastExprNode     NodeType = "CastExpr"
 
 	// Class-related node types
 	ClassDefNode      NodeType = "ClassDef"      // For class definitions
@@ -50,25 +62,60 @@ const (
 
 // Operator precedence
 const (
-	LOWEST     = 1
-	EQUALS     = 2  // ==
-	LESSGREATER = 3  // > or <
-	SUM        = 4  // +
-	PRODUCT    = 5  // *
-	PREFIX     = 6  // -X or !X
-	CALL       = 7  // myFunction(X)
-	INDEX      = 8  // array[index]
-	DOT        = 9  // obj.property
+	LOWEST      = 1
+	LOGICAL_OR  = 2  // ||
+	LOGICAL_AND = 3  // &&
+	EQUALS      = 4  // ==
+	LESSGREATER = 5  // > or <
+	SUM         = 6  // +
+	PRODUCT     = 7  // *
+	CAST        = 8  // X as int
+	PREFIX      = 9  // -X or !X
+	POWER       = 10 // **, binds tighter than unary minus as in Ruby
+	CALL        = 11 // myFunction(X)
+	INDEX       = 12 // array[index]
+	DOT         = 13 // obj.property
 )
 
 // Node represents a node in the AST
 type Node interface {
 	Type() NodeType
 	String() string
+	Pos() Position
+}
+
+// Position is where a node starts in the source. Lines and columns count
+// from 1; a zero Line means the node wasn't parsed from source.
+type Position struct {
+	Line   int
+	Column int
+}
+
+// Pos returns the position. Every node embeds a Position, which makes it
+// satisfy this part of Node.
+func (p Position) Pos() Position { return p }
+
+func (p *Position) setPos(pos Position) {
+	if p.Line == 0 {
+		*p = pos
+	}
+}
+
+// at records tok as the position of node, unless the node already has one
+// from a more specific token
+func at(node Node, tok lexer.Token) Node {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return node
+	}
+	if positioned, ok := node.(interface{ setPos(Position) }); ok {
+		positioned.setPos(Position{Line: tok.Line, Column: tok.Column})
+	}
+	return node
 }
 
 // Program is the root node of the AST
 type Program struct {
+	Position
 	Statements []Node
 }
 
@@ -84,20 +131,32 @@ func (p *Program) String() string {
 
 // NumberLiteral represents a number literal
 type NumberLiteral struct {
+	Position
 	Value float64
 	IsInt bool
+	Int   int64 // Exact value of an integer literal, which Value can't always hold
 }
 
 func (n *NumberLiteral) Type() NodeType { return NumberNode }
 func (n *NumberLiteral) String() string {
 	if n.IsInt {
-		return fmt.Sprintf("Number(%d)", int(n.Value))
+		return fmt.Sprintf("Number(%d)", n.Integer())
 	}
 	return fmt.Sprintf("Number(%f)", n.Value)
 }
 
+// Integer returns the value of an integer literal. Literals built without
+// Int set fall back to Value.
+func (n *NumberLiteral) Integer() int64 {
+	if n.Int == 0 {
+		return int64(n.Value)
+	}
+	return n.Int
+}
+
 // StringLiteral represents a string literal
 type StringLiteral struct {
+	Position
 	Value string
 }
 
@@ -106,6 +165,7 @@ func (s *StringLiteral) String() string { return fmt.Sprintf("String(%q)", s.Val
 
 // Identifier represents a variable or function name
 type Identifier struct {
+	Position
 	Name string
 }
 
@@ -114,6 +174,7 @@ func (i *Identifier) String() string { return i.Name }
 
 // BinaryExpr represents a binary expression (e.g. a + b)
 type BinaryExpr struct {
+	Position
 	Left     Node
 	Operator string
 	Right    Node
@@ -137,8 +198,10 @@ func (b *BinaryExpr) String() string {
 
 // CallExpr represents a function call
 type CallExpr struct {
+	Position
 	Function Node
 	Args     []Node
+	Bare     bool // A name written without parentheses, which may be a variable
 }
 
 func (c *CallExpr) Type() NodeType { return CallExprNode }
@@ -154,8 +217,29 @@ func (c *CallExpr) String() string {
 	return result
 }
 
+// BlockLiteral represents a do/end block passed as the trailing argument of a call
+type BlockLiteral struct {
+	Position
+	Parameters []Parameter
+	Body       *BlockStmt
+}
+
+func (b *BlockLiteral) Type() NodeType { return BlockLiteralNode }
+func (b *BlockLiteral) String() string {
+	result := "Block(|"
+	for i, param := range b.Parameters {
+		if i > 0 {
+			result += ", "
+		}
+		result += param.String()
+	}
+	result += "|, " + b.Body.String() + ")"
+	return result
+}
+
 // TypeAnnotation represents a type annotation
 type TypeAnnotation struct {
+	Position
 	TypeName    string
 	GenericType *TypeAnnotation
 	TypeParams  []Node // For generic types like Array<string>
@@ -193,6 +277,7 @@ func (p *Parameter) String() string {
 
 // FunctionDef represents a function definition
 type FunctionDef struct {
+	Position
 	Name       string
 	Parameters []Parameter
 	ReturnType *TypeAnnotation
@@ -213,8 +298,32 @@ func (f *FunctionDef) String() string {
 	return result
 }
 
+// MacroDef represents a macro definition. Its body runs before the program
+// and returns source code that replaces each call to the macro.
+type MacroDef struct {
+	Position
+	Name       string
+	Parameters []Parameter
+	Body       *BlockStmt
+}
+
+func (m *MacroDef) Type() NodeType { return MacroDefNode }
+func (m *MacroDef) String() string {
+	result := fmt.Sprintf("MacroDef(%s, [", m.Name)
+	for i, param := range m.Parameters {
+		if i > 0 {
+			result += ", "
+		}
+		result += param.String()
+	}
+	result += "], " + m.Body.String() + ")"
+
+	return result
+}
+
 // ReturnStmt represents a return statement
 type ReturnStmt struct {
+	Position
 	Value Node
 }
 
@@ -228,6 +337,7 @@ func (r *ReturnStmt) String() string {
 
 // IfStmt represents an if statement
 type IfStmt struct {
+	Position
 	Condition     Node
 	Consequence   *BlockStmt
 	Alternative   *BlockStmt
@@ -252,10 +362,41 @@ func (i *IfStmt) String() string {
 	return result
 }
 
+// TryStmt represents a try block and the rescue clauses that handle its errors
+type TryStmt struct {
+	Position
+	Body    *BlockStmt
+	Rescues []RescueClause
+}
+
+// RescueClause handles errors of the named Kind, or of any kind when Kind is
+// empty, binding the error to Variable when one is given (rescue TypeError as e)
+type RescueClause struct {
+	Kind     string
+	Variable string
+	Body     *BlockStmt
+}
+
+func (t *TryStmt) Type() NodeType { return TryStmtNode }
+func (t *TryStmt) String() string {
+	result := fmt.Sprintf("TryStmt(%s", t.Body.String())
+	for _, rescue := range t.Rescues {
+		header := rescue.Kind
+		if rescue.Variable != "" {
+			header = strings.TrimSpace(header + " as " + rescue.Variable)
+		}
+		result += fmt.Sprintf(", Rescue(%s, %s)", header, rescue.Body.String())
+	}
+	result += ")"
+	return result
+}
+
 // WhileStmt represents a while loop
 type WhileStmt struct {
+	Position
 	Condition Node
 	Body      *BlockStmt
+	Label     string // Optional label targeted by break/continue (outer: while ...)
 }
 
 func (w *WhileStmt) Type() NodeType { return WhileStmtNode }
@@ -270,11 +411,80 @@ func (w *WhileStmt) String() string {
 		bodyStr = w.Body.String()
 	}
 
-	return fmt.Sprintf("WhileStmt(%s, %s)", condStr, bodyStr)
+	return labelPrefix(w.Label) + fmt.Sprintf("WhileStmt(%s, %s)", condStr, bodyStr)
 }
 
+// DoWhileStmt represents a loop whose condition is checked after its body,
+// so the body always runs at least once (do ... end while condition)
+type DoWhileStmt struct {
+	Position
+	Body      *BlockStmt
+	Condition Node
+}
+
+func (d *DoWhileStmt) Type() NodeType { return DoWhileStmtNode }
+func (d *DoWhileStmt) String() string {
+	bodyStr := "<nil>"
+	if d.Body != nil {
+		bodyStr = d.Body.String()
+	}
+
+	condStr := "<nil>"
+	if d.Condition != nil {
+		condStr = d.Condition.String()
+	}
+
+	return fmt.Sprintf("DoWhileStmt(%s, %s)", bodyStr, condStr)
+}
+
+// labelPrefix renders a loop label ahead of the loop it names
+func labelPrefix(label string) string {
+	if label == "" {
+		return ""
+	}
+	return label + ": "
+}
+
+// BreakStmt represents a break statement, optionally naming the loop to leave
+type BreakStmt struct {
+	Position
+	Label string
+}
+
+func (b *BreakStmt) Type() NodeType { return BreakStmtNode }
+func (b *BreakStmt) String() string {
+	if b.Label == "" {
+		return "Break"
+	}
+	return fmt.Sprintf("Break(%s)", b.Label)
+}
+
+// ContinueStmt represents a continue statement, optionally naming the loop to resume
+type ContinueStmt struct {
+	Position
+	Label string
+}
+
+func (c *ContinueStmt) Type() NodeType { return ContinueStmtNode }
+func (c *ContinueStmt) String() string {
+	if c.Label == "" {
+		return "Continue"
+	}
+	return fmt.Sprintf("Continue(%s)", c.Label)
+}
+
+// UndefStmt represents an undef statement, which removes a variable
+type UndefStmt struct {
+	Position
+	Name string
+}
+
+func (u *UndefStmt) Type() NodeType { return UndefStmtNode }
+func (u *UndefStmt) String() string { return fmt.Sprintf("Undef(%s)", u.Name) }
+
 // BlockStmt represents a block of statements
 type BlockStmt struct {
+	Position
 	Statements []Node
 }
 
@@ -290,6 +500,7 @@ func (b *BlockStmt) String() string {
 
 // Assignment represents a variable assignment
 type Assignment struct {
+	Position
 	Name  string
 	Value Node
 }
@@ -302,8 +513,21 @@ func (a *Assignment) String() string {
 	return fmt.Sprintf("Assignment(%s = %s)", a.Name, a.Value.String())
 }
 
+// IndexAssignment represents assigning to an element, a[0] = 1 or m["k"] = v
+type IndexAssignment struct {
+	Position
+	Target *IndexExpr
+	Value  Node
+}
+
+func (a *IndexAssignment) Type() NodeType { return IndexAssignmentNode }
+func (a *IndexAssignment) String() string {
+	return fmt.Sprintf("IndexAssignment(%s = %s)", a.Target.String(), a.Value.String())
+}
+
 // BooleanLiteral represents a boolean value
 type BooleanLiteral struct {
+	Position
 	Value bool
 }
 
@@ -311,13 +535,16 @@ func (b *BooleanLiteral) Type() NodeType { return BooleanNode }
 func (b *BooleanLiteral) String() string { return fmt.Sprintf("Boolean(%t)", b.Value) }
 
 // NilLiteral represents a nil value
-type NilLiteral struct{}
+type NilLiteral struct {
+	Position
+}
 
 func (n *NilLiteral) Type() NodeType { return NilNode }
 func (n *NilLiteral) String() string { return "Nil" }
 
 // PrintStmt represents a print statement
 type PrintStmt struct {
+	Position
 	Value Node
 }
 
@@ -331,6 +558,7 @@ func (p *PrintStmt) String() string {
 
 // TypeDeclaration represents a type declaration (type aliases and interfaces)
 type TypeDeclaration struct {
+	Position
 	Name      string
 	TypeValue Node // Could be a TypeAnnotation or another structure
 }
@@ -342,6 +570,7 @@ func (t *TypeDeclaration) String() string {
 
 // VariableDecl represents a variable declaration with a type
 type VariableDecl struct {
+	Position
 	Name           string
 	TypeAnnotation *TypeAnnotation
 	Value          Node // Initial value (can be nil)
@@ -358,6 +587,7 @@ func (v *VariableDecl) String() string {
 
 // UnaryExpr represents a unary expression like !x or -5
 type UnaryExpr struct {
+	Position
 	Operator string
 	Right    Node
 }
@@ -370,8 +600,21 @@ func (u *UnaryExpr) String() string {
 	return fmt.Sprintf("(%s%s)", u.Operator, u.Right.String())
 }
 
+// CastExpr converts a value to a type, as in x as int
+type CastExpr struct {
+	Position
+	Value  Node
+	Target *TypeAnnotation
+}
+
+func (c *CastExpr) Type() NodeType { return CastExprNode }
+func (c *CastExpr) String() string {
+	return fmt.Sprintf("Cast(%s as %s)", c.Value.String(), c.Target.String())
+}
+
 // ArrayLiteral represents an array literal
 type ArrayLiteral struct {
+	Position
 	Elements []Node
 }
 
@@ -388,8 +631,30 @@ func (a *ArrayLiteral) String() string {
 	return result
 }
 
+// MapLiteral represents a map literal, {key: value, ...}, with its entries
+// in source order
+type MapLiteral struct {
+	Position
+	Keys   []Node
+	Values []Node
+}
+
+func (m *MapLiteral) Type() NodeType { return MapLiteralNode }
+func (m *MapLiteral) String() string {
+	result := "{"
+	for i, key := range m.Keys {
+		if i > 0 {
+			result += ", "
+		}
+		result += key.String() + ": " + m.Values[i].String()
+	}
+	result += "}"
+	return result
+}
+
 // IndexExpr represents an index expression
 type IndexExpr struct {
+	Position
 	Array Node
 	Index Node
 }
@@ -399,22 +664,54 @@ func (i *IndexExpr) String() string {
 	return fmt.Sprintf("%s[%s]", i.Array.String(), i.Index.String())
 }
 
+// SliceExpr represents a slice expression, array[start:end:step].
+// Omitted parts are nil.
+type SliceExpr struct {
+	Position
+	Array Node
+	Start Node
+	End   Node
+	Step  Node
+}
+
+func (s *SliceExpr) Type() NodeType { return SliceExprNode }
+func (s *SliceExpr) String() string {
+	part := func(node Node) string {
+		if node == nil {
+			return ""
+		}
+		return node.String()
+	}
+	if s.Step == nil {
+		return fmt.Sprintf("%s[%s:%s]", s.Array.String(), part(s.Start), part(s.End))
+	}
+	return fmt.Sprintf("%s[%s:%s:%s]", s.Array.String(), part(s.Start), part(s.End), part(s.Step))
+}
+
 // DotExpr represents a dot expression
 type DotExpr struct {
+	Position
 	Object   Node
 	Property string
+	Optional bool // True for optional chaining (obj?.property)
 }
 
 func (d *DotExpr) Type() NodeType { return DotExprNode }
 func (d *DotExpr) String() string {
+	if d.Optional {
+		return fmt.Sprintf("%s?.%s", d.Object.String(), d.Property)
+	}
 	return fmt.Sprintf("%s.%s", d.Object.String(), d.Property)
 }
 
 // ForStmt represents a for loop with iterator
 type ForStmt struct {
+	Position
 	Iterator  string     // The variable that will hold each element
+	Value     string     // Optional second variable, bound to each value when iterating a map
 	Iterable  Node       // The expression to iterate over
 	Body      *BlockStmt
+	Label     string     // Optional label targeted by break/continue (outer: for ...)
 }
 
 func (f *ForStmt) Type() NodeType { return ForStmtNode }
@@ -429,14 +726,21 @@ func (f *ForStmt) String() string {
 		bodyStr = f.Body.String()
 	}
 
-	return fmt.Sprintf("ForStmt(%s in %s, %s)", f.Iterator, iterableStr, bodyStr)
+	iterator := f.Iterator
+	if f.Value != "" {
+		iterator += ", " + f.Value
+	}
+
+	return labelPrefix(f.Label) + fmt.Sprintf("ForStmt(%s in %s, %s)", iterator, iterableStr, bodyStr)
 }
 
 // MethodCall represents a method call expression
 type MethodCall struct {
-	Object Node   // The object on which the method is called
-	Method string // The name of the method
-	Args   []Node // Arguments passed to the method
+	Position
+	Object   Node   // The object on which the method is called
+	Method   string // The name of the method
+	Args     []Node // Arguments passed to the method
+	Optional bool   // True for optional chaining (obj?.method())
 }
 
 // Type returns the type of the node
@@ -451,11 +755,16 @@ func (m *MethodCall) String() string {
 		args = append(args, arg.String())
 	}
 
+	if m.Optional {
+		return fmt.Sprintf("%s?.%s(%s)", m.Object.String(), m.Method, strings.Join(args, ", "))
+	}
 	return fmt.Sprintf("%s.%s(%s)", m.Object.String(), m.Method, strings.Join(args, ", "))
 }
 
 // SelfExpr represents a 'self' expression in a method
-type SelfExpr struct{}
+type SelfExpr struct {
+	Position
+}
 
 // Type returns the type of the node
 func (s *SelfExpr) Type() NodeType {
@@ -474,10 +783,22 @@ type Parser struct {
 	peekToken lexer.Token
 	errors    []string
 	seenNonRequireStmt bool // Track if we've seen non-require statements
+	noBlock   bool // Set while parsing if/while/for headers, where 'do' opens the body rather than a block
+
+	// curAfterNewline and peekAfterNewline record whether a line break came
+	// just before curToken and peekToken, outside of any brackets. brackets
+	// counts the ( [ and { that are open up to curToken.
+	curAfterNewline  bool
+	peekAfterNewline bool
+	brackets         int
 }
 
 // New creates a new parser
 func New(l *lexer.Lexer) *Parser {
+	// Line breaks aren't tokens the grammar deals with, but they let an
+	// expression end before a ( [ or - that starts the next line
+	l.SetEmitNewlines(true)
+
 	p := &Parser{l: l, seenNonRequireStmt: false}
 	// Read two tokens, so curToken and peekToken are both set
 	p.nextToken()
@@ -487,7 +808,47 @@ func New(l *lexer.Lexer) *Parser {
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+	p.curAfterNewline = p.peekAfterNewline
+
+	switch p.curToken.Type {
+	case lexer.LPAREN, lexer.LBRACKET, lexer.LBRACE:
+		p.brackets++
+	case lexer.RPAREN, lexer.RBRACKET, lexer.RBRACE:
+		if p.brackets > 0 {
+			p.brackets--
+		}
+	}
+
+	// Inside brackets an expression may carry on over several lines
+	var newline bool
+	p.peekToken, newline = p.lexToken()
+	p.peekAfterNewline = newline && p.brackets == 0
+}
+
+// lexToken reads the next token from the lexer, skipping line breaks, and
+// reports whether it skipped any
+func (p *Parser) lexToken() (lexer.Token, bool) {
+	tok := p.l.NextToken()
+	newline := false
+	for tok.Type == lexer.NEWLINE {
+		tok = p.l.NextToken()
+		newline = true
+	}
+	return tok, newline
+}
+
+// startsLine reports whether a token that begins a new line should start a
+// new statement rather than continue the expression on the line before.
+// A ( [ - or + could do either, so the line break decides.
+func startsLine(tokenType lexer.TokenType, afterNewline bool) bool {
+	if !afterNewline {
+		return false
+	}
+	switch tokenType {
+	case lexer.LPAREN, lexer.LBRACKET, lexer.MINUS, lexer.PLUS:
+		return true
+	}
+	return false
 }
 
 func (p *Parser) Errors() []string {
@@ -518,18 +879,13 @@ func (p *Parser) parseProgram() *Program {
 
 	fmt.Println("DEBUG: Starting to parse program")
 
-	// Track latest identifier for possible assignments across tokens
-	var lastIdent string
-	var expectingAssignment bool
-	var expectingTypeAnnotation bool
-	var typeAnnotation *TypeAnnotation
-
 	for p.curToken.Type != lexer.EOF {
 		fmt.Printf("DEBUG: parseProgram - current token: %s, literal: %s, peek token: %s, literal: %s\n",
 			p.curToken.Type, p.curToken.Literal, p.peekToken.Type, p.peekToken.Literal)
 
-		// Special handling for class blocks
-		if p.curToken.Type == lexer.CLASS || (p.peekToken.Type == lexer.INHERITS && p.curToken.Type == lexer.IDENT) {
+		// Classes written without 'do' are an older syntax that is skipped
+		// rather than parsed; class Name do ... end is parsed as a statement
+		if (p.curToken.Type == lexer.CLASS && !p.atClassWithDo()) || (p.peekToken.Type == lexer.INHERITS && p.curToken.Type == lexer.IDENT) {
 			// ... existing code for class handling ...
 			// For now, just skip over the class definition to avoid infinite loop
 			// Skip 'class' token
@@ -561,8 +917,13 @@ func (p *Parser) parseProgram() *Program {
 				}
 
 				// Check for end of class at top level
-				if depth == 0 && (p.curToken.Type == lexer.CLASS ||
-					p.curToken.Type == lexer.EOF) {
+				if depth == 0 && p.curToken.Type == lexer.CLASS {
+					break
+				}
+
+				// Running out of input at any depth means the class was never closed
+				if p.curToken.Type == lexer.EOF {
+					p.errors = append(p.errors, "Expected 'end' to close class definition")
 					break
 				}
 
@@ -576,81 +937,23 @@ func (p *Parser) parseProgram() *Program {
 		}
 
 		// Check for variable declaration with type annotation (a: string = "hello")
-		if p.curToken.Type == lexer.IDENT && p.peekToken.Type == lexer.COLON {
-			lastIdent = p.curToken.Literal
-			expectingTypeAnnotation = true
-			p.nextToken() // Move to COLON token
-			p.nextToken() // Move past COLON to the type
-
-			// Parse the type annotation
-			typeAnnotation = p.parseTypeAnnotation()
-
-			// If the next token is '=', we also have a value
-			if p.curToken.Type == lexer.ASSIGN {
-				expectingAssignment = true
-				p.nextToken() // Move past ASSIGN to the expression
-				fmt.Printf("DEBUG: parseProgram - Recognized variable declaration with type for '%s', now at token: %s\n",
-					lastIdent, p.curToken.Type)
-			} else {
-				// Handle the case where there's no assignment (just a declaration)
-				varDecl := &VariableDecl{
-					Name:           lastIdent,
-					TypeAnnotation: typeAnnotation,
-					Value:          nil, // No initial value
-				}
+		if p.curToken.Type == lexer.IDENT && p.peekToken.Type == lexer.COLON && !p.atLoopLabel() {
+			if varDecl := p.parseTypedDeclaration(); varDecl != nil {
 				program.Statements = append(program.Statements, varDecl)
 				fmt.Printf("DEBUG: parseProgram - added variable declaration: %s\n", varDecl.String())
-				expectingTypeAnnotation = false
-				expectingAssignment = false
-				lastIdent = ""
-				typeAnnotation = nil
 				p.seenNonRequireStmt = true // Mark that we've seen a non-require statement
 			}
-		} else if p.curToken.Type == lexer.IDENT && p.peekToken.Type == lexer.ASSIGN {
-			// Regular assignment without type annotation
-			lastIdent = p.curToken.Literal
-			expectingAssignment = true
-			p.nextToken() // Move to ASSIGN token
-			p.nextToken() // Move past ASSIGN to the expression
-			fmt.Printf("DEBUG: parseProgram - Recognized assignment to variable '%s', now at token: %s\n",
-				lastIdent, p.curToken.Type)
+			continue
 		}
 
 		stmt := p.parseStatement()
 		if stmt != nil {
-			// If we were expecting an assignment with a type annotation
-			if expectingAssignment && expectingTypeAnnotation {
-				varDecl := &VariableDecl{
-					Name:           lastIdent,
-					TypeAnnotation: typeAnnotation,
-					Value:          stmt,
-				}
-				program.Statements = append(program.Statements, varDecl)
-				fmt.Printf("DEBUG: parseProgram - added variable declaration with value: %s\n", varDecl.String())
-				expectingAssignment = false
-				expectingTypeAnnotation = false
-				lastIdent = ""
-				typeAnnotation = nil
-				p.seenNonRequireStmt = true // Mark that we've seen a non-require statement
-			} else if expectingAssignment {
-				// Regular assignment without type annotation
-				assignment := &Assignment{
-					Name:  lastIdent,
-					Value: stmt,
-				}
-				program.Statements = append(program.Statements, assignment)
-				fmt.Printf("DEBUG: parseProgram - added assignment: %s\n", assignment.String())
-				expectingAssignment = false
-				lastIdent = ""
-				p.seenNonRequireStmt = true // Mark that we've seen a non-require statement
-			} else {
-				program.Statements = append(program.Statements, stmt)
-				fmt.Printf("DEBUG: parseProgram - added statement: %T - %s\n", stmt, stmt.String())
+			program.Statements = append(program.Statements, stmt)
+			fmt.Printf("DEBUG: parseProgram - added statement: %T - %s\n", stmt, stmt.String())
 
-				// Only set the flag if this is not a require statement
-				if stmt.Type() != RequireStmtNode {
-					p.seenNonRequireStmt = true
-				}
+			// Only set the flag if this is not a require statement
+			if stmt.Type() != RequireStmtNode {
+				p.seenNonRequireStmt = true
 			}
 		} else if p.curToken.Type != lexer.EOF {
 			// If statement is nil and we're not at EOF, skip this token
@@ -667,24 +970,53 @@ func (p *Parser) parseProgram() *Program {
 	return program
 }
 
+// parseStatement parses a statement, recording where it starts
 func (p *Parser) parseStatement() Node {
+	start := p.curToken
+	return at(p.parseStatementNode(), start)
+}
+
+func (p *Parser) parseStatementNode() Node {
 	fmt.Printf("DEBUG: parseStatement - current token: %s, literal: %s\n", p.curToken.Type, p.curToken.Literal)
 
 	switch p.curToken.Type {
 	case lexer.IDENT:
+		if p.atLoopLabel() {
+			return p.parseLabeledLoop()
+		}
+
 		// Check if this is an assignment
 		if p.peekToken.Type == lexer.ASSIGN || p.peekToken.Type == lexer.PLUS_ASSIGN ||
 		   p.peekToken.Type == lexer.MINUS_ASSIGN || p.peekToken.Type == lexer.MUL_ASSIGN ||
 		   p.peekToken.Type == lexer.DIV_ASSIGN || p.peekToken.Type == lexer.MOD_ASSIGN {
 			return p.parseCompoundAssignment()
 		}
-		return p.parseExpressionStatement()
+
+		// A bare name is parsed as a call, so x++ is recognized up front
+		if isUpdateOperator(p.peekToken.Type) {
+			name := p.curToken.Literal
+			p.nextToken()
+			return p.parseUpdate(&Identifier{Name: name})
+		}
+
+		expr := p.parseExpressionStatement()
+		if index, ok := expr.(*IndexExpr); ok && isAssignOperator(p.curToken.Type) {
+			return p.parseIndexAssignment(index)
+		}
+		if isUpdateOperator(p.curToken.Type) {
+			return p.parseUpdate(expr)
+		}
+		return expr
 	case lexer.ASSIGN, lexer.PLUS_ASSIGN, lexer.MINUS_ASSIGN, lexer.MUL_ASSIGN, lexer.DIV_ASSIGN, lexer.MOD_ASSIGN:
 		// If we encounter an assignment operator directly, we need to skip it
 		// This can happen when parsing multiple assignments in sequence
 		return nil
 	case lexer.RETURN:
 		return p.parseReturnStatement()
+	case lexer.BREAK, lexer.CONTINUE:
+		return p.parseLoopControlStatement()
+	case lexer.UNDEF:
+		return p.parseUndefStatement()
 	case lexer.PRINT:
 		fmt.Printf("DEBUG: parseStatement - detected print token, calling parsePrintStatement\n")
 		return p.parsePrintStatement()
@@ -692,11 +1024,15 @@ func (p *Parser) parseStatement() Node {
 		return p.parseIfStatement()
 	case lexer.FUNCTION:
 		return p.parseFunctionDefinition()
+	case lexer.MACRO:
+		return p.parseMacroDefinition()
 	case lexer.FOR:
 		fmt.Println("DEBUG: Detected FOR token in parseStatement, calling parseForStatement")
 		return p.parseForStatement()
 	case lexer.WHILE:
 		return p.parseWhileStatement()
+	case lexer.TRY:
+		return p.parseTryStatement()
 	case lexer.REQUIRE:
 		fmt.Println("DEBUG: Detected REQUIRE token in parseStatement, calling parseRequireStatement")
 		return p.parseRequireStatement()
@@ -705,30 +1041,55 @@ func (p *Parser) parseStatement() Node {
 		return p.parseClassDefinition()
 	case lexer.SUPER:
 		return p.parseSuperCall()
-	case lexer.IN, lexer.DO, lexer.END:
+	case lexer.DO:
+		return p.parseDoWhileStatement()
+	case lexer.IN, lexer.THEN, lexer.END:
 		// These tokens are part of control structures and should be handled by their respective parsers
 		fmt.Printf("DEBUG: Skipping token %s as it should be handled by its control structure parser\n", p.curToken.Type)
 		return nil
 	case lexer.AT:
-		// Handle @ symbol (instance variables)
-		return p.parseInstanceVariable()
+		// An assignment to an instance variable, or an expression starting
+		// with one, such as @count + 1 or @items.size()
+		if p.atInstanceVariableAssignment() {
+			target := p.parseInstanceVariable()
+			return p.parseAssignmentTo(target.(*Identifier).Name)
+		}
+		expr := p.parseExpressionStatement()
+		if expr != nil && isUpdateOperator(p.curToken.Type) {
+			return p.parseUpdate(expr)
+		}
+		return expr
 	case lexer.ILLEGAL:
 		// Special handling for any illegal tokens
 		return nil
-	case lexer.INT, lexer.FLOAT, lexer.STRING, lexer.TRUE, lexer.FALSE, lexer.NIL,
-		lexer.LPAREN, lexer.LBRACKET, lexer.LBRACE, lexer.MINUS, lexer.BANG:
-		return p.parseExpressionStatement()
+	case lexer.INT, lexer.FLOAT, lexer.STRING, lexer.TRUE, lexer.FALSE, lexer.NIL, lexer.SELF,
+		lexer.LPAREN, lexer.LBRACKET, lexer.LBRACE, lexer.MINUS, lexer.PLUS, lexer.BANG:
+		expr := p.parseExpressionStatement()
+		if expr != nil && isUpdateOperator(p.curToken.Type) {
+			return p.parseUpdate(expr)
+		}
+		return expr
+	case lexer.INCREMENT, lexer.DECREMENT:
+		p.errors = append(p.errors, fmt.Sprintf("Unexpected %s, which can only be used as a statement such as x%s", p.curToken.Literal, p.curToken.Literal))
+		return nil
 	default:
 		return nil
 	}
 }
 
+// operatorMethods are the operators a class can define as methods, which
+// the operator then calls on its instances
+var operatorMethods = map[lexer.TokenType]bool{
+	lexer.SPACESHIP: true,
+}
+
 func (p *Parser) parseFunctionDefinition() Node {
 	funcDef := &FunctionDef{}
 
-	// Function name
+	// Function name, which may be an operator a class defines for its
+	// instances, as in def <=>(other): int do
 	p.nextToken()
-	if p.curToken.Type != lexer.IDENT {
+	if p.curToken.Type != lexer.IDENT && !operatorMethods[p.curToken.Type] {
 		p.errors = append(p.errors, fmt.Sprintf("Expected function name, got %s", p.curToken.Type))
 		return nil
 	}
@@ -749,14 +1110,15 @@ func (p *Parser) parseFunctionDefinition() Node {
 		// Traditional function with parameters in parentheses
 		funcDef.Parameters = p.parseFunctionParameters()
 
-		// Check for return type annotation with : syntax
+		// Check for return type annotation with : syntax. Without one the
+		// return type is left unset, and the function may return anything.
 		if p.curToken.Type == lexer.COLON {
 			p.nextToken()
 			funcDef.ReturnType = p.parseTypeAnnotation()
-		} else {
-			// Default return type is "int"
-			funcDef.ReturnType = &TypeAnnotation{TypeName: "int"}
 		}
+	} else if p.curToken.Type == lexer.DO {
+		// No parameters, no parentheses and no return type: def name do
+		funcDef.Parameters = []Parameter{}
 	} else {
 		p.errors = append(p.errors, fmt.Sprintf("Expected '(' or ':' after function name, got %s", p.curToken.Type))
 		return nil
@@ -770,21 +1132,7 @@ func (p *Parser) parseFunctionDefinition() Node {
 	}
 
 	// Parse function body
-	funcDef.Body = &BlockStmt{Statements: []Node{}}
-
-	// Parse statements until we see 'end' or EOF
-	for p.curToken.Type != lexer.END && p.curToken.Type != lexer.EOF {
-		if p.curToken.Type == lexer.SEMICOLON {
-			p.nextToken()
-			continue
-		}
-
-		stmt := p.parseStatement()
-		if stmt != nil {
-			funcDef.Body.Statements = append(funcDef.Body.Statements, stmt)
-		}
-		p.nextToken()
-	}
+	funcDef.Body = p.parseBlockUntil(lexer.END)
 
 	// Check that we found the 'end' keyword
 	if p.curToken.Type != lexer.END {
@@ -796,6 +1144,20 @@ func (p *Parser) parseFunctionDefinition() Node {
 	return funcDef
 }
 
+// parseMacroDefinition parses a macro, which shares the syntax of a function definition
+func (p *Parser) parseMacroDefinition() Node {
+	funcDef, ok := p.parseFunctionDefinition().(*FunctionDef)
+	if !ok {
+		return nil
+	}
+
+	return &MacroDef{
+		Name:       funcDef.Name,
+		Parameters: funcDef.Parameters,
+		Body:       funcDef.Body,
+	}
+}
+
 func (p *Parser) parseTypeAnnotation() *TypeAnnotation {
 	typeAnnotation := &TypeAnnotation{}
 	var typeName string
@@ -928,323 +1290,343 @@ func (p *Parser) parseIfStatement() Node {
 	p.nextToken()
 
 	// Parse condition
-	ifStmt.Condition = p.parseExpression(LOWEST)
+	ifStmt.Condition = p.parseHeaderExpression()
+	if ifStmt.Condition == nil {
+		p.errors = append(p.errors, "Invalid or missing condition in if statement")
+		return nil
+	}
 
-	// No opening brace for if statements anymore
-	// Parse the consequence block directly
-	ifStmt.Consequence = &BlockStmt{Statements: []Node{}}
+	// The 'do' keyword is optional, and may sit on the same line as the
+	// condition or on the next one. 'then' does the same, reading better
+	// before a one-line branch: if x > 0 then x else -x end
+	if p.curTokenIsAny(lexer.DO, lexer.THEN) {
+		p.nextToken()
+	}
 
 	// Parse statements until we see 'else', 'elsif', 'end', or EOF
-	for p.peekToken.Type != lexer.ELSE && p.peekToken.Type != lexer.ELSIF && p.peekToken.Type != lexer.END && p.peekToken.Type != lexer.EOF {
-		p.nextToken()
+	ifStmt.Consequence = p.parseBlockUntil(lexer.ELSE, lexer.ELSIF, lexer.END)
 
-		if p.curToken.Type == lexer.SEMICOLON {
-			continue
-		}
+	// Parse any 'elsif' branches
+	for p.curToken.Type == lexer.ELSIF {
+		// Skip 'elsif' keyword
+		p.nextToken()
 
-		stmt := p.parseStatement()
-		if stmt != nil {
-			ifStmt.Consequence.Statements = append(ifStmt.Consequence.Statements, stmt)
+		elseIfBlock := ElseIfBlock{Condition: p.parseHeaderExpression()}
+		if elseIfBlock.Condition == nil {
+			p.errors = append(p.errors, "Invalid or missing condition in elsif branch")
+			return nil
 		}
-	}
-
-	// Check for 'else' or 'elsif'
-	if p.peekToken.Type == lexer.ELSE || p.peekToken.Type == lexer.ELSIF {
-		p.nextToken() // Move to 'else' or 'elsif'
-
-		// Check if it's 'elsif' or just 'else'
-		if p.curToken.Type == lexer.ELSIF {
-			// This is an 'elsif'
-			elseIfBlock := ElseIfBlock{
-				Condition:   nil,
-				Consequence: nil,
-			}
 
-			// Parse the condition
+		if p.curTokenIsAny(lexer.DO, lexer.THEN) {
 			p.nextToken()
-			elseIfBlock.Condition = p.parseExpression(LOWEST)
+		}
 
-			// Parse the consequence statements
-			elseIfBlock.Consequence = &BlockStmt{Statements: []Node{}}
+		elseIfBlock.Consequence = p.parseBlockUntil(lexer.ELSE, lexer.ELSIF, lexer.END)
+		ifStmt.ElseIfBlocks = append(ifStmt.ElseIfBlocks, elseIfBlock)
+	}
 
-			// Parse statements until we see 'else', 'elsif', 'end', or EOF
-			for p.peekToken.Type != lexer.ELSE && p.peekToken.Type != lexer.ELSIF && p.peekToken.Type != lexer.END && p.peekToken.Type != lexer.EOF {
-				p.nextToken()
+	// Parse the 'else' branch
+	if p.curToken.Type == lexer.ELSE {
+		// Skip 'else' keyword
+		p.nextToken()
 
-				if p.curToken.Type == lexer.SEMICOLON {
-					continue
-				}
+		ifStmt.Alternative = p.parseBlockUntil(lexer.END)
+	}
 
-				stmt := p.parseStatement()
-				if stmt != nil {
-					elseIfBlock.Consequence.Statements = append(elseIfBlock.Consequence.Statements, stmt)
-				}
-			}
+	// Consume the 'end' token
+	if p.curToken.Type != lexer.END {
+		p.errors = append(p.errors, "Expected 'end' to close if statement")
+		return ifStmt
+	}
+	p.nextToken()
 
-			ifStmt.ElseIfBlocks = append(ifStmt.ElseIfBlocks, elseIfBlock)
+	return ifStmt
+}
 
-			// Recursively parse any additional 'elsif' or 'else' blocks
-			if p.peekToken.Type == lexer.ELSE || p.peekToken.Type == lexer.ELSIF {
-				// Create a temporary if statement to parse the remainder
-				tempIf, ok := p.parseIfStatement().(*IfStmt)
-				if ok {
-					// Transfer any elsif blocks
-					ifStmt.ElseIfBlocks = append(ifStmt.ElseIfBlocks, tempIf.ElseIfBlocks...)
+// parseBlockUntil parses statements until the current token is one of the
+// given terminators (or EOF), leaving the terminator as the current token
+func (p *Parser) parseBlockUntil(terminators ...lexer.TokenType) *BlockStmt {
+	block := &BlockStmt{Statements: []Node{}}
+	at(block, p.curToken)
 
-					// Transfer the else block if there is one
-					ifStmt.Alternative = tempIf.Alternative
-				}
+	for p.curToken.Type != lexer.EOF && !p.curTokenIsAny(terminators...) {
+		if p.curToken.Type == lexer.SEMICOLON {
+			p.nextToken()
+			continue
+		}
 
-				// Skip past the 'end' token since it was consumed by the recursive call
-				return ifStmt
-			}
-		} else if p.curToken.Type == lexer.ELSE {
-			// This is just an 'else'
-			// Skip 'else' keyword
+		stmt := p.parseStatement()
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		} else {
+			// Skip tokens that don't start a statement
 			p.nextToken()
+		}
+	}
 
-			// Parse the alternative block
-			ifStmt.Alternative = &BlockStmt{Statements: []Node{}}
+	return block
+}
 
-			// Parse statements until we see 'end' or EOF
-			for p.peekToken.Type != lexer.END && p.peekToken.Type != lexer.EOF {
-				p.nextToken()
+func (p *Parser) parseWhileStatement() Node {
+	fmt.Printf("DEBUG: parseWhileStatement - starting at token: %s\n", p.curToken.Type)
 
-				if p.curToken.Type == lexer.SEMICOLON {
-					continue
-				}
+	// Skip 'while' keyword
+	p.nextToken()
 
-				stmt := p.parseStatement()
-				if stmt != nil {
-					ifStmt.Alternative.Statements = append(ifStmt.Alternative.Statements, stmt)
-				}
-			}
-		}
+	// Parse the condition up to 'do', however many lines it spans
+	condition := p.parseHeaderExpression()
+	if condition == nil {
+		p.errors = append(p.errors, "Invalid or missing condition in while statement")
+		condition = &BooleanLiteral{Value: false} // Default to false to avoid nil pointer
 	}
 
-	// Consume the 'end' token
-	if p.peekToken.Type == lexer.END {
-		p.nextToken() // Move to 'end'
-		p.nextToken() // Skip 'end'
+	// Check for 'do' keyword
+	if p.curToken.Type != lexer.DO {
+		p.errors = append(p.errors, fmt.Sprintf("Expected 'do' after while condition, got %s", p.curToken.Type))
 	} else {
-		p.errors = append(p.errors, "Expected 'end' to close if statement")
+		p.nextToken() // Skip 'do'
 	}
 
-	return ifStmt
+	// Parse statements until we see 'end' or EOF
+	body := p.parseBlockUntil(lexer.END)
+
+	// Skip the 'end' token if present
+	if p.curToken.Type == lexer.END {
+		p.nextToken()
+	} else {
+		p.errors = append(p.errors, "Expected 'end' to close while loop")
+	}
+
+	return &WhileStmt{
+		Condition: condition,
+		Body:      body,
+	}
 }
 
-func (p *Parser) parseWhileStatement() Node {
-	fmt.Printf("DEBUG: parseWhileStatement - starting at token: %s\n", p.curToken.Type)
+// parseDoWhileStatement parses a loop that checks its condition after each
+// run of the body:
+//
+//	do
+//	  ...
+//	end while condition
+//
+// The while must sit on the same line as the end.
+func (p *Parser) parseDoWhileStatement() Node {
+	stmt := &DoWhileStmt{}
 
-	// Skip 'while' keyword
+	// A loop can't start inside brackets, so a do met there is what's left
+	// of an argument list or literal that already failed to parse, like the
+	// block of map(xs, def(x) do ... end). Its body is skipped like a loop's,
+	// but the error reported for the brackets is the one that says what's
+	// wrong.
+	leftover := p.brackets > 0
+
+	// Skip 'do'
 	p.nextToken()
 
-	fmt.Printf("DEBUG: parseWhileStatement - after skipping 'while', at token: %s, peek: %s\n",
-		p.curToken.Type, p.peekToken.Type)
+	stmt.Body = p.parseBlockUntil(lexer.END)
+	if p.curToken.Type != lexer.END {
+		p.errors = append(p.errors, "Expected 'end' to close do block")
+		return nil
+	}
+	end := p.curToken
+	p.nextToken()
 
-	// If we have an identifier followed by a comparison operator, handle it specially
-	if p.curToken.Type == lexer.IDENT &&
-		(p.peekToken.Type == lexer.LT || p.peekToken.Type == lexer.GT ||
-		 p.peekToken.Type == lexer.LT_EQ || p.peekToken.Type == lexer.GT_EQ ||
-		 p.peekToken.Type == lexer.EQ || p.peekToken.Type == lexer.NOT_EQ) {
+	if p.curToken.Type != lexer.WHILE || p.curToken.Line != end.Line {
+		if !leftover {
+			p.errors = append(p.errors, fmt.Sprintf("Expected 'while' after the 'end' of a do block, got %s", p.curToken.Type))
+		}
+		return nil
+	}
+	p.nextToken()
 
-		fmt.Printf("DEBUG: parseWhileStatement - detected comparison expression\n")
+	stmt.Condition = p.parseHeaderExpression()
+	if stmt.Condition == nil {
+		p.errors = append(p.errors, "Invalid or missing condition in do-while loop")
+		return nil
+	}
 
-		// Create the left side of the comparison
-		left := &Identifier{Name: p.curToken.Literal}
+	return stmt
+}
 
-		// Move to the comparison operator
+// parseTryStatement parses a try block followed by its rescue clauses:
+//
+//	try do
+//	  ...
+//	rescue TypeError as e do
+//	  ...
+//	rescue
+//	  ...
+//	end
+//
+// The kind and the 'as' binding must sit on the rescue line, so a handler
+// whose body starts with an identifier isn't read as a kind.
+func (p *Parser) parseTryStatement() Node {
+	tryStmt := &TryStmt{}
+
+	// Skip 'try' and the optional 'do'
+	p.nextToken()
+	if p.curToken.Type == lexer.DO {
 		p.nextToken()
-		operator := p.curToken.Literal
+	}
 
-		// Move to the right side
+	tryStmt.Body = p.parseBlockUntil(lexer.RESCUE, lexer.END)
+
+	for p.curToken.Type == lexer.RESCUE {
+		keyword := p.curToken
 		p.nextToken()
 
-		// Parse the right side
-		var right Node
-		switch p.curToken.Type {
-		case lexer.INT:
-			value, _ := strconv.ParseFloat(p.curToken.Literal, 64)
-			right = &NumberLiteral{Value: value, IsInt: true}
-		case lexer.FLOAT:
-			value, _ := strconv.ParseFloat(p.curToken.Literal, 64)
-			right = &NumberLiteral{Value: value, IsInt: false}
-		case lexer.IDENT:
-			right = &Identifier{Name: p.curToken.Literal}
-		default:
-			p.errors = append(p.errors, fmt.Sprintf("Expected number or identifier after comparison operator, got %s", p.curToken.Type))
-			right = &NumberLiteral{Value: 0, IsInt: true} // Default to avoid nil
+		clause := RescueClause{}
+		onRescueLine := func(tokenType lexer.TokenType) bool {
+			return p.curToken.Type == tokenType && p.curToken.Line == keyword.Line
 		}
-
-		// Create the condition as a binary expression
-		condition := &BinaryExpr{
-			Left:     left,
-			Operator: operator,
-			Right:    right,
+		if onRescueLine(lexer.IDENT) {
+			clause.Kind = p.curToken.Literal
+			p.nextToken()
 		}
-
-		fmt.Printf("DEBUG: parseWhileStatement - created condition: %s\n", condition.String())
-
-		// Move to the next token (should be 'do')
-		p.nextToken()
-
-		// Check for 'do' keyword
-		if p.curToken.Type != lexer.DO {
-			p.errors = append(p.errors, fmt.Sprintf("Expected 'do' after while condition, got %s", p.curToken.Type))
-			// Try to find it in the next token
-			if p.peekToken.Type == lexer.DO {
-				p.nextToken() // Move to 'do'
+		if onRescueLine(lexer.AS) {
+			p.nextToken()
+			if p.curToken.Type != lexer.IDENT {
+				p.errors = append(p.errors, fmt.Sprintf("Expected a name after 'as' in rescue clause, got %s", p.curToken.Type))
+				return nil
 			}
+			clause.Variable = p.curToken.Literal
+			p.nextToken()
 		}
 
-		// Skip 'do' if we're on it
 		if p.curToken.Type == lexer.DO {
 			p.nextToken()
 		}
 
-		// Parse while loop body directly
-		body := &BlockStmt{Statements: []Node{}}
+		clause.Body = p.parseBlockUntil(lexer.RESCUE, lexer.END)
+		tryStmt.Rescues = append(tryStmt.Rescues, clause)
+	}
 
-		// Parse statements until we see 'end' or EOF
-		for p.curToken.Type != lexer.END && p.curToken.Type != lexer.EOF {
-			fmt.Printf("DEBUG: parseWhileStatement - parsing statement in body, token: %s\n", p.curToken.Type)
+	if len(tryStmt.Rescues) == 0 {
+		p.errors = append(p.errors, "Expected at least one rescue clause in try statement")
+	}
 
-			var stmt Node
+	// Consume the 'end' token
+	if p.curToken.Type != lexer.END {
+		p.errors = append(p.errors, "Expected 'end' to close try statement")
+		return tryStmt
+	}
+	p.nextToken()
 
-			// Handle print statements
-			if p.curToken.Type == lexer.PRINT {
-				fmt.Printf("DEBUG: parseWhileStatement - detected print statement\n")
-				// Skip 'print' or 'puts' keyword
-				p.nextToken()
+	return tryStmt
+}
 
-				// Parse the expression to print
-				expr := p.parseExpression(LOWEST)
-
-				// Create a print statement
-				stmt = &PrintStmt{Value: expr}
-				fmt.Printf("DEBUG: parseWhileStatement - created print statement: %s\n", stmt.String())
-			} else if p.curToken.Type == lexer.IDENT &&
-				(p.peekToken.Type == lexer.ASSIGN || p.peekToken.Type == lexer.PLUS_ASSIGN ||
-				 p.peekToken.Type == lexer.MINUS_ASSIGN || p.peekToken.Type == lexer.MUL_ASSIGN ||
-				 p.peekToken.Type == lexer.DIV_ASSIGN || p.peekToken.Type == lexer.MOD_ASSIGN) {
-				// Handle assignments
-				stmt = p.parseCompoundAssignment()
-			} else {
-				// Handle other statements
-				stmt = p.parseStatement()
-			}
+// parseLoopControlStatement parses break or continue with an optional label.
+// The label must sit on the same line so a bare break is not joined with
+// an identifier that starts the next statement.
+func (p *Parser) parseLoopControlStatement() Node {
+	keyword := p.curToken
+	p.nextToken()
 
-			if stmt != nil {
-				fmt.Printf("DEBUG: parseWhileStatement - added statement to body: %T\n", stmt)
-				body.Statements = append(body.Statements, stmt)
-			} else {
-				fmt.Printf("DEBUG: parseWhileStatement - statement was nil, skipping\n")
-			}
+	label := ""
+	if p.curToken.Type == lexer.IDENT && p.curToken.Line == keyword.Line {
+		label = p.curToken.Literal
+		p.nextToken()
+	}
 
-			// Move to the next token
-			if p.curToken.Type != lexer.END && p.curToken.Type != lexer.EOF {
-				p.nextToken()
-			}
-		}
+	if keyword.Type == lexer.BREAK {
+		return &BreakStmt{Label: label}
+	}
+	return &ContinueStmt{Label: label}
+}
 
-		// Skip the 'end' token if present
-		if p.curToken.Type == lexer.END {
-			p.nextToken()
-		} else {
-			p.errors = append(p.errors, "Expected 'end' to close while loop")
-		}
+// parseUndefStatement parses undef followed by the name to remove
+func (p *Parser) parseUndefStatement() Node {
+	p.nextToken() // Skip 'undef'
 
-		return &WhileStmt{
-			Condition: condition,
-			Body:      body,
-		}
-	} else {
-		// Fall back to the regular expression parsing for other cases
-		condition := p.parseExpression(LOWEST)
-		if condition == nil {
-			p.errors = append(p.errors, "Invalid or missing condition in while statement")
-			condition = &BooleanLiteral{Value: false} // Default to false to avoid nil pointer
-		}
-
-		// Check for 'do' keyword
-		if p.curToken.Type != lexer.DO {
-			p.errors = append(p.errors, fmt.Sprintf("Expected 'do' after while condition, got %s", p.curToken.Type))
-			// Try to find it in the next token
-			if p.peekToken.Type == lexer.DO {
-				p.nextToken() // Move to 'do'
-			}
-		}
+	if p.curToken.Type != lexer.IDENT {
+		p.errors = append(p.errors, fmt.Sprintf("Expected a variable name after 'undef', got %s", p.curToken.Type))
+		return nil
+	}
 
-		// Skip 'do' if we're on it
-		if p.curToken.Type == lexer.DO {
-			p.nextToken()
-		}
+	stmt := &UndefStmt{Name: p.curToken.Literal}
+	p.nextToken()
+	return stmt
+}
 
-		// Parse while loop body directly
-		body := &BlockStmt{Statements: []Node{}}
+// atLoopLabel reports whether the current tokens start a labeled loop (outer: for ...)
+func (p *Parser) atLoopLabel() bool {
+	if p.curToken.Type != lexer.IDENT || p.peekToken.Type != lexer.COLON {
+		return false
+	}
 
-		// Parse statements until we see 'end' or EOF
-		for p.curToken.Type != lexer.END && p.curToken.Type != lexer.EOF {
-			fmt.Printf("DEBUG: parseWhileStatement - parsing statement in body, token: %s\n", p.curToken.Type)
+	// Look one token past the colon without consuming anything
+	saved := *p.l
+	next, _ := p.lexToken()
+	*p.l = saved
 
-			var stmt Node
+	return next.Type == lexer.FOR || next.Type == lexer.WHILE
+}
 
-			// Handle print statements
-			if p.curToken.Type == lexer.PRINT {
-				fmt.Printf("DEBUG: parseWhileStatement - detected print statement\n")
-				// Skip 'print' or 'puts' keyword
-				p.nextToken()
+// atInstanceVariableAssignment reports whether the @ at the current token
+// starts an assignment such as @x = 1 or @x += 1
+func (p *Parser) atInstanceVariableAssignment() bool {
+	if p.peekToken.Type != lexer.IDENT {
+		return false
+	}
 
-				// Parse the expression to print
-				expr := p.parseExpression(LOWEST)
-
-				// Create a print statement
-				stmt = &PrintStmt{Value: expr}
-				fmt.Printf("DEBUG: parseWhileStatement - created print statement: %s\n", stmt.String())
-			} else if p.curToken.Type == lexer.IDENT &&
-				(p.peekToken.Type == lexer.ASSIGN || p.peekToken.Type == lexer.PLUS_ASSIGN ||
-				 p.peekToken.Type == lexer.MINUS_ASSIGN || p.peekToken.Type == lexer.MUL_ASSIGN ||
-				 p.peekToken.Type == lexer.DIV_ASSIGN || p.peekToken.Type == lexer.MOD_ASSIGN) {
-				// Handle assignments
-				stmt = p.parseCompoundAssignment()
-			} else {
-				// Handle other statements
-				stmt = p.parseStatement()
-			}
+	// Look past the name without consuming anything
+	saved := *p.l
+	next, newline := p.lexToken()
+	*p.l = saved
 
-			if stmt != nil {
-				fmt.Printf("DEBUG: parseWhileStatement - added statement to body: %T\n", stmt)
-				body.Statements = append(body.Statements, stmt)
-			} else {
-				fmt.Printf("DEBUG: parseWhileStatement - statement was nil, skipping\n")
-			}
+	return !newline && isAssignOperator(next.Type)
+}
 
-			// Move to the next token
-			if p.curToken.Type != lexer.END && p.curToken.Type != lexer.EOF {
-				p.nextToken()
-			}
-		}
+// atClassWithDo reports whether the class keyword at the current token
+// starts class Name [inherits Parent] do
+func (p *Parser) atClassWithDo() bool {
+	if p.peekToken.Type != lexer.IDENT {
+		return false
+	}
 
-		// Skip the 'end' token if present
-		if p.curToken.Type == lexer.END {
-			p.nextToken()
-		} else {
-			p.errors = append(p.errors, "Expected 'end' to close while loop")
-		}
+	// Look past the name without consuming anything
+	saved := *p.l
+	next, _ := p.lexToken()
+	if next.Type == lexer.INHERITS {
+		p.lexToken()
+		next, _ = p.lexToken()
+	}
+	*p.l = saved
+
+	return next.Type == lexer.DO
+}
+
+// parseLabeledLoop parses a for or while loop preceded by a label
+func (p *Parser) parseLabeledLoop() Node {
+	label := p.curToken.Literal
+	p.nextToken() // Skip the label
+	p.nextToken() // Skip ':'
 
-		return &WhileStmt{
-			Condition: condition,
-			Body:      body,
+	if p.curToken.Type == lexer.FOR {
+		loop := p.parseForStatement()
+		if forStmt, ok := loop.(*ForStmt); ok {
+			forStmt.Label = label
 		}
+		return loop
 	}
+
+	loop := p.parseWhileStatement()
+	if whileStmt, ok := loop.(*WhileStmt); ok {
+		whileStmt.Label = label
+	}
+	return loop
 }
 
 func (p *Parser) parseReturnStatement() Node {
 	// Skip 'return' keyword
+	keyword := p.curToken
 	p.nextToken()
 
-	// Check if return has no value
-	if p.curToken.Type == lexer.SEMICOLON || p.curToken.Type == lexer.EOF {
+	// A bare return has no value. Its value must start on the same line, so
+	// the statement after a bare return isn't taken as what it returns.
+	if p.curToken.Line != keyword.Line || p.curTokenIsAny(lexer.SEMICOLON, lexer.EOF,
+		lexer.END, lexer.ELSE, lexer.ELSIF, lexer.RESCUE) {
 		return &ReturnStmt{Value: nil}
 	}
 
@@ -1296,6 +1678,41 @@ func (p *Parser) parsePrintStatement() Node {
 	return stmt
 }
 
+// parseTypedDeclaration parses a top-level variable declared with a type,
+// such as a: string = "hello", starting at the variable name. The value is
+// optional.
+func (p *Parser) parseTypedDeclaration() Node {
+	start := p.curToken
+	varDecl := &VariableDecl{Name: p.curToken.Literal}
+	p.nextToken() // Move to COLON token
+	p.nextToken() // Move past COLON to the type
+
+	varDecl.TypeAnnotation = p.parseTypeAnnotation()
+
+	// If the next token is '=', we also have a value
+	if p.curToken.Type == lexer.ASSIGN {
+		p.nextToken() // Move past ASSIGN to the expression
+		varDecl.Value = p.parseAssignedValue()
+		if varDecl.Value == nil {
+			p.errors = append(p.errors, fmt.Sprintf("Expected a value to assign to %s", varDecl.Name))
+			return nil
+		}
+	}
+
+	return at(varDecl, start)
+}
+
+// parseAssignedValue parses the right-hand side of an assignment. Besides
+// expressions, an if, while, do-while, for or try statement can be assigned,
+// giving the value it ends with.
+func (p *Parser) parseAssignedValue() Node {
+	switch p.curToken.Type {
+	case lexer.IF, lexer.WHILE, lexer.DO, lexer.FOR, lexer.TRY:
+		return p.parseStatement()
+	}
+	return p.parseExpression(LOWEST)
+}
+
 func (p *Parser) parseCompoundAssignment() Node {
 	debugf("parseCompoundAssignment - at token: %s", p.curToken.Type)
 
@@ -1305,6 +1722,12 @@ func (p *Parser) parseCompoundAssignment() Node {
 	// Skip to the assignment operator
 	p.nextToken()
 
+	return p.parseAssignmentTo(name)
+}
+
+// parseAssignmentTo parses the rest of an assignment to the named variable
+// once the name has been read; the current token is the assignment operator
+func (p *Parser) parseAssignmentTo(name string) Node {
 	// Remember the assignment operator
 	operator := p.curToken.Type
 
@@ -1319,24 +1742,13 @@ func (p *Parser) parseCompoundAssignment() Node {
 		left := &Identifier{Name: name}
 
 		// Determine the binary operator based on the compound assignment
-		var binOp string
-		switch operator {
-		case lexer.PLUS_ASSIGN:
-			binOp = "+"
-		case lexer.MINUS_ASSIGN:
-			binOp = "-"
-		case lexer.MUL_ASSIGN:
-			binOp = "*"
-		case lexer.DIV_ASSIGN:
-			binOp = "/"
-		case lexer.MOD_ASSIGN:
-			binOp = "%"
-		}
+		binOp := compoundOperators[operator]
 
 		// Parse the right-hand expression
-		right := p.parseExpression(LOWEST)
+		right := p.parseAssignedValue()
 		if right == nil {
 			fmt.Println("DEBUG: parseCompoundAssignment - Failed to parse right side of assignment")
+			p.errors = append(p.errors, fmt.Sprintf("Expected a value to assign to %s", name))
 			return nil
 		}
 
@@ -1348,9 +1760,10 @@ func (p *Parser) parseCompoundAssignment() Node {
 		}
 	} else {
 		// For regular assignment, just parse the expression
-		value = p.parseExpression(LOWEST)
+		value = p.parseAssignedValue()
 		if value == nil {
 			fmt.Println("DEBUG: parseCompoundAssignment - Failed to parse right side of assignment")
+			p.errors = append(p.errors, fmt.Sprintf("Expected a value to assign to %s", name))
 			return nil
 		}
 	}
@@ -1365,31 +1778,97 @@ func (p *Parser) parseCompoundAssignment() Node {
 	return assignment
 }
 
-func (p *Parser) parseExpressionStatement() Node {
-	return p.parseExpression(0)
+// compoundOperators maps each compound assignment to the operator it applies
+var compoundOperators = map[lexer.TokenType]string{
+	lexer.PLUS_ASSIGN:  "+",
+	lexer.MINUS_ASSIGN: "-",
+	lexer.MUL_ASSIGN:   "*",
+	lexer.DIV_ASSIGN:   "/",
+	lexer.MOD_ASSIGN:   "%",
 }
 
-func (p *Parser) parseExpression(precedence int) Node {
-	fmt.Printf("DEBUG: parseExpression - at token: %s, literal: %s\n", p.curToken.Type, p.curToken.Literal)
-	fmt.Printf("DEBUG: parseExpression - precedence: %d, peek token: %s\n", precedence, p.peekToken.Type)
+func isAssignOperator(tokenType lexer.TokenType) bool {
+	_, compound := compoundOperators[tokenType]
+	return tokenType == lexer.ASSIGN || compound
+}
 
-	// Check for instance variables (@name)
-	if p.curToken.Type == lexer.AT {
-		return p.parseInstanceVariable()
+func isUpdateOperator(tokenType lexer.TokenType) bool {
+	return tokenType == lexer.INCREMENT || tokenType == lexer.DECREMENT
+}
+
+// parseUpdate parses x++ or x-- once its target has been parsed; the current
+// token is the operator. It becomes x = x + 1 or x = x - 1, so only
+// variables, instance variables and elements can be updated.
+func (p *Parser) parseUpdate(target Node) Node {
+	literal := p.curToken.Literal
+	operator := "+"
+	if p.curToken.Type == lexer.DECREMENT {
+		operator = "-"
+	}
+	p.nextToken()
+
+	// The update is a whole statement, so x++ + 1 is an error rather than
+	// x++ followed by a separate +1
+	if !p.curAfterNewline && !p.curTokenIsAny(lexer.SEMICOLON, lexer.EOF,
+		lexer.END, lexer.ELSE, lexer.ELSIF, lexer.RESCUE) {
+		p.errors = append(p.errors, fmt.Sprintf("Unexpected %s after %s, which must end the statement", p.curToken.Literal, literal))
+		return nil
+	}
+
+	value := &BinaryExpr{Left: target, Operator: operator, Right: &NumberLiteral{Value: 1, IsInt: true, Int: 1}}
+	switch target := target.(type) {
+	case *Identifier:
+		return &Assignment{Name: target.Name, Value: value}
+	case *IndexExpr:
+		return &IndexAssignment{Target: target, Value: value}
+	}
+
+	p.errors = append(p.errors, fmt.Sprintf("Cannot apply %s to %s, only to a variable or element", literal, target.String()))
+	return nil
+}
+
+// parseIndexAssignment parses the rest of an assignment to an element once
+// its target has been parsed; the current token is the assignment operator.
+// A compound assignment such as a[0] += 1 becomes a[0] = a[0] + 1.
+func (p *Parser) parseIndexAssignment(target *IndexExpr) Node {
+	operator := p.curToken.Type
+	p.nextToken()
+
+	value := p.parseAssignedValue()
+	if value == nil {
+		p.errors = append(p.errors, fmt.Sprintf("Expected a value to assign to %s", target.String()))
+		return nil
 	}
 
-	// Check for self keyword
-	if p.curToken.Type == lexer.SELF {
-		return p.parseSelfExpr()
+	if operator != lexer.ASSIGN {
+		value = &BinaryExpr{Left: target, Operator: compoundOperators[operator], Right: value}
 	}
+	return &IndexAssignment{Target: target, Value: value}
+}
+
+// parseHeaderExpression parses the condition or iterable of an if/while/for,
+// where a following 'do' opens the statement body instead of a call block
+func (p *Parser) parseHeaderExpression() Node {
+	noBlock := p.noBlock
+	p.noBlock = true
+	defer func() { p.noBlock = noBlock }()
+
+	return p.parseExpression(LOWEST)
+}
+
+func (p *Parser) parseExpressionStatement() Node {
+	return p.parseExpression(0)
+}
 
-	// Check for super call
-	if p.curToken.Type == lexer.SUPER {
-		return p.parseSuperCall()
-	}
+func (p *Parser) parseExpression(precedence int) Node {
+	fmt.Printf("DEBUG: parseExpression - at token: %s, literal: %s\n", p.curToken.Type, p.curToken.Literal)
+	fmt.Printf("DEBUG: parseExpression - precedence: %d, peek token: %s\n", precedence, p.peekToken.Type)
 
-	// Continue with the existing prefix/infix expression parsing
 	var leftExp Node
+	start := p.curToken
+
+	// Set when the prefix parser has already moved past its expression
+	consumed := false
 
 	// Prefix expressions
 	switch p.curToken.Type {
@@ -1435,10 +1914,12 @@ func (p *Parser) parseExpression(precedence int) Node {
 		// Only do this if we're not in a context where the identifier might be used for something else
 		// like an assignment target, a property name, etc.
 		// We can infer this is a function call if we're at the end of an expression
-		if !isInfixOperator(p.peekToken.Type) &&
+		if startsLine(p.peekToken.Type, p.peekAfterNewline) ||
+		   !isInfixOperator(p.peekToken.Type) &&
 		   p.peekToken.Type != lexer.LPAREN &&
 		   p.peekToken.Type != lexer.LBRACKET &&
 		   p.peekToken.Type != lexer.DOT &&
+		   p.peekToken.Type != lexer.SAFE_DOT &&
 		   p.peekToken.Type != lexer.ASSIGN &&
 		   p.peekToken.Type != lexer.PLUS_ASSIGN &&
 		   p.peekToken.Type != lexer.MINUS_ASSIGN &&
@@ -1449,16 +1930,37 @@ func (p *Parser) parseExpression(precedence int) Node {
 			leftExp = &CallExpr{
 				Function: leftExp,
 				Args:     []Node{},
+				Bare:     true,
 			}
 		}
 
+	case lexer.AT:
+		// Instance variables (@name), which can be operands like any variable
+		if leftExp = p.parseInstanceVariable(); leftExp == nil {
+			return nil
+		}
+		consumed = true
+	case lexer.IF:
+		// An if is an expression too, giving the branch that ran, so it can
+		// be returned, passed or used as an operand: if x then 1 else 2 end
+		if leftExp = p.parseIfStatement(); leftExp == nil {
+			return nil
+		}
+		consumed = true
+	case lexer.SELF:
+		leftExp = p.parseSelfExpr()
+	case lexer.SUPER:
+		if leftExp = p.parseSuperCall(); leftExp == nil {
+			return nil
+		}
+		consumed = true
 	case lexer.INT:
-		value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+		value, err := strconv.ParseInt(p.curToken.Literal, 10, 64)
 		if err != nil {
 			p.errors = append(p.errors, fmt.Sprintf("Could not parse %q as integer", p.curToken.Literal))
 			return nil
 		}
-		leftExp = &NumberLiteral{Value: value, IsInt: true}
+		leftExp = &NumberLiteral{Value: float64(value), IsInt: true, Int: value}
 	case lexer.FLOAT:
 		value, err := strconv.ParseFloat(p.curToken.Literal, 64)
 		if err != nil {
@@ -1478,40 +1980,50 @@ func (p *Parser) parseExpression(precedence int) Node {
 		p.nextToken() // Consume '('
 		leftExp = p.parseExpression(LOWEST)
 
-		if p.peekToken.Type != lexer.RPAREN {
-			p.errors = append(p.errors, fmt.Sprintf("Expected ')', got %s", p.peekToken.Type))
+		// parseExpression stops on the token after the inner expression,
+		// which has to be the ')'. It's skipped below like any prefix.
+		if p.curToken.Type != lexer.RPAREN {
+			p.errors = append(p.errors, fmt.Sprintf("Expected ')', got %s", p.curToken.Type))
 			return nil
 		}
-		p.nextToken() // Consume ')'
 	case lexer.LBRACKET:
 		leftExp = p.parseArrayLiteral()
-	case lexer.MINUS, lexer.BANG:
+	case lexer.LBRACE:
+		leftExp = p.parseMapLiteral()
+	case lexer.MINUS, lexer.PLUS, lexer.BANG:
 		operator := p.curToken.Literal
 		p.nextToken() // Consume the operator
 		operand := p.parseExpression(PREFIX)
 		leftExp = &UnaryExpr{Operator: operator, Right: operand}
+
+		// A minus directly in front of a number is a negative literal, and
+		// a plus is just the number
+		if number, ok := operand.(*NumberLiteral); ok && operator == "-" {
+			leftExp = &NumberLiteral{Value: -number.Value, IsInt: number.IsInt, Int: -number.Int}
+		} else if ok && operator == "+" {
+			leftExp = &NumberLiteral{Value: number.Value, IsInt: number.IsInt, Int: number.Int}
+		}
+		consumed = true
 	default:
 		return nil
 	}
 
-	// Skip to the next token, but only if not DO, as we need to preserve this for statements
-	if p.peekToken.Type != lexer.DO {
+	at(leftExp, start)
+
+	// Move past the prefix expression. A following 'do' becomes the current
+	// token, so statements can check for it the same way on every path
+	if !consumed {
 		p.nextToken()
 	}
 
 	// Now parse any infix expressions
-	for precedence < p.curPrecedence() && p.curToken.Type != lexer.EOF {
-		// Don't proceed with infix parsing if the next token is DO
-		if p.peekToken.Type == lexer.DO {
-			break
-		}
-
+	for precedence < p.curPrecedence() && p.curToken.Type != lexer.EOF && !startsLine(p.curToken.Type, p.curAfterNewline) {
 		fmt.Printf("DEBUG: parseExpression - infix - current token: %s, precedence: %d, curPrecedence: %d\n",
 			p.curToken.Type, precedence, p.curPrecedence())
 
 		switch p.curToken.Type {
-		case lexer.PLUS, lexer.MINUS, lexer.ASTERISK, lexer.SLASH, lexer.MODULO,
-			lexer.EQ, lexer.NOT_EQ, lexer.LT, lexer.GT, lexer.LT_EQ, lexer.GT_EQ,
+		case lexer.PLUS, lexer.MINUS, lexer.ASTERISK, lexer.SLASH, lexer.MODULO, lexer.POWER,
+			lexer.EQ, lexer.NOT_EQ, lexer.LT, lexer.GT, lexer.LT_EQ, lexer.GT_EQ, lexer.SPACESHIP,
 			lexer.AND, lexer.OR:
 			fmt.Printf("DEBUG: parseExpression - calling parseBinaryExpression with operator: %s\n", p.curToken.Literal)
 			leftExp = p.parseBinaryExpression(leftExp)
@@ -1519,11 +2031,18 @@ func (p *Parser) parseExpression(precedence int) Node {
 			leftExp = p.parseCallExpression(leftExp)
 		case lexer.LBRACKET:
 			leftExp = p.parseIndexExpression(leftExp)
-		case lexer.DOT:
+		case lexer.DOT, lexer.SAFE_DOT:
 			leftExp = p.parseDotExpression(leftExp)
+		case lexer.AS:
+			leftExp = p.parseCastExpression(leftExp)
+		case lexer.IN:
+			leftExp = p.parseBinaryExpression(leftExp)
 		default:
 			return leftExp
 		}
+
+		// Compound expressions start where their leftmost operand does
+		at(leftExp, start)
 	}
 
 	return leftExp
@@ -1532,9 +2051,9 @@ func (p *Parser) parseExpression(precedence int) Node {
 // Helper function to check if a token type is an infix operator
 func isInfixOperator(tokenType lexer.TokenType) bool {
 	switch tokenType {
-	case lexer.PLUS, lexer.MINUS, lexer.ASTERISK, lexer.SLASH, lexer.MODULO,
-			lexer.EQ, lexer.NOT_EQ, lexer.LT, lexer.GT, lexer.LT_EQ, lexer.GT_EQ,
-			lexer.AND, lexer.OR:
+	case lexer.PLUS, lexer.MINUS, lexer.ASTERISK, lexer.SLASH, lexer.MODULO, lexer.POWER,
+			lexer.EQ, lexer.NOT_EQ, lexer.LT, lexer.GT, lexer.LT_EQ, lexer.GT_EQ, lexer.SPACESHIP,
+			lexer.AND, lexer.OR, lexer.IN:
 		return true
 	default:
 		return false
@@ -1544,19 +2063,27 @@ func isInfixOperator(tokenType lexer.TokenType) bool {
 // Get precedence for operators
 func (p *Parser) peekPrecedence() int {
 	switch p.peekToken.Type {
+	case lexer.OR:
+		return LOGICAL_OR
+	case lexer.AND:
+		return LOGICAL_AND
 	case lexer.EQ, lexer.NOT_EQ:
 		return EQUALS
-	case lexer.LT, lexer.GT, lexer.LT_EQ, lexer.GT_EQ:
+	case lexer.LT, lexer.GT, lexer.LT_EQ, lexer.GT_EQ, lexer.SPACESHIP, lexer.IN:
 		return LESSGREATER
 	case lexer.PLUS, lexer.MINUS:
 		return SUM
 	case lexer.ASTERISK, lexer.SLASH, lexer.MODULO:
 		return PRODUCT
+	case lexer.AS:
+		return CAST
+	case lexer.POWER:
+		return POWER
 	case lexer.LPAREN:
 		return CALL
 	case lexer.LBRACKET:
 		return INDEX
-	case lexer.DOT:
+	case lexer.DOT, lexer.SAFE_DOT:
 		return DOT
 	default:
 		return LOWEST
@@ -1565,19 +2092,27 @@ func (p *Parser) peekPrecedence() int {
 
 func (p *Parser) curPrecedence() int {
 	switch p.curToken.Type {
+	case lexer.OR:
+		return LOGICAL_OR
+	case lexer.AND:
+		return LOGICAL_AND
 	case lexer.EQ, lexer.NOT_EQ:
 		return EQUALS
-	case lexer.LT, lexer.GT, lexer.LT_EQ, lexer.GT_EQ:
+	case lexer.LT, lexer.GT, lexer.LT_EQ, lexer.GT_EQ, lexer.SPACESHIP, lexer.IN:
 		return LESSGREATER
 	case lexer.PLUS, lexer.MINUS:
 		return SUM
 	case lexer.ASTERISK, lexer.SLASH, lexer.MODULO:
 		return PRODUCT
+	case lexer.AS:
+		return CAST
+	case lexer.POWER:
+		return POWER
 	case lexer.LPAREN:
 		return CALL
 	case lexer.LBRACKET:
 		return INDEX
-	case lexer.DOT:
+	case lexer.DOT, lexer.SAFE_DOT:
 		return DOT
 	default:
 		return LOWEST
@@ -1668,6 +2203,11 @@ func (p *Parser) parseFunctionParameters() []Parameter {
 	for p.curToken.Type == lexer.COMMA {
 		p.nextToken() // Skip ','
 
+		// Handle trailing comma
+		if p.curToken.Type == lexer.RPAREN {
+			break
+		}
+
 		// Parse parameter name
 		if p.curToken.Type != lexer.IDENT {
 			p.errors = append(p.errors, fmt.Sprintf("Expected parameter name after comma, got %s", p.curToken.Type))
@@ -1731,10 +2271,7 @@ func (p *Parser) parseArrayLiteral() Node {
 
 	// Empty array case
 	if p.curToken.Type == lexer.RBRACKET {
-		// Skip ']'
-		p.nextToken()
-		fmt.Printf("DEBUG: parseArrayLiteral - empty array, current token after ]: %s, peek: %s\n",
-			p.curToken.Type, p.peekToken.Type)
+		fmt.Printf("DEBUG: parseArrayLiteral - empty array, peek after ]: %s\n", p.peekToken.Type)
 		return arrayLit
 	}
 
@@ -1765,18 +2302,9 @@ func (p *Parser) parseArrayLiteral() Node {
 		return nil
 	}
 
-	// Important: We need to check if the next token is DO before consuming it
-	if p.peekToken.Type == lexer.DO {
-		fmt.Printf("DEBUG: parseArrayLiteral - detected DO after array, preserving it\n")
-		// We want to move past the ']' but not consume any token after that
-		p.nextToken() // Moves to the DO token
-		return arrayLit
-	}
-
-	// Skip the closing bracket
-	p.nextToken()
-	fmt.Printf("DEBUG: parseArrayLiteral - array with %d elements, current token after ]: %s, peek: %s\n",
-		len(arrayLit.Elements), p.curToken.Type, p.peekToken.Type)
+	// Leave the closing bracket as the current token, like the other prefix expressions
+	fmt.Printf("DEBUG: parseArrayLiteral - array with %d elements, peek after ]: %s\n",
+		len(arrayLit.Elements), p.peekToken.Type)
 
 	return arrayLit
 }
@@ -1787,37 +2315,162 @@ func (p *Parser) parseCallExpression(function Node) Node {
 
 	var args []Node
 
-	// Handle empty argument list
-	if p.curToken.Type == lexer.RPAREN {
-		p.nextToken() // Skip ')'
-		return &CallExpr{Function: function, Args: args}
-	}
+	// An empty argument list goes straight to the closing paren
+	if p.curToken.Type != lexer.RPAREN {
+		// Parse first argument
+		arg := p.parseExpression(LOWEST)
+		args = append(args, arg)
 
-	// Parse first argument
-	arg := p.parseExpression(LOWEST)
-	args = append(args, arg)
+		// Parse remaining arguments
+		for p.curToken.Type == lexer.COMMA {
+			p.nextToken() // Skip ','
 
-	// Parse remaining arguments
-	for p.curToken.Type == lexer.COMMA {
-		p.nextToken() // Skip ','
-		arg = p.parseExpression(LOWEST)
-		args = append(args, arg)
+			// Handle trailing comma
+			if p.curToken.Type == lexer.RPAREN {
+				break
+			}
+
+			arg = p.parseExpression(LOWEST)
+			args = append(args, arg)
+		}
 	}
 
+	if p.curToken.Type == lexer.DO {
+		p.errors = append(p.errors, "Expected ')' before do: a block goes after the arguments, as in each(xs) do |x| ... end")
+		return nil
+	}
 	if p.curToken.Type != lexer.RPAREN {
-		p.errors = append(p.errors, fmt.Sprintf("Expected ')', got %s", p.peekToken.Type))
+		p.errors = append(p.errors, fmt.Sprintf("Expected ')', got %s", p.curToken.Type))
 		return nil
 	}
 
 	p.nextToken() // Skip ')'
+
+	// A trailing do/end block becomes the last argument
+	if p.curToken.Type == lexer.DO && !p.noBlock {
+		if block := p.parseBlockLiteral(); block != nil {
+			args = append(args, block)
+		}
+	}
+
 	return &CallExpr{Function: function, Args: args}
 }
 
+// parseBlockLiteral parses a do |params| ... end block following a call
+func (p *Parser) parseBlockLiteral() Node {
+	block := &BlockLiteral{
+		Parameters: []Parameter{},
+		Body:       &BlockStmt{Statements: []Node{}},
+	}
+
+	// Skip 'do'
+	p.nextToken()
+
+	// An empty parameter list '||' lexes as a single OR token
+	if p.curToken.Type == lexer.OR {
+		p.nextToken()
+	} else if p.curToken.Type == lexer.PIPE {
+		p.nextToken() // Skip opening '|'
+
+		for p.curToken.Type != lexer.PIPE {
+			if p.curToken.Type != lexer.IDENT {
+				p.errors = append(p.errors, fmt.Sprintf("Expected block parameter name, got %s", p.curToken.Type))
+				return nil
+			}
+
+			param := Parameter{Name: p.curToken.Literal, Type: &TypeAnnotation{TypeName: "any"}}
+			p.nextToken()
+
+			// Check for type annotation
+			if p.curToken.Type == lexer.COLON {
+				p.nextToken() // Skip ':'
+				param.Type = p.parseTypeAnnotation()
+				if param.Type == nil {
+					return nil
+				}
+			}
+
+			block.Parameters = append(block.Parameters, param)
+
+			if p.curToken.Type == lexer.COMMA {
+				p.nextToken() // Skip ','
+			} else if p.curToken.Type != lexer.PIPE {
+				p.errors = append(p.errors, fmt.Sprintf("Expected ',' or '|' in block parameters, got %s", p.curToken.Type))
+				return nil
+			}
+		}
+
+		p.nextToken() // Skip closing '|'
+	}
+
+	// Parse statements until we see 'end' or EOF
+	block.Body = p.parseBlockUntil(lexer.END)
+
+	if p.curToken.Type != lexer.END {
+		p.errors = append(p.errors, "Expected 'end' to close block")
+		return nil
+	}
+
+	p.nextToken() // Skip 'end'
+	return block
+}
+
+func (p *Parser) parseMapLiteral() Node {
+	mapLit := &MapLiteral{Keys: []Node{}, Values: []Node{}}
+
+	// We're already at '{', skip to the first key
+	p.nextToken()
+
+	for p.curToken.Type != lexer.RBRACE {
+		key := p.parseExpression(LOWEST)
+		if key == nil {
+			p.errors = append(p.errors, fmt.Sprintf("Expected map key, got %s", p.curToken.Type))
+			return nil
+		}
+
+		if p.curToken.Type != lexer.COLON {
+			p.errors = append(p.errors, fmt.Sprintf("Expected ':' after map key, got %s", p.curToken.Type))
+			return nil
+		}
+		p.nextToken() // Skip ':'
+
+		value := p.parseExpression(LOWEST)
+		if value == nil {
+			p.errors = append(p.errors, fmt.Sprintf("Expected map value, got %s", p.curToken.Type))
+			return nil
+		}
+
+		mapLit.Keys = append(mapLit.Keys, key)
+		mapLit.Values = append(mapLit.Values, value)
+
+		if p.curToken.Type != lexer.COMMA {
+			break
+		}
+		p.nextToken() // Skip ',', allowing a trailing comma
+	}
+
+	if p.curToken.Type != lexer.RBRACE {
+		p.errors = append(p.errors, fmt.Sprintf("Expected '}', got %s", p.curToken.Type))
+		return nil
+	}
+
+	// Leave the closing brace as the current token, like the other prefix expressions
+	return mapLit
+}
+
 func (p *Parser) parseIndexExpression(array Node) Node {
 	// Skip '['
 	p.nextToken()
 
-	index := p.parseExpression(LOWEST)
+	var index Node
+	if p.curToken.Type != lexer.COLON {
+		index = p.parseExpression(LOWEST)
+	}
+
+	// A ':' makes this a slice, array[start:end:step], with every part optional
+	if p.curToken.Type == lexer.COLON {
+		return p.parseSliceExpression(array, index)
+	}
 
 	if p.curToken.Type != lexer.RBRACKET {
 		p.errors = append(p.errors, fmt.Sprintf("Expected ']', got %s", p.curToken.Type))
@@ -1828,11 +2481,50 @@ func (p *Parser) parseIndexExpression(array Node) Node {
 	return &IndexExpr{Array: array, Index: index}
 }
 
+func (p *Parser) parseSliceExpression(array Node, start Node) Node {
+	slice := &SliceExpr{Array: array, Start: start}
+
+	p.nextToken() // Skip ':'
+	if p.curToken.Type != lexer.COLON && p.curToken.Type != lexer.RBRACKET {
+		slice.End = p.parseExpression(LOWEST)
+	}
+
+	if p.curToken.Type == lexer.COLON {
+		p.nextToken() // Skip the second ':'
+		if p.curToken.Type != lexer.RBRACKET {
+			slice.Step = p.parseExpression(LOWEST)
+		}
+	}
+
+	if p.curToken.Type != lexer.RBRACKET {
+		p.errors = append(p.errors, fmt.Sprintf("Expected ']' to close slice, got %s", p.curToken.Type))
+		return nil
+	}
+
+	p.nextToken() // Skip ']'
+	return slice
+}
+
+// parseCastExpression parses the type after 'as' once the value being cast
+// has been parsed; the current token is 'as'
+func (p *Parser) parseCastExpression(value Node) Node {
+	p.nextToken() // Skip 'as'
+
+	typeAnnotation := p.parseTypeAnnotation()
+	if typeAnnotation == nil {
+		return value
+	}
+	return &CastExpr{Value: value, Target: typeAnnotation}
+}
+
 func (p *Parser) parseDotExpression(left Node) Node {
 	debugf("parseDotExpression - at token: %s, left: %s", p.curToken.Type, left.String())
 
+	// '?.' short-circuits to nil when the receiver is nil
+	optional := p.curToken.Type == lexer.SAFE_DOT
+
 	// Check for range operator '..' in for loops (e.g. 0..5)
-	if p.peekToken.Type == lexer.DOT {
+	if !optional && p.peekToken.Type == lexer.DOT {
 		// We have a '..' range operator
 		// Skip first '.' token
 		p.nextToken()
@@ -1850,34 +2542,53 @@ func (p *Parser) parseDotExpression(left Node) Node {
 		}
 	}
 
-	// Skip the '.' token
+	// Skip the '.' or '?.' token
 	p.nextToken()
 
 	// Next token should be the method name or 'new'
 	if p.curToken.Type != lexer.IDENT && p.curToken.Type != lexer.NEW {
-		p.addError(fmt.Sprintf("Expected method name or 'new' after '.', got %s", p.curToken.Type))
+		p.addError(fmt.Sprintf("Expected method name or 'new' after '%s', got %s", dotLiteral(optional), p.curToken.Type))
 		return nil
 	}
 
 	// If it's 'new', parse it as a class instantiation
 	if p.curToken.Type == lexer.NEW {
+		if optional {
+			p.addError("Cannot use '?.' with 'new'")
+			return nil
+		}
 		return p.parseClassInstantiation(left)
 	}
 
-	// Otherwise it's a method call
-	methodCall := &MethodCall{
-		Object: left,
-		Method: p.curToken.Literal,
-		Args:   []Node{},
-	}
+	name := p.curToken.Literal
 
-	// Skip method name
+	// Skip method or property name
 	p.nextToken()
 
-	// Check for opening parenthesis
+	// A do/end block alone is the only argument, as in 5.times do |i| ... end
+	if p.curToken.Type == lexer.DO && !p.noBlock {
+		methodCall := &MethodCall{Object: left, Method: name, Optional: optional}
+		if block := p.parseBlockLiteral(); block != nil {
+			methodCall.Args = []Node{block}
+		}
+		return methodCall
+	}
+
+	// Without parentheses this is a property access
 	if p.curToken.Type != lexer.LPAREN {
-		p.addError(fmt.Sprintf("Expected '(' after method name, got %s", p.curToken.Type))
-		return nil
+		return &DotExpr{
+			Object:   left,
+			Property: name,
+			Optional: optional,
+		}
+	}
+
+	// Otherwise it's a method call
+	methodCall := &MethodCall{
+		Object:   left,
+		Method:   name,
+		Args:     []Node{},
+		Optional: optional,
 	}
 
 	// Skip '('
@@ -1892,27 +2603,19 @@ func (p *Parser) parseDotExpression(left Node) Node {
 		}
 
 		// Parse additional arguments
-		for p.peekToken.Type == lexer.COMMA {
+		for p.curToken.Type == lexer.COMMA {
 			p.nextToken() // Skip the comma
-			p.nextToken() // Move to the next argument
+
+			// Handle trailing comma
+			if p.curToken.Type == lexer.RPAREN {
+				break
+			}
 
 			arg := p.parseExpression(LOWEST)
 			if arg != nil {
 				methodCall.Args = append(methodCall.Args, arg)
-				fmt.Printf("DEBUG: parseClassInstantiation - added additional argument: %s\n", arg.String())
 			}
 		}
-
-		// Ensure we are at the closing parenthesis
-		if p.peekToken.Type == lexer.RPAREN {
-			p.nextToken()
-		} else {
-			p.errors = append(p.errors, fmt.Sprintf("Expected ')' to close arguments, got %s", p.peekToken.Type))
-			return nil
-		}
-
-		p.nextToken() // Skip the closing parenthesis
-		return methodCall
 	}
 
 	// Check for closing parenthesis
@@ -1924,9 +2627,24 @@ func (p *Parser) parseDotExpression(left Node) Node {
 	// Skip ')'
 	p.nextToken()
 
+	// A trailing do/end block becomes the last argument
+	if p.curToken.Type == lexer.DO && !p.noBlock {
+		if block := p.parseBlockLiteral(); block != nil {
+			methodCall.Args = append(methodCall.Args, block)
+		}
+	}
+
 	return methodCall
 }
 
+// dotLiteral returns the source form of a member access operator
+func dotLiteral(optional bool) string {
+	if optional {
+		return "?."
+	}
+	return "."
+}
+
 // parseClassInstantiation parses a class instantiation (ClassName.new(...))
 func (p *Parser) parseClassInstantiation(left Node) Node {
 	fmt.Printf("DEBUG: parseClassInstantiation - at token: %s, literal: %s\n", p.curToken.Type, p.curToken.Literal)
@@ -1993,13 +2711,13 @@ func (p *Parser) parseArrayElement() Node {
 	// Handle different element types
 	switch p.curToken.Type {
 	case lexer.INT:
-		value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+		value, err := strconv.ParseInt(p.curToken.Literal, 10, 64)
 		if err != nil {
 			p.errors = append(p.errors, fmt.Sprintf("Could not parse %q as integer", p.curToken.Literal))
 			return nil
 		}
 		p.nextToken() // Move past the number
-		return &NumberLiteral{Value: value, IsInt: true}
+		return &NumberLiteral{Value: float64(value), IsInt: true, Int: value}
 
 	case lexer.FLOAT:
 		value, err := strconv.ParseFloat(p.curToken.Literal, 64)
@@ -2059,6 +2777,7 @@ func (p *Parser) parseSelfExpr() Node {
 
 // ClassInst represents a class instantiation expression
 type ClassInst struct {
+	Position
 	Token      lexer.Token
 	Class      Node
 	Arguments  []Node
@@ -2082,18 +2801,33 @@ func (c *ClassInst) String() string {
 
 // ClassDef represents a class definition
 type ClassDef struct {
+	Position
 	Name       string            // The name of the class
 	Parent     string            // The parent class (if any)
 	Methods    []Node            // Methods defined in the class
-	Fields     []struct {        // Fields defined in the class
-		Name          string
-		TypeAnnotation struct {
-			TypeName string
-		}
-	}
+	Fields     []FieldDecl       // Instance variables declared in the class body
 	TypeParams []string          // Type parameters for generic classes
 }
 
+// FieldDecl declares an instance variable in a class body, with an optional
+// type and default value: @count: int = 0
+type FieldDecl struct {
+	Name    string
+	Type    *TypeAnnotation // nil when the field isn't annotated
+	Default Node            // nil when the field has no default
+}
+
+func (f FieldDecl) String() string {
+	result := "@" + f.Name
+	if f.Type != nil {
+		result += ": " + f.Type.String()
+	}
+	if f.Default != nil {
+		result += " = " + f.Default.String()
+	}
+	return result
+}
+
 // Type returns the type of the node
 func (c *ClassDef) Type() NodeType {
 	return ClassDefNode
@@ -2108,7 +2842,7 @@ func (c *ClassDef) String() string {
 
 	var fields []string
 	for _, field := range c.Fields {
-		fields = append(fields, field.Name)
+		fields = append(fields, field.String())
 	}
 
 	parent := c.Parent
@@ -2134,9 +2868,20 @@ func (p *Parser) parseForStatement() Node {
 		return nil
 	}
 	stmt.Iterator = p.curToken.Literal
+	p.nextToken()
+
+	// A second variable takes the value when iterating a map (for k, v in m)
+	if p.curToken.Type == lexer.COMMA {
+		p.nextToken()
+		if p.curToken.Type != lexer.IDENT {
+			p.errors = append(p.errors, fmt.Sprintf("Expected identifier for value after comma, got %s", p.curToken.Type))
+			return nil
+		}
+		stmt.Value = p.curToken.Literal
+		p.nextToken()
+	}
 
 	// Expect 'in' token
-	p.nextToken()
 	if p.curToken.Type != lexer.IN {
 		p.errors = append(p.errors, fmt.Sprintf("Expected 'in' after iterator, got %s", p.curToken.Type))
 		return nil
@@ -2146,51 +2891,21 @@ func (p *Parser) parseForStatement() Node {
 	p.nextToken()
 
 	// Parse the iterable expression
-	stmt.Iterable = p.parseExpression(LOWEST)
-
-	// Special handling for array literals which might have consumed the 'do' token
-	// due to how parseArrayLiteral works
-	if p.curToken.Type == lexer.END {
-		// We've somehow skipped the 'do' token and landed on 'end' directly
-		// This means the loop body is empty, so we'll create an empty body
-		stmt.Body = &BlockStmt{Statements: []Node{}}
+	stmt.Iterable = p.parseHeaderExpression()
 
-		// Skip the 'end' token
-		p.nextToken()
-		return stmt
+	if stmt.Iterable == nil {
+		p.errors = append(p.errors, "Invalid or missing iterable in for statement")
+		return nil
 	}
 
 	// The 'do' keyword is optional
 	if p.curToken.Type == lexer.DO {
 		// Skip 'do'
 		p.nextToken()
-	} else if p.peekToken.Type == lexer.DO {
-		// Move to and skip 'do'
-		p.nextToken()
-		p.nextToken()
 	}
-	// No error if 'do' is not present - proceed with parsing the body
-
-	// Create a new block for the body
-	bodyBlock := &BlockStmt{Statements: []Node{}}
 
 	// Parse statements until we reach 'end'
-	for p.curToken.Type != lexer.END && p.curToken.Type != lexer.EOF {
-		stmt := p.parseStatement()
-		if stmt != nil {
-			bodyBlock.Statements = append(bodyBlock.Statements, stmt)
-		}
-
-		// Check if we've reached the end token after parsing a statement
-		if p.curToken.Type == lexer.END {
-			break
-		}
-
-		p.nextToken()
-	}
-
-	// Set the body
-	stmt.Body = bodyBlock
+	stmt.Body = p.parseBlockUntil(lexer.END)
 
 	// Skip the 'end' token if present
 	if p.curToken.Type == lexer.END {
@@ -2354,42 +3069,20 @@ func (p *Parser) parseBinaryExpression(left Node) Node {
 	p.nextToken()
 	fmt.Printf("DEBUG: parseBinaryExpression - now at token: %s, literal: %s\n", p.curToken.Type, p.curToken.Literal)
 
-	// Parse the right-hand-side expression
-	var right Node
-
-	// Handle the case where an identifier might be automatically converted to a function call
-	// without parentheses. We need to check if it's an identifier before automatic conversion.
-	if p.curToken.Type == lexer.IDENT {
-		// Create an identifier node first
-		identNode := &Identifier{Name: p.curToken.Literal}
-		p.nextToken() // Consume the identifier
-
-		// Check if it should be treated as a function call without parentheses
-		if !isInfixOperator(p.curToken.Type) &&
-		   p.curToken.Type != lexer.LPAREN &&
-		   p.curToken.Type != lexer.LBRACKET &&
-		   p.curToken.Type != lexer.DOT &&
-		   p.curToken.Type != lexer.ASSIGN &&
-		   p.curToken.Type != lexer.PLUS_ASSIGN &&
-		   p.curToken.Type != lexer.MINUS_ASSIGN &&
-		   p.curToken.Type != lexer.MUL_ASSIGN &&
-		   p.curToken.Type != lexer.DIV_ASSIGN &&
-		   p.curToken.Type != lexer.MOD_ASSIGN {
-			// Create a CallExpr with empty args
-			right = &CallExpr{
-				Function: identNode,
-				Args:     []Node{},
-			}
-		} else {
-			// Just use it as a regular identifier
-			right = identNode
-		}
-	} else {
-		// Regular expression parsing
-		right = p.parseExpression(precedence)
+	// Parse the right-hand-side expression, which binds tighter than this operator.
+	// Power is right-associative, so 2 ** 3 ** 2 is 2 ** (3 ** 2).
+	if operator == "**" {
+		precedence--
 	}
+	errorCount := len(p.errors)
+	right := p.parseExpression(precedence)
 
+	// An operator with nothing after it, as in 1 + or 1 + ), is reported
+	// here unless parsing the operand already said what was wrong
 	if right == nil {
+		if len(p.errors) == errorCount {
+			p.errors = append(p.errors, fmt.Sprintf("Expected an expression after %s, got %s", operator, p.curToken.Type))
+		}
 		return nil
 	}
 
@@ -2419,9 +3112,19 @@ func (p *Parser) peekTokenIs(t lexer.TokenType) bool {
 	return p.peekToken.Type == t
 }
 
+func (p *Parser) curTokenIsAny(types ...lexer.TokenType) bool {
+	for _, t := range types {
+		if p.curToken.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
 
 // RequireStmt represents a require statement
 type RequireStmt struct {
+	Position
 	Path string
 }
 
@@ -2495,28 +3198,24 @@ func (p *Parser) parseClassDefinition() Node {
 
 	// Parse methods and instance variables
 	methods := []Node{}
+	fields := []FieldDecl{}
 
-	// Parse methods and instance variables
 	for p.curToken.Type != lexer.END && p.curToken.Type != lexer.EOF {
-		var stmt Node
-
-		if p.curToken.Type == lexer.FUNCTION {
-			// Parse method definition
-			stmt = p.parseFunctionDefinition()
-			if stmt != nil {
-				methods = append(methods, stmt)
+		switch p.curToken.Type {
+		case lexer.FUNCTION:
+			// Each parser leaves the token after its construct current
+			if method := p.parseFunctionDefinition(); method != nil {
+				methods = append(methods, method)
 			}
-		} else if p.curToken.Type == lexer.AT {
-			// Parse instance variable
-			stmt = p.parseInstanceVariable()
-		} else {
+		case lexer.AT:
+			if field, ok := p.parseFieldDeclaration(); ok {
+				fields = append(fields, field)
+			}
+		default:
 			// Parse other statements
-			stmt = p.parseStatement()
-		}
-
-		// Move to the next token if not at the end
-		if p.curToken.Type != lexer.END && p.curToken.Type != lexer.EOF {
-			p.nextToken()
+			if p.parseStatement() == nil {
+				p.nextToken()
+			}
 		}
 	}
 
@@ -2531,5 +3230,36 @@ func (p *Parser) parseClassDefinition() Node {
 		Name:    className,
 		Parent:  parentClass,
 		Methods: methods,
+		Fields:  fields,
+	}
+}
+
+// parseFieldDeclaration parses an instance variable declared in a class
+// body: @name, with an optional type annotation and default value
+func (p *Parser) parseFieldDeclaration() (FieldDecl, bool) {
+	// Skip '@'
+	p.nextToken()
+
+	if p.curToken.Type != lexer.IDENT {
+		p.errors = append(p.errors, fmt.Sprintf("Expected instance variable name after @, got %s", p.curToken.Type))
+		return FieldDecl{}, false
+	}
+	field := FieldDecl{Name: p.curToken.Literal}
+	p.nextToken()
+
+	if p.curToken.Type == lexer.COLON {
+		p.nextToken() // Skip ':'
+		field.Type = p.parseTypeAnnotation()
+	}
+
+	if p.curToken.Type == lexer.ASSIGN {
+		p.nextToken() // Skip '='
+		field.Default = p.parseExpression(LOWEST)
+		if field.Default == nil {
+			p.errors = append(p.errors, fmt.Sprintf("Expected a default value for @%s", field.Name))
+			return FieldDecl{}, false
+		}
 	}
+
+	return field, true
 }
\ No newline at end of file
@@ -1,10 +1,1096 @@
 package parser
 
 import (
+	"strings"
 	"testing"
+
+	"github.com/example/vibe/lexer"
 )
 
 // TestDummy is a placeholder test
 func TestDummy(t *testing.T) {
 	// This is a dummy test to make the package compile
-}
\ No newline at end of file
+}
+func TestOptionalChaining(t *testing.T) {
+	program, errors := Parse(lexer.New("obj?.field\nobj?.method(1, 2)"))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("Program does not contain 2 statements. got=%d", len(program.Statements))
+	}
+
+	dot, ok := program.Statements[0].(*DotExpr)
+	if !ok {
+		t.Fatalf("Statement is not a DotExpr. got=%T", program.Statements[0])
+	}
+	if !dot.Optional || dot.Property != "field" {
+		t.Errorf("Expected optional access of 'field', got %s", dot.String())
+	}
+
+	call, ok := program.Statements[1].(*MethodCall)
+	if !ok {
+		t.Fatalf("Statement is not a MethodCall. got=%T", program.Statements[1])
+	}
+	if !call.Optional || call.Method != "method" || len(call.Args) != 2 {
+		t.Errorf("Expected optional call of 'method' with 2 args, got %s", call.String())
+	}
+}
+
+func TestCallWithBlock(t *testing.T) {
+	input := `each(arr) do |x|
+  print(x)
+end`
+
+	program, errors := Parse(lexer.New(input))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("Program does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	call, ok := program.Statements[0].(*CallExpr)
+	if !ok {
+		t.Fatalf("Statement is not a CallExpr. got=%T", program.Statements[0])
+	}
+
+	if len(call.Args) != 2 {
+		t.Fatalf("Expected 2 arguments (array and block), got %d", len(call.Args))
+	}
+
+	block, ok := call.Args[1].(*BlockLiteral)
+	if !ok {
+		t.Fatalf("Last argument is not a BlockLiteral. got=%T", call.Args[1])
+	}
+
+	if len(block.Parameters) != 1 || block.Parameters[0].Name != "x" {
+		t.Errorf("Expected a single block parameter 'x', got %v", block.Parameters)
+	}
+
+	if len(block.Body.Statements) != 1 {
+		t.Errorf("Expected 1 statement in block body, got %d", len(block.Body.Statements))
+	}
+}
+
+func TestMethodCallWithBlock(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5.times() do |i|\n  print(i)\nend", "Number(5).times(Block(|i: Type(any)|, Block {\n  PrintStmt(CallExpr(i, []))\n}))"},
+		{"n.times do |i|\n  print(i)\nend", "n.times(Block(|i: Type(any)|, Block {\n  PrintStmt(CallExpr(i, []))\n}))"},
+		{"list.each_slice(2) do |pair|\nend", "list.each_slice(Number(2), Block(|pair: Type(any)|, Block {\n}))"},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("%q: parser encountered errors: %v", tt.input, errors)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: expected 1 statement, got %d", tt.input, len(program.Statements))
+		}
+		if got := program.Statements[0].String(); got != tt.expected {
+			t.Errorf("%q: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestForLoopHeaderCallIsNotBlock(t *testing.T) {
+	program, errors := Parse(lexer.New("for x in items(list) do\n  print(x)\nend"))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	forStmt, ok := program.Statements[0].(*ForStmt)
+	if !ok {
+		t.Fatalf("Statement is not a ForStmt. got=%T", program.Statements[0])
+	}
+
+	call, ok := forStmt.Iterable.(*CallExpr)
+	if !ok {
+		t.Fatalf("Iterable is not a CallExpr. got=%T", forStmt.Iterable)
+	}
+
+	if len(call.Args) != 1 {
+		t.Errorf("Expected the loop's 'do' not to be taken as a block, got %d args", len(call.Args))
+	}
+}
+
+func TestEmptyPrograms(t *testing.T) {
+	inputs := []string{
+		"",
+		"   \n  ",
+		"# only a comment\n// and another\n",
+	}
+
+	for _, input := range inputs {
+		program, errors := Parse(lexer.New(input))
+		if len(errors) > 0 {
+			t.Fatalf("Input %q: parser encountered errors: %v", input, errors)
+		}
+
+		if program == nil {
+			t.Fatalf("Input %q: expected an empty program, got nil", input)
+		}
+
+		if len(program.Statements) != 0 {
+			t.Errorf("Input %q: expected no statements, got %d", input, len(program.Statements))
+		}
+	}
+}
+
+func TestMacroDefinition(t *testing.T) {
+	input := `macro twice(name: string) do
+  return name
+end`
+
+	program, errors := Parse(lexer.New(input))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("Program does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	macro, ok := program.Statements[0].(*MacroDef)
+	if !ok {
+		t.Fatalf("Statement is not a MacroDef. got=%T", program.Statements[0])
+	}
+	if macro.Name != "twice" {
+		t.Errorf("Macro name is not 'twice'. got=%s", macro.Name)
+	}
+	if len(macro.Parameters) != 1 || macro.Parameters[0].Name != "name" {
+		t.Errorf("Expected a single 'name' parameter. got=%v", macro.Parameters)
+	}
+	if len(macro.Body.Statements) != 1 {
+		t.Errorf("Macro body does not contain 1 statement. got=%d", len(macro.Body.Statements))
+	}
+}
+
+func TestPowerPrecedence(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2 ** 3 ** 2", "BinaryExpr(Number(2) ** BinaryExpr(Number(3) ** Number(2)))"},
+		{"2 * 3 ** 2", "BinaryExpr(Number(2) * BinaryExpr(Number(3) ** Number(2)))"},
+		{"-2 ** 2", "(-BinaryExpr(Number(2) ** Number(2)))"},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("Input %q: parser encountered errors: %v", tt.input, errors)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("Input %q: expected 1 statement, got %d", tt.input, len(program.Statements))
+		}
+		if program.Statements[0].String() != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, program.Statements[0].String())
+		}
+	}
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a[1]", "a[Number(1)]"},
+		{"a[1:3]", "a[Number(1):Number(3)]"},
+		{"a[:2]", "a[:Number(2)]"},
+		{"a[1:]", "a[Number(1):]"},
+		{"a[::2]", "a[::Number(2)]"},
+		{"a[::-1]", "a[::Number(-1)]"},
+		{"a[1:5:2]", "a[Number(1):Number(5):Number(2)]"},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("Input %q: parser encountered errors: %v", tt.input, errors)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("Input %q: expected 1 statement, got %d", tt.input, len(program.Statements))
+		}
+		if program.Statements[0].String() != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, program.Statements[0].String())
+		}
+	}
+}
+
+func TestMapLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"{}", "{}"},
+		{`{"a": 1, "b": x + 1}`, `{String("a"): Number(1), String("b"): BinaryExpr(x + Number(1))}`},
+		{"{\n  1: [2],\n  true: nil,\n}", "{Number(1): [Number(2)], Boolean(true): Nil}"},
+		{`m = {"a": 1}["a"]`, `Assignment(m = {String("a"): Number(1)}[String("a")])`},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("Input %q: parser encountered errors: %v", tt.input, errors)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("Input %q: expected 1 statement, got %d", tt.input, len(program.Statements))
+		}
+		if program.Statements[0].String() != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, program.Statements[0].String())
+		}
+	}
+
+	if _, errors := Parse(lexer.New(`{"a" 1}`)); len(errors) == 0 {
+		t.Errorf("Expected an error for a map entry without ':'")
+	}
+}
+
+func TestNegativeNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[-1, -2.5]", "[Number(-1), Number(-2.500000)]"},
+		{"f(-3)", "CallExpr(f, [Number(-3)])"},
+		{"x = -4", "Assignment(x = Number(-4))"},
+		{"x = -4.5", "Assignment(x = Number(-4.500000))"},
+		{"1 - -2", "BinaryExpr(Number(1) - Number(-2))"},
+		// Only a bare number folds; anything else stays a unary minus
+		{"-x", "(-CallExpr(x, []))"},
+		{"-2 ** 2", "(-BinaryExpr(Number(2) ** Number(2)))"},
+		{"(1 + 2) * -3", "BinaryExpr(BinaryExpr(Number(1) + Number(2)) * Number(-3))"},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("Input %q: parser encountered errors: %v", tt.input, errors)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("Input %q: expected 1 statement, got %d", tt.input, len(program.Statements))
+		}
+		if program.Statements[0].String() != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, program.Statements[0].String())
+		}
+	}
+}
+
+func TestUnclosedClassDefinition(t *testing.T) {
+	// These used to be skipped silently, or loop forever inside a method
+	inputs := []string{
+		"class Point do",
+		"class Point do\n  def x() do\n    return 1",
+	}
+
+	for _, input := range inputs {
+		// The unclosed method inside is reported too, but the class must be
+		_, errors := Parse(lexer.New(input))
+		if len(errors) == 0 || errors[len(errors)-1] != "Expected 'end' to close class definition" {
+			t.Errorf("Input %q: expected a missing end error, got %v", input, errors)
+		}
+	}
+}
+
+func TestIndexAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a[0] = 5", "IndexAssignment(a[Number(0)] = Number(5))"},
+		{`m["k"] = v`, `IndexAssignment(m[String("k")] = CallExpr(v, []))`},
+		{"a[i] += 1", "IndexAssignment(a[CallExpr(i, [])] = BinaryExpr(a[CallExpr(i, [])] + Number(1)))"},
+		{"a[0][1] = 2", "IndexAssignment(a[Number(0)][Number(1)] = Number(2))"},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("Input %q: parser encountered errors: %v", tt.input, errors)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("Input %q: expected 1 statement, got %d", tt.input, len(program.Statements))
+		}
+		if program.Statements[0].String() != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, program.Statements[0].String())
+		}
+	}
+}
+
+func TestTryStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try do\n  x\nrescue do\n  y\nend", "TryStmt(Block {\n  CallExpr(x, [])\n}, Rescue(, Block {\n  CallExpr(y, [])\n}))"},
+		{"try\n  x\nrescue TypeError as e\n  y\nrescue IndexError\n  z\nend",
+			"TryStmt(Block {\n  CallExpr(x, [])\n}, Rescue(TypeError as e, Block {\n  CallExpr(y, [])\n}), Rescue(IndexError, Block {\n  CallExpr(z, [])\n}))"},
+		// A body starting on the next line isn't read as the kind
+		{"try\n  x\nrescue\n  y\nend", "TryStmt(Block {\n  CallExpr(x, [])\n}, Rescue(, Block {\n  CallExpr(y, [])\n}))"},
+		{"try\n  x\nrescue as e\n  e\nend", "TryStmt(Block {\n  CallExpr(x, [])\n}, Rescue(as e, Block {\n  CallExpr(e, [])\n}))"},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("Input %q: parser encountered errors: %v", tt.input, errors)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("Input %q: expected 1 statement, got %d", tt.input, len(program.Statements))
+		}
+		if program.Statements[0].String() != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, program.Statements[0].String())
+		}
+	}
+
+	_, errors := Parse(lexer.New("try do\n  x\nend"))
+	if len(errors) != 1 || errors[0] != "Expected at least one rescue clause in try statement" {
+		t.Errorf("Expected a missing rescue error, got %v", errors)
+	}
+}
+
+func TestTrailingCommas(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"f(1, 2,)", "CallExpr(f, [Number(1), Number(2)])"},
+		{"f(\n  1,\n  2,\n)", "CallExpr(f, [Number(1), Number(2)])"},
+		{"list.push(3,)", "list.push(Number(3))"},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("Input %q: parser encountered errors: %v", tt.input, errors)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("Input %q: expected 1 statement, got %d", tt.input, len(program.Statements))
+		}
+		if program.Statements[0].String() != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, program.Statements[0].String())
+		}
+	}
+
+	program, errors := Parse(lexer.New("def g(a: int, b: int,): int do\n  return a + b\nend"))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+	fn, ok := program.Statements[0].(*FunctionDef)
+	if !ok {
+		t.Fatalf("Expected a FunctionDef, got %T", program.Statements[0])
+	}
+	if len(fn.Parameters) != 2 || fn.Parameters[0].Name != "a" || fn.Parameters[1].Name != "b" {
+		t.Errorf("Expected parameters a and b, got %+v", fn.Parameters)
+	}
+}
+
+func TestBareReturn(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"return", "ReturnStmt(nil)"},
+		{"return 5", "ReturnStmt(Number(5))"},
+		// The next line is a statement of its own, not the returned value
+		{"return\n5", "ReturnStmt(nil)"},
+		{"if x do return end", "IfStmt(CallExpr(x, []), Block {\n  ReturnStmt(nil)\n})"},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("Input %q: parser encountered errors: %v", tt.input, errors)
+		}
+		if program.Statements[0].String() != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, program.Statements[0].String())
+		}
+	}
+}
+
+func TestClassFieldDeclarations(t *testing.T) {
+	input := `class Counter do
+  @count: int = 0
+  @label: string
+  @items = [1, 2]
+end`
+
+	program, errors := Parse(lexer.New(input))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+	if len(program.Statements) != 1 {
+		t.Fatalf("Expected 1 statement, got %d", len(program.Statements))
+	}
+
+	class, ok := program.Statements[0].(*ClassDef)
+	if !ok {
+		t.Fatalf("Expected a ClassDef, got %T", program.Statements[0])
+	}
+	if class.Name != "Counter" || len(class.Fields) != 3 {
+		t.Fatalf("Expected class Counter with 3 fields, got %s", class.String())
+	}
+
+	expected := []struct {
+		name     string
+		typeName string
+		value    string
+	}{
+		{"count", "int", "Number(0)"},
+		{"label", "string", ""},
+		{"items", "", "[Number(1), Number(2)]"},
+	}
+
+	for idx, want := range expected {
+		field := class.Fields[idx]
+		if field.Name != want.name {
+			t.Errorf("Field %d: expected name %s, got %s", idx, want.name, field.Name)
+		}
+		if (field.Type == nil && want.typeName != "") || (field.Type != nil && field.Type.TypeName != want.typeName) {
+			t.Errorf("Field %d: expected type %q, got %+v", idx, want.typeName, field.Type)
+		}
+		if (field.Default == nil && want.value != "") || (field.Default != nil && field.Default.String() != want.value) {
+			t.Errorf("Field %d: expected default %q, got %v", idx, want.value, field.Default)
+		}
+	}
+}
+
+func TestClassMethodDefinitions(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"def", `class Account do
+  @balance: int = 0
+  def deposit(amount: int): int do
+    return amount
+  end
+  def reset() do
+    return 0
+  end
+end`},
+		{"function", `class Account do
+  @balance: int = 0
+  function deposit(amount: int): int do
+    return amount
+  end
+  ,
+  function reset() do
+    return 0
+  end
+end`},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("%s: parser encountered errors: %v", tt.name, errors)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("%s: expected 1 statement, got %d", tt.name, len(program.Statements))
+		}
+
+		class, ok := program.Statements[0].(*ClassDef)
+		if !ok {
+			t.Fatalf("%s: expected a ClassDef, got %T", tt.name, program.Statements[0])
+		}
+		if class.Name != "Account" || len(class.Fields) != 1 || class.Fields[0].Name != "balance" {
+			t.Errorf("%s: expected class Account with field @balance, got %s", tt.name, class.String())
+		}
+		if len(class.Methods) != 2 {
+			t.Fatalf("%s: expected 2 methods, got %d", tt.name, len(class.Methods))
+		}
+
+		for idx, want := range []string{"deposit", "reset"} {
+			method, ok := class.Methods[idx].(*FunctionDef)
+			if !ok {
+				t.Fatalf("%s: expected method %d to be a FunctionDef, got %T", tt.name, idx, class.Methods[idx])
+			}
+			if method.Name != want {
+				t.Errorf("%s: expected method %d to be %s, got %s", tt.name, idx, want, method.Name)
+			}
+		}
+	}
+}
+
+func TestNewlineEndsStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"x = 5\n-3", []string{"Assignment(x = Number(5))", "Number(-3)"}},
+		{"x = y\n[1, 2]", []string{"Assignment(x = CallExpr(y, []))", "[Number(1), Number(2)]"}},
+		{"x = y\n(3)", []string{"Assignment(x = CallExpr(y, []))", "Number(3)"}},
+		// An expression carries on over a line that ends in an operator,
+		// or while brackets are open
+		{"x = 5 -\n3", []string{"Assignment(x = BinaryExpr(Number(5) - Number(3)))"}},
+		{"x = (5\n- 3)", []string{"Assignment(x = BinaryExpr(Number(5) - Number(3)))"}},
+		{"f(1,\n[2])", []string{"CallExpr(f, [Number(1), [Number(2)]])"}},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("%q: parser encountered errors: %v", tt.input, errors)
+		}
+		if len(program.Statements) != len(tt.expected) {
+			t.Fatalf("%q: expected %d statements, got %d", tt.input, len(tt.expected), len(program.Statements))
+		}
+		for idx, want := range tt.expected {
+			if got := program.Statements[idx].String(); got != want {
+				t.Errorf("%q: statement %d: expected %s, got %s", tt.input, idx, want, got)
+			}
+		}
+	}
+}
+
+func TestAssignmentFollowedByStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"x = 5\ny = 10", []string{"Assignment(x = Number(5))", "Assignment(y = Number(10))"}},
+		{"x = 5\nputs x", []string{"Assignment(x = Number(5))", "PrintStmt(CallExpr(x, []))"}},
+		{"x = f(1)\nx += 2\nx", []string{"Assignment(x = CallExpr(f, [Number(1)]))", "Assignment(x = BinaryExpr(x + Number(2)))", "CallExpr(x, [])"}},
+		{"x: int = 5\ny = \"a\"", []string{"VarDecl(x: Type(int) = Number(5))", "Assignment(y = String(\"a\"))"}},
+		{"def f() do\n  x = 1\n  y = x\n  return y\nend", []string{"FunctionDef(f, [], Block {\n  Assignment(x = Number(1))\n  Assignment(y = CallExpr(x, []))\n  ReturnStmt(CallExpr(y, []))\n})"}},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("%q: parser encountered errors: %v", tt.input, errors)
+		}
+		if len(program.Statements) != len(tt.expected) {
+			t.Fatalf("%q: expected %d statements, got %d", tt.input, len(tt.expected), len(program.Statements))
+		}
+		for idx, want := range tt.expected {
+			if got := program.Statements[idx].String(); got != want {
+				t.Errorf("%q: statement %d: expected %s, got %s", tt.input, idx, want, got)
+			}
+		}
+	}
+}
+
+func TestAssignmentWithoutValue(t *testing.T) {
+	// A right-hand side that isn't a value is reported, not dropped along
+	// with the assignment
+	inputs := []string{
+		"y = puts(\"a\")",
+		"x = 1 + while",
+		"x += puts 1",
+	}
+
+	for _, input := range inputs {
+		_, errors := Parse(lexer.New(input))
+		if len(errors) == 0 {
+			t.Errorf("%q: expected a parser error", input)
+		}
+	}
+}
+
+func TestMissingRightOperand(t *testing.T) {
+	// An operator without a right operand is reported rather than the
+	// expression being dropped
+	inputs := []string{"1 +", "1 + )", "x = 2 *", "puts(1 -)", "[1, 2 **]"}
+
+	for _, input := range inputs {
+		_, errors := Parse(lexer.New(input))
+		if len(errors) == 0 {
+			t.Errorf("%q: expected a parser error", input)
+		}
+	}
+}
+
+func TestIfExpressions(t *testing.T) {
+	// An if can stand wherever a value is expected, not only as a statement
+	// or the right-hand side of an assignment
+	inputs := []string{
+		"def f(c) do\n  return if c then 1 else 2 end\nend",
+		"[if c then 1 else 2 end]",
+		"len(if c then 1 else 2 end)",
+		"x = 1 + if c then 1 else 2 end",
+	}
+
+	for _, input := range inputs {
+		program, errors := Parse(lexer.New(input))
+		if len(errors) > 0 {
+			t.Errorf("%q: unexpected parser errors: %v", input, errors)
+			continue
+		}
+		if len(program.Statements) != 1 {
+			t.Errorf("%q: expected 1 statement, got %d", input, len(program.Statements))
+		}
+	}
+}
+
+func TestInstanceVariableInExpression(t *testing.T) {
+	input := `class Point do
+  def distance(other) do
+    dy = @y - other.y
+    return dy
+  end
+end`
+
+	program, errors := Parse(lexer.New(input))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	class, ok := program.Statements[0].(*ClassDef)
+	if !ok || len(class.Methods) != 1 {
+		t.Fatalf("Expected a class with one method, got %s", program.Statements[0].String())
+	}
+	method := class.Methods[0].(*FunctionDef)
+	if len(method.Body.Statements) != 2 {
+		t.Fatalf("Expected 2 statements in distance, got %d", len(method.Body.Statements))
+	}
+
+	assignment, ok := method.Body.Statements[0].(*Assignment)
+	if !ok {
+		t.Fatalf("Expected an Assignment, got %T", method.Body.Statements[0])
+	}
+	if assignment.Name != "dy" || assignment.Value.String() != "BinaryExpr(@y - other.y)" {
+		t.Errorf("Expected dy = @y - other.y, got %s", assignment.String())
+	}
+}
+
+func TestIncrementDecrement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x++", "Assignment(x = BinaryExpr(x + Number(1)))"},
+		{"x--", "Assignment(x = BinaryExpr(x - Number(1)))"},
+		{"@count++", "Assignment(@count = BinaryExpr(@count + Number(1)))"},
+		{"items[0]--", "IndexAssignment(items[Number(0)] = BinaryExpr(items[Number(0)] - Number(1)))"},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("%q: parser encountered errors: %v", tt.input, errors)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: expected 1 statement, got %d", tt.input, len(program.Statements))
+		}
+		if got := program.Statements[0].String(); got != tt.expected {
+			t.Errorf("%q: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+
+	for _, input := range []string{"5++", "\"a\"--", "y = x++",
+		// Nothing but the end of the statement can follow an update
+		"x++ + 1", "x-- * 2", "items[0]++ - 1", "@n++ 1"} {
+		if _, errors := Parse(lexer.New(input)); len(errors) == 0 {
+			t.Errorf("%q: expected a parse error", input)
+		}
+	}
+
+	// The statement can end at a separator, a line break or a closing keyword
+	for _, input := range []string{"x++; y--", "x++\n+1", "if c then x++ else x-- end", "[1].each do |i| x++ end"} {
+		if _, errors := Parse(lexer.New(input)); len(errors) > 0 {
+			t.Errorf("%q: unexpected parser errors: %v", input, errors)
+		}
+	}
+}
+
+func TestCallAfterIndex(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`m["k"]()`, `CallExpr(m[String("k")], [])`},
+		{"arr[0](x)", "CallExpr(arr[Number(0)], [CallExpr(x, [])])"},
+		{"arr[0](1)(2)", "CallExpr(CallExpr(arr[Number(0)], [Number(1)]), [Number(2)])"},
+		{`puts handlers["a"][1](2, 3)`, `PrintStmt(CallExpr(handlers[String("a")][Number(1)], [Number(2), Number(3)]))`},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("%q: parser encountered errors: %v", tt.input, errors)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: expected 1 statement, got %d", tt.input, len(program.Statements))
+		}
+		if got := program.Statements[0].String(); got != tt.expected {
+			t.Errorf("%q: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestBareCall(t *testing.T) {
+	program, errors := Parse(lexer.New("x = f\ny = f()"))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	for idx, bare := range []bool{true, false} {
+		call, ok := program.Statements[idx].(*Assignment).Value.(*CallExpr)
+		if !ok {
+			t.Fatalf("Statement %d: value is not a CallExpr. got=%T", idx, program.Statements[idx].(*Assignment).Value)
+		}
+		if call.Bare != bare {
+			t.Errorf("Statement %d: expected Bare to be %t", idx, bare)
+		}
+	}
+}
+
+func TestUndefStatement(t *testing.T) {
+	program, errors := Parse(lexer.New("undef x\ny = 1"))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+	if len(program.Statements) != 2 {
+		t.Fatalf("Expected 2 statements, got %d", len(program.Statements))
+	}
+	if got := program.Statements[0].String(); got != "Undef(x)" {
+		t.Errorf("Expected Undef(x), got %s", got)
+	}
+
+	_, errors = Parse(lexer.New("undef 5"))
+	if len(errors) == 0 {
+		t.Errorf("Expected an error for undef without a name")
+	}
+}
+
+func TestUnaryPlus(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"+5", "Number(5)"},
+		{"+3.14", "Number(3.140000)"},
+		{"+x", "(+CallExpr(x, []))"},
+		{"x = 1 - +2", "Assignment(x = BinaryExpr(Number(1) - Number(2)))"},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("Input %q: parser encountered errors: %v", tt.input, errors)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("Input %q: expected 1 statement, got %d", tt.input, len(program.Statements))
+		}
+		if got := program.Statements[0].String(); got != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestInstanceVariableAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"@count = 1", "Assignment(@count = Number(1))"},
+		{"@count += n", "Assignment(@count = BinaryExpr(@count + CallExpr(n, [])))"},
+		{"@count++", "Assignment(@count = BinaryExpr(@count + Number(1)))"},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("Input %q: parser encountered errors: %v", tt.input, errors)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("Input %q: expected 1 statement, got %d", tt.input, len(program.Statements))
+		}
+		if got := program.Statements[0].String(); got != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestCastExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"5" as int`, `Cast(String("5") as Type(int))`},
+		{"5 as float", "Cast(Number(5) as Type(float))"},
+		// A cast binds tighter than arithmetic but looser than a prefix operator
+		{"x = a + b as float", "Assignment(x = BinaryExpr(a + Cast(CallExpr(b, []) as Type(float))))"},
+		{"x = -a as int", "Assignment(x = Cast((-CallExpr(a, [])) as Type(int)))"},
+		{"x = a as Array<int>", "Assignment(x = Cast(CallExpr(a, []) as Type(Array<Type(int)>)))"},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("Input %q: parser encountered errors: %v", tt.input, errors)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("Input %q: expected 1 statement, got %d", tt.input, len(program.Statements))
+		}
+		if got := program.Statements[0].String(); got != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+
+	_, errors := Parse(lexer.New("x = 5 as"))
+	if len(errors) == 0 {
+		t.Errorf("Expected an error for a cast without a type")
+	}
+}
+
+func TestInOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = a in b", "Assignment(x = BinaryExpr(a in CallExpr(b, [])))"},
+		// in binds like a comparison: looser than arithmetic, tighter than &&
+		{"x = a + 1 in b", "Assignment(x = BinaryExpr(BinaryExpr(a + Number(1)) in CallExpr(b, [])))"},
+		{"x = a in b && c", "Assignment(x = BinaryExpr(BinaryExpr(a in b) && CallExpr(c, [])))"},
+		{`x = "k" in {"k": 1}`, `Assignment(x = BinaryExpr(String("k") in {String("k"): Number(1)}))`},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("Input %q: parser encountered errors: %v", tt.input, errors)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("Input %q: expected 1 statement, got %d", tt.input, len(program.Statements))
+		}
+		if got := program.Statements[0].String(); got != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+
+	// A for loop still takes its in for itself
+	program, errors := Parse(lexer.New("for n in items do\n  puts n in seen\nend"))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+	if _, ok := program.Statements[0].(*ForStmt); !ok {
+		t.Errorf("Expected a ForStmt, got %T", program.Statements[0])
+	}
+}
+
+func TestTrailingComments(t *testing.T) {
+	// Each input should parse exactly like the same code without comments
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5 # set x", "x = 5"},
+		{"x = 5 // set x", "x = 5"},
+		{"x = 5 # set x\ny = x", "x = 5\ny = x"},
+		{"x = 5 // set x\ny = x", "x = 5\ny = x"},
+		{"total = a + b * 2 # weighted\nputs total // show it", "total = a + b * 2\nputs total"},
+		{"a = [1, 2] # list\na[0] // first", "a = [1, 2]\na[0]"},
+		// A division sign isn't mistaken for the start of a comment
+		{"half = n / 2 // rounded down", "half = n / 2"},
+		{"def f(n: int): int do # start\n  y = n * 3 // triple\n  y + 1 # add one\nend # done\nf(2)", "def f(n: int): int do\n  y = n * 3\n  y + 1\nend\nf(2)"},
+		{"if x > 1 do // big\n  puts x # show\nelse # small\n  puts 0\nend", "if x > 1 do\n  puts x\nelse\n  puts 0\nend"},
+		{"for n in items do # each\n  puts n // print\nend", "for n in items do\n  puts n\nend"},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("Input %q: parser encountered errors: %v", tt.input, errors)
+		}
+		expected, _ := Parse(lexer.New(tt.expected))
+		if len(program.Statements) != len(expected.Statements) {
+			t.Fatalf("Input %q: expected %d statements, got %d", tt.input, len(expected.Statements), len(program.Statements))
+		}
+		for idx, stmt := range program.Statements {
+			if got, want := stmt.String(), expected.Statements[idx].String(); got != want {
+				t.Errorf("Input %q: expected %s, got %s", tt.input, want, got)
+			}
+		}
+	}
+}
+
+func TestDoWhile(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"do\n  i += 1\nend while i < 3", "DoWhileStmt(Block {\n  Assignment(i = BinaryExpr(i + Number(1)))\n}, BinaryExpr(i < Number(3)))"},
+		{"do\nend while false", "DoWhileStmt(Block {\n}, Boolean(false))"},
+		{"x = do\n  n\nend while more()", "Assignment(x = DoWhileStmt(Block {\n  CallExpr(n, [])\n}, CallExpr(more, [])))"},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("Input %q: parser encountered errors: %v", tt.input, errors)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("Input %q: expected 1 statement, got %d", tt.input, len(program.Statements))
+		}
+		if got := program.Statements[0].String(); got != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+
+	// The condition ends the loop, so the next line starts a new statement
+	program, errors := Parse(lexer.New("do\n  i += 1\nend while i < 3\nputs i"))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+	if len(program.Statements) != 2 {
+		t.Fatalf("Expected 2 statements, got %d", len(program.Statements))
+	}
+
+	// The while has to follow on the end's line
+	for _, input := range []string{"do\n  1\nend", "do\n  1\nend\nwhile x do\nend"} {
+		if _, errors := Parse(lexer.New(input)); len(errors) == 0 {
+			t.Errorf("Input %q: expected an error for a do block without while", input)
+		}
+	}
+
+	// A do block that isn't a loop is reported for what's really wrong,
+	// not as a loop missing its while
+	diagnostics := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 1 / do\n  2\nend", "Expected an expression after /"},
+		{"each([1], do |x|\n  puts x\nend)", "a block goes after the arguments"},
+		{"map([1], def(x) do\n  x\nend)", "Expected ')', got FUNCTION"},
+	}
+	for _, tt := range diagnostics {
+		_, errors := Parse(lexer.New(tt.input))
+		if len(errors) == 0 || !strings.Contains(errors[0], tt.expected) {
+			t.Errorf("Input %q: expected an error mentioning %q, got %v", tt.input, tt.expected, errors)
+		}
+		for _, err := range errors {
+			if strings.Contains(err, "Expected 'while'") {
+				t.Errorf("Input %q: unexpected do-while error %q", tt.input, err)
+			}
+		}
+	}
+}
+
+func TestMethodCallsOnLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = [1, 2, 3].map(double)", "Assignment(x = [Number(1), Number(2), Number(3)].map(CallExpr(double, [])))"},
+		{`x = "abc".upcase()`, `Assignment(x = String("abc").upcase())`},
+		{`x = {"a": 1}.size()`, `Assignment(x = {String("a"): Number(1)}.size())`},
+		{"x = [3, 1].length", "Assignment(x = [Number(3), Number(1)].length)"},
+		{"x = 5.times(f)", "Assignment(x = Number(5).times(CallExpr(f, [])))"},
+		// Calls chain and can be indexed like any other value
+		{"x = [1, 2].map(f).map(g)", "Assignment(x = [Number(1), Number(2)].map(CallExpr(f, [])).map(CallExpr(g, [])))"},
+		{`x = "a,b".split(",")[1]`, `Assignment(x = String("a,b").split(String(","))[Number(1)])`},
+		// A literal can start a statement too
+		{"[1, 2].map(f)", "[Number(1), Number(2)].map(CallExpr(f, []))"},
+		{`"hi".upcase()`, `String("hi").upcase()`},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("Input %q: parser encountered errors: %v", tt.input, errors)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("Input %q: expected 1 statement, got %d", tt.input, len(program.Statements))
+		}
+		if got := program.Statements[0].String(); got != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestInstanceVariableStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"@n = 1", "Assignment(@n = Number(1))"},
+		{"@n += 1", "Assignment(@n = BinaryExpr(@n + Number(1)))"},
+		// A statement that only starts with an instance variable keeps going
+		{"@n + 1", "BinaryExpr(@n + Number(1))"},
+		{"@items.size()", "@items.size()"},
+		{"@n == 0 && @done", "BinaryExpr(BinaryExpr(@n == Number(0)) && @done)"},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("Input %q: parser encountered errors: %v", tt.input, errors)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("Input %q: expected 1 statement, got %d", tt.input, len(program.Statements))
+		}
+		if got := program.Statements[0].String(); got != tt.expected {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestFunctionReturnTypes(t *testing.T) {
+	tests := []struct {
+		input      string
+		returnType string // Empty when no return type is declared
+	}{
+		{"def f(): int do\n  1\nend", "Type(int)"},
+		{"def f: string do\n  \"s\"\nend", "Type(string)"},
+		{"def f(x) do\n  x\nend", ""},
+		{"def f do\n  puts 1\nend", ""},
+	}
+
+	for _, tt := range tests {
+		program, errors := Parse(lexer.New(tt.input))
+		if len(errors) > 0 {
+			t.Fatalf("Input %q: parser encountered errors: %v", tt.input, errors)
+		}
+		fn, ok := program.Statements[0].(*FunctionDef)
+		if !ok {
+			t.Fatalf("Input %q: expected a FunctionDef, got %T", tt.input, program.Statements[0])
+		}
+		if tt.returnType == "" {
+			if fn.ReturnType != nil {
+				t.Errorf("Input %q: expected no return type, got %s", tt.input, fn.ReturnType.String())
+			}
+			continue
+		}
+		if fn.ReturnType == nil || fn.ReturnType.String() != tt.returnType {
+			t.Errorf("Input %q: expected return type %s, got %v", tt.input, tt.returnType, fn.ReturnType)
+		}
+	}
+}
+
+func TestOperatorMethodNames(t *testing.T) {
+	input := `class Version do
+  def <=>(other): int do
+    0
+  end
+end`
+
+	program, errors := Parse(lexer.New(input))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+	class, ok := program.Statements[0].(*ClassDef)
+	if !ok {
+		t.Fatalf("Expected a ClassDef, got %T", program.Statements[0])
+	}
+	if len(class.Methods) != 1 {
+		t.Fatalf("Expected 1 method, got %d", len(class.Methods))
+	}
+	if method, ok := class.Methods[0].(*FunctionDef); !ok || method.Name != "<=>" {
+		t.Errorf("Expected a <=> method, got %s", class.Methods[0].String())
+	}
+
+	// Other operators aren't method names
+	if _, errors := Parse(lexer.New("def +(other) do\n  0\nend")); len(errors) == 0 {
+		t.Errorf("Expected an error defining +")
+	}
+}
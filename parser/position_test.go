@@ -0,0 +1,66 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/example/vibe/lexer"
+	"github.com/example/vibe/parser"
+)
+
+func TestNodePositions(t *testing.T) {
+	input := `total = 0
+def add(a, b) do
+  return a + b
+end
+for x in [1, 2] do
+  total = add(total, x * 2)
+end`
+
+	program, errors := parser.Parse(lexer.New(input))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	// Record the position of every node by its string form
+	positions := make(map[string]parser.Position)
+	parser.Walk(program, func(node parser.Node) bool {
+		if _, seen := positions[node.String()]; !seen {
+			positions[node.String()] = node.Pos()
+		}
+		return true
+	})
+
+	tests := []struct {
+		node     string
+		expected parser.Position
+	}{
+		{"Assignment(total = Number(0))", parser.Position{Line: 1, Column: 1}},
+		{"Number(0)", parser.Position{Line: 1, Column: 9}},
+		{"ReturnStmt(BinaryExpr(a + CallExpr(b, [])))", parser.Position{Line: 3, Column: 3}},
+		{"BinaryExpr(a + CallExpr(b, []))", parser.Position{Line: 3, Column: 10}},
+		{"[Number(1), Number(2)]", parser.Position{Line: 5, Column: 10}},
+		{"Number(2)", parser.Position{Line: 5, Column: 14}},
+		{"CallExpr(add, [CallExpr(total, []), BinaryExpr(x * Number(2))])", parser.Position{Line: 6, Column: 11}},
+		{"BinaryExpr(x * Number(2))", parser.Position{Line: 6, Column: 22}},
+	}
+
+	for _, tt := range tests {
+		pos, ok := positions[tt.node]
+		if !ok {
+			t.Errorf("Node %s not found in the AST", tt.node)
+			continue
+		}
+		if pos != tt.expected {
+			t.Errorf("Node %s: expected position %d:%d, got %d:%d",
+				tt.node, tt.expected.Line, tt.expected.Column, pos.Line, pos.Column)
+		}
+	}
+
+	// Statements start at their first token
+	if def := program.Statements[1]; def.Pos() != (parser.Position{Line: 2, Column: 1}) {
+		t.Errorf("Expected the function definition at 2:1, got %d:%d", def.Pos().Line, def.Pos().Column)
+	}
+	if loop := program.Statements[2]; loop.Pos() != (parser.Position{Line: 5, Column: 1}) {
+		t.Errorf("Expected the for loop at 5:1, got %d:%d", loop.Pos().Line, loop.Pos().Column)
+	}
+}
@@ -0,0 +1,129 @@
+package parser
+
+// Children returns the nodes directly beneath node in source order. Type
+// annotations, names and other leaf data aren't included, and parts that
+// were omitted from the source (an else branch, a slice bound) are skipped.
+func Children(node Node) []Node {
+	var children []Node
+	add := func(nodes ...Node) {
+		for _, child := range nodes {
+			if child != nil {
+				children = append(children, child)
+			}
+		}
+	}
+	// A nil *BlockStmt would make a non-nil Node, so blocks are checked first
+	addBlock := func(block *BlockStmt) {
+		if block != nil {
+			children = append(children, block)
+		}
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		add(node.Statements...)
+	case *BlockStmt:
+		add(node.Statements...)
+	case *BinaryExpr:
+		add(node.Left, node.Right)
+	case *UnaryExpr:
+		add(node.Right)
+	case *CastExpr:
+		add(node.Value)
+	case *CallExpr:
+		add(node.Function)
+		add(node.Args...)
+	case *BlockLiteral:
+		addBlock(node.Body)
+	case *ArrayLiteral:
+		add(node.Elements...)
+	case *MapLiteral:
+		// Keys and values alternate
+		for idx, key := range node.Keys {
+			add(key, node.Values[idx])
+		}
+	case *IndexExpr:
+		add(node.Array, node.Index)
+	case *SliceExpr:
+		add(node.Array, node.Start, node.End, node.Step)
+	case *DotExpr:
+		add(node.Object)
+	case *MethodCall:
+		add(node.Object)
+		add(node.Args...)
+	case *ClassInst:
+		add(node.Class)
+		add(node.Arguments...)
+	case *ClassDef:
+		for _, field := range node.Fields {
+			add(field.Default)
+		}
+		add(node.Methods...)
+	case *Assignment:
+		add(node.Value)
+	case *IndexAssignment:
+		if node.Target != nil {
+			children = append(children, node.Target)
+		}
+		add(node.Value)
+	case *VariableDecl:
+		add(node.Value)
+	case *TypeDeclaration:
+		add(node.TypeValue)
+	case *PrintStmt:
+		add(node.Value)
+	case *ReturnStmt:
+		add(node.Value)
+	case *IfStmt:
+		add(node.Condition)
+		addBlock(node.Consequence)
+		for _, elseIf := range node.ElseIfBlocks {
+			add(elseIf.Condition)
+			addBlock(elseIf.Consequence)
+		}
+		addBlock(node.Alternative)
+	case *TryStmt:
+		addBlock(node.Body)
+		for _, rescue := range node.Rescues {
+			addBlock(rescue.Body)
+		}
+	case *WhileStmt:
+		add(node.Condition)
+		addBlock(node.Body)
+	case *DoWhileStmt:
+		addBlock(node.Body)
+		add(node.Condition)
+	case *ForStmt:
+		add(node.Iterable)
+		addBlock(node.Body)
+	case *FunctionDef:
+		addBlock(node.Body)
+	case *MacroDef:
+		addBlock(node.Body)
+	}
+
+	return children
+}
+
+// Walk visits node and then every node beneath it, depth first and in
+// source order. When visit returns false the node's children are skipped.
+func Walk(node Node, visit func(Node) bool) {
+	if node == nil || !visit(node) {
+		return
+	}
+	for _, child := range Children(node) {
+		Walk(child, visit)
+	}
+}
+
+// IsExpression reports whether node is an expression, something evaluated
+// for its value, rather than a statement run for its effect
+func IsExpression(node Node) bool {
+	switch node.(type) {
+	case *NumberLiteral, *StringLiteral, *BooleanLiteral, *NilLiteral, *Identifier,
+		*BinaryExpr, *UnaryExpr, *CastExpr, *CallExpr, *BlockLiteral, *ArrayLiteral, *MapLiteral,
+		*IndexExpr, *SliceExpr, *DotExpr, *MethodCall, *ClassInst, *SelfExpr:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/example/vibe/lexer"
+	"github.com/example/vibe/parser"
+)
+
+func TestWalkCountsNodeTypes(t *testing.T) {
+	input := `
+def add(a, b) do
+  return a + b
+end
+
+total = 0
+for x in [1, 2, 3] do
+  if x > 1
+    total = add(total, x)
+  end
+end
+`
+
+	program, errors := parser.Parse(lexer.New(input))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	counts := make(map[parser.NodeType]int)
+	parser.Walk(program, func(node parser.Node) bool {
+		counts[node.Type()]++
+		return true
+	})
+
+	expected := map[parser.NodeType]int{
+		parser.ProgramNode:      1,
+		parser.FunctionDefNode:  1,
+		parser.ReturnStmtNode:   1,
+		parser.BinaryExprNode:   2, // a + b, x > 1
+		parser.AssignmentNode:   2,
+		parser.ForStmtNode:      1,
+		parser.IfStmtNode:       1,
+		parser.ArrayLiteralNode: 1,
+		parser.NumberNode:       5, // 0, 1, 2, 3, and the 1 in x > 1
+		parser.BlockStmtNode:    3, // function, loop and if bodies
+	}
+	for nodeType, count := range expected {
+		if counts[nodeType] != count {
+			t.Errorf("Expected %d %s nodes, got %d", count, nodeType, counts[nodeType])
+		}
+	}
+}
+
+func TestWalkVisitsCastOperands(t *testing.T) {
+	program, errors := parser.Parse(lexer.New("(1 + 2) as float"))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	var visited []parser.NodeType
+	parser.Walk(program, func(node parser.Node) bool {
+		visited = append(visited, node.Type())
+		return true
+	})
+
+	expected := []parser.NodeType{parser.ProgramNode, parser.CastExprNode, parser.BinaryExprNode, parser.NumberNode, parser.NumberNode}
+	if len(visited) != len(expected) {
+		t.Fatalf("Expected to visit %v, got %v", expected, visited)
+	}
+	for idx, nodeType := range expected {
+		if visited[idx] != nodeType {
+			t.Errorf("Expected to visit %v, got %v", expected, visited)
+			break
+		}
+	}
+
+	if !parser.IsExpression(program.Statements[0]) {
+		t.Errorf("Expected a cast to be an expression")
+	}
+}
+
+func TestWalkPrunesSubtrees(t *testing.T) {
+	program, errors := parser.Parse(lexer.New("x = [1, 2]\nprint 3"))
+	if len(errors) > 0 {
+		t.Fatalf("Parser encountered errors: %v", errors)
+	}
+
+	// Returning false for the array skips its elements
+	var numbers []string
+	parser.Walk(program, func(node parser.Node) bool {
+		if node.Type() == parser.NumberNode {
+			numbers = append(numbers, node.String())
+		}
+		return node.Type() != parser.ArrayLiteralNode
+	})
+
+	if len(numbers) != 1 || numbers[0] != "Number(3)" {
+		t.Errorf("Expected only Number(3) to be visited, got %v", numbers)
+	}
+}
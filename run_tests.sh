@@ -69,6 +69,7 @@ run_test "tests/test_no_parens_no_return_type.vi" "Functions without Parentheses
 run_test "tests/test_edge_cases.vi" "Edge Cases and Error Handling"
 run_test "tests/test_objects.vi" "Object-Oriented Features"
 run_test "tests/test_arrays.vi" "Arrays and Iteration"
+run_test "tests/comments_only.vi" "Comments-Only File"
 
 # Run the example files as tests too
 echo -e "${YELLOW}Running example files as tests:${NC}"
@@ -29,6 +29,19 @@ var NilType = SimpleType{"nil"}
 // AnyType represents any type
 var AnyType = SimpleType{"any"}
 
+// VoidType is the return type of a function that doesn't return a value.
+// Only nil is assignable to it.
+var VoidType = SimpleType{"void"}
+
+// ErrorType represents the type of a runtime error
+var ErrorType = SimpleType{"error"}
+
+// MapType represents a map from scalar keys to values
+var MapType = SimpleType{"map"}
+
+// RangeType represents an inclusive range of integers
+var RangeType = SimpleType{"range"}
+
 // SimpleType represents a basic type
 type SimpleType struct {
 	Name string
@@ -82,6 +95,12 @@ func (t UnionType) String() string {
 	return result
 }
 
+// Equal reports whether two types are the same. Types are compared by how
+// they're written, since some, like FunctionType, can't be compared with ==.
+func Equal(a, b Type) bool {
+	return a.String() == b.String()
+}
+
 // IsAssignable determines if a value of type src can be assigned to a variable of type dst
 func IsAssignable(src, dst Type) bool {
 	// Any type can be assigned to any
@@ -158,6 +177,45 @@ func IsAssignable(src, dst Type) bool {
 	return false
 }
 
+// FromAnnotation converts a parsed type annotation into a Type.
+// Unknown type names are treated as any.
+func FromAnnotation(node *parser.TypeAnnotation) Type {
+	switch node.TypeName {
+	case "int":
+		return IntType
+	case "float":
+		return FloatType
+	case "string":
+		return StringType
+	case "bool":
+		return BoolType
+	case "any":
+		return AnyType
+	case "void":
+		return VoidType
+	case "Array":
+		if len(node.TypeParams) > 0 {
+			elemType := FromAnnotation(node.TypeParams[0].(*parser.TypeAnnotation))
+			return ArrayType{ElementType: elemType}
+		}
+		// Default to Array of any
+		return ArrayType{ElementType: AnyType}
+	case "union":
+		if len(node.TypeParams) > 0 {
+			var unionTypes []Type
+			for _, param := range node.TypeParams {
+				unionTypes = append(unionTypes, FromAnnotation(param.(*parser.TypeAnnotation)))
+			}
+			return UnionType{Types: unionTypes}
+		}
+		// Invalid union type
+		return AnyType
+	default:
+		// Unknown type, default to any
+		return AnyType
+	}
+}
+
 // TypeChecker provides type checking functionality
 type TypeChecker struct {
 	types map[string]Type